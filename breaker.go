@@ -0,0 +1,297 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// ErrCircuitOpen is the error of the calls rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("ocredis: circuit open")
+
+// ErrorTypeCircuitOpen is the error type of ErrCircuitOpen
+const ErrorTypeCircuitOpen = "circuit_open"
+
+// The states of a circuit breaker, they're the values of the
+// MeasureCircuitState measure
+const (
+	CircuitClosed   = 0
+	CircuitHalfOpen = 1
+	CircuitOpen     = 2
+)
+
+// The defaults of BreakerOptions
+const (
+	DefaultBreakerConsecutiveFailures = 5
+	DefaultBreakerWindow              = 10 * time.Second
+	DefaultBreakerMinCalls            = 20
+	DefaultBreakerOpenTimeout         = 5 * time.Second
+)
+
+// DefaultBreakerFailures are the error types counted as failures when
+// BreakerOptions doesn't list its own. Errors caused by the application,
+// such as WRONGTYPE, don't open the circuit.
+var DefaultBreakerFailures = []string{
+	ErrorTypeTimeout,
+	ErrorTypeNetwork,
+	ErrorTypePoolTimeout,
+	ErrorTypeConnRefused,
+	ErrorTypeLoading,
+	ErrorTypeBusy,
+	ErrorTypeTryAgain,
+	ErrorTypeClusterDown,
+	ErrorTypeOOM,
+}
+
+// BreakerOptions configures a circuit breaker. Zero fields use the defaults.
+type BreakerOptions struct {
+	// ConsecutiveFailures opens the circuit after this many failed calls in
+	// a row
+	ConsecutiveFailures int
+
+	// ErrorRate, if non zero, opens the circuit when at least this fraction
+	// of the calls of a Window failed, once there were MinCalls calls
+	ErrorRate float64
+	Window    time.Duration
+	MinCalls  int
+
+	// OpenTimeout is how long the circuit stays open before the instance is
+	// probed with a ping. The circuit closes when the ping succeeds and opens
+	// again otherwise.
+	OpenTimeout time.Duration
+
+	// Failures lists the error types counted as failures, see ClassifyError.
+	// DefaultBreakerFailures is used when it's empty.
+	Failures []string
+}
+
+// circuitBreaker fails calls fast while an instance is failing
+type circuitBreaker struct {
+	mu       sync.Mutex
+	instance string
+	options  BreakerOptions
+	failures map[string]bool
+	now      func() time.Time
+
+	state       int
+	consecutive int
+	windowStart time.Time
+	calls       int
+	failed      int
+	openedAt    time.Time
+	probing     bool
+}
+
+// newCircuitBreaker returns a breaker of the instance with the defaults of
+// the options applied
+func newCircuitBreaker(instance string, o BreakerOptions) *circuitBreaker {
+	if o.ConsecutiveFailures <= 0 {
+		o.ConsecutiveFailures = DefaultBreakerConsecutiveFailures
+	}
+	if o.Window <= 0 {
+		o.Window = DefaultBreakerWindow
+	}
+	if o.MinCalls <= 0 {
+		o.MinCalls = DefaultBreakerMinCalls
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if len(o.Failures) == 0 {
+		o.Failures = DefaultBreakerFailures
+	}
+	b := &circuitBreaker{
+		instance: instance,
+		options:  o,
+		failures: map[string]bool{},
+		now:      time.Now,
+	}
+	for _, t := range o.Failures {
+		b.failures[t] = true
+	}
+	b.windowStart = b.now()
+	b.recordState()
+	return b
+}
+
+// WithCircuitBreaker fails calls fast with ErrCircuitOpen while the instance
+// is failing, as configured by the options. Each wrapper has a breaker of its
+// own, so wrappers of different servers never trip each other's breaker, and
+// probes the instance by pinging its own client once the open timeout
+// elapsed.
+//
+// The state of the breaker is recorded with the MeasureCircuitState measure
+// tagged with the instance name, give the wrappers with a breaker distinct
+// instance names so their states can be told apart.
+func WithCircuitBreaker(options BreakerOptions) TraceOption {
+	return func(o *TraceOptions) {
+		o.breakerOptions = &options
+	}
+}
+
+// CircuitStater is implemented by the clients with a circuit breaker, such as
+// the wrappers, and by the layers built on a single client
+type CircuitStater interface {
+	// CircuitState returns the state of the circuit breaker, and false when
+	// there's none
+	CircuitState() (int, bool)
+}
+
+// CircuitState returns the state of the circuit breaker of client, and false
+// when it has none or doesn't implement CircuitStater
+func CircuitState(client Getter) (int, bool) {
+	if c, ok := client.(CircuitStater); ok {
+		return c.CircuitState()
+	}
+	return CircuitClosed, false
+}
+
+// CircuitState returns the state of the circuit breaker of the options, and
+// false when it has none
+func (o TraceOptions) CircuitState() (int, bool) {
+	if o.breaker == nil {
+		return CircuitClosed, false
+	}
+	return o.breaker.State(), true
+}
+
+// State returns the state of the breaker
+func (b *circuitBreaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a call may run. Once the open timeout elapsed the
+// first call probes the instance with ping while the others keep failing
+// fast. Without ping the first call is let through as the probe.
+func (b *circuitBreaker) allow(ping func() error) (ok bool, transition string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitClosed:
+		return true, ""
+	case CircuitHalfOpen:
+		return false, ""
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.options.OpenTimeout {
+		return false, ""
+	}
+	if ping == nil {
+		b.setState(CircuitHalfOpen)
+		return true, "circuit half-open"
+	}
+	b.probing = true
+	b.mu.Unlock()
+	err := ping()
+	b.mu.Lock()
+	b.probing = false
+	if err != nil {
+		b.open()
+		return false, ""
+	}
+	b.close()
+	return true, "circuit closed"
+}
+
+// record counts the result of a call that was allowed and returns the
+// transition it caused
+func (b *circuitBreaker) record(errorType string) (transition string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failed := b.failures[errorType]
+	if b.state == CircuitHalfOpen {
+		if failed {
+			b.open()
+			return "circuit opened"
+		}
+		b.close()
+		return "circuit closed"
+	}
+	if b.state == CircuitOpen {
+		return ""
+	}
+	now := b.now()
+	if now.Sub(b.windowStart) >= b.options.Window {
+		b.windowStart, b.calls, b.failed = now, 0, 0
+	}
+	b.calls++
+	if !failed {
+		b.consecutive = 0
+		return ""
+	}
+	b.consecutive++
+	b.failed++
+	rateExceeded := b.options.ErrorRate > 0 && b.calls >= b.options.MinCalls &&
+		float64(b.failed)/float64(b.calls) >= b.options.ErrorRate
+	if b.consecutive >= b.options.ConsecutiveFailures || rateExceeded {
+		b.open()
+		return "circuit opened"
+	}
+	return ""
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = b.now()
+	b.setState(CircuitOpen)
+}
+
+func (b *circuitBreaker) close() {
+	b.consecutive, b.calls, b.failed = 0, 0, 0
+	b.windowStart = b.now()
+	b.setState(CircuitClosed)
+}
+
+func (b *circuitBreaker) setState(state int) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.recordState()
+}
+
+// recordState records the state with the MeasureCircuitState measure
+func (b *circuitBreaker) recordState() {
+	_ = stats.RecordWithTags(context.Background(), []tag.Mutator{
+		tag.Insert(GoRedisInstanceName, b.instance),
+	}, MeasureCircuitState.M(int64(b.state)))
+}
+
+// allow checks the circuit breaker of the call. Closing the client is
+// always allowed. The probe pings the client the wrapper of the call was
+// registered with.
+func (c *Call) allow() bool {
+	b := c.options.breaker
+	if b == nil || c.command == "close" {
+		return true
+	}
+	ok, transition := b.allow(c.options.ping())
+	c.annotate(transition)
+	if !ok {
+		c.rejected = true
+		c.annotate("circuit open")
+	}
+	return ok
+}
+
+// recordBreaker counts the result of the call in the circuit breaker
+func (c *Call) recordBreaker(err error) {
+	if c.options.breaker == nil || c.rejected || c.command == "close" {
+		return
+	}
+	c.annotate(c.options.breaker.record(ClassifyError(err)))
+}
+
+// annotate adds the breaker transition to the span of the call
+func (c *Call) annotate(transition string) {
+	if transition != "" && c.span != nil {
+		c.span.Annotate([]trace.Attribute{
+			trace.StringAttribute("cache.instance", c.options.InstanceName),
+		}, transition)
+	}
+}
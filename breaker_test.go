@@ -0,0 +1,202 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var breakerTests int
+
+// newTestBreaker returns a breaker of its own instance whose clock only moves
+// with the returned function
+func newTestBreaker(o BreakerOptions) (*circuitBreaker, func(time.Duration)) {
+	breakerTests++
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(fmt.Sprintf("breaker-test-%d", breakerTests), o)
+	b.now = func() time.Time { return now }
+	b.windowStart = now
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(BreakerOptions{ConsecutiveFailures: 3})
+	// application errors aren't failures
+	for i := 0; i < 3; i++ {
+		b.record(ErrorTypeWrongType)
+	}
+	b.record(ErrorTypeTimeout)
+	b.record(ErrorTypeTimeout)
+	// a success resets the consecutive failures
+	b.record("")
+	b.record(ErrorTypeTimeout)
+	b.record(ErrorTypeTimeout)
+	if b.state != CircuitClosed {
+		t.Fatalf("state = %d after 2 consecutive failures, want closed", b.state)
+	}
+	if transition := b.record(ErrorTypeTimeout); transition != "circuit opened" || b.state != CircuitOpen {
+		t.Errorf("third consecutive failure: transition %q, state %d, want the circuit opened", transition, b.state)
+	}
+	if ok, _ := b.allow(nil); ok {
+		t.Error("open circuit allowed a call")
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	b, advance := newTestBreaker(BreakerOptions{
+		ConsecutiveFailures: 100,
+		ErrorRate:           0.5,
+		MinCalls:            4,
+		Window:              time.Second,
+	})
+	// failures of a previous window aren't counted
+	b.record(ErrorTypeNetwork)
+	b.record(ErrorTypeNetwork)
+	advance(time.Second)
+	b.record("")
+	b.record(ErrorTypeNetwork)
+	b.record("")
+	if b.state != CircuitClosed {
+		t.Fatalf("state = %d below MinCalls, want closed", b.state)
+	}
+	if b.record(ErrorTypeNetwork); b.state != CircuitOpen {
+		t.Errorf("state = %d with half of 4 calls failed, want open", b.state)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, advance := newTestBreaker(BreakerOptions{ConsecutiveFailures: 1, OpenTimeout: time.Second})
+	b.record(ErrorTypeTimeout)
+
+	advance(500 * time.Millisecond)
+	if ok, _ := b.allow(nil); ok {
+		t.Fatal("circuit allowed a call before the open timeout")
+	}
+	advance(500 * time.Millisecond)
+	ok, transition := b.allow(nil)
+	if !ok || transition != "circuit half-open" || b.state != CircuitHalfOpen {
+		t.Fatalf("allow after the open timeout = %v %q, state %d, want the probe call let through", ok, transition, b.state)
+	}
+	if ok, _ := b.allow(nil); ok {
+		t.Error("half-open circuit allowed a second call")
+	}
+	// the probe call failed
+	if transition := b.record(ErrorTypeTimeout); transition != "circuit opened" || b.state != CircuitOpen {
+		t.Fatalf("failed probe: transition %q, state %d, want the circuit opened", transition, b.state)
+	}
+
+	advance(time.Second)
+	if ok, _ := b.allow(nil); !ok {
+		t.Fatal("circuit didn't let the second probe through")
+	}
+	if transition := b.record(""); transition != "circuit closed" || b.state != CircuitClosed {
+		t.Errorf("successful probe: transition %q, state %d, want the circuit closed", transition, b.state)
+	}
+}
+
+func TestBreakerPing(t *testing.T) {
+	b, advance := newTestBreaker(BreakerOptions{ConsecutiveFailures: 1, OpenTimeout: time.Second})
+	b.record(ErrorTypeTimeout)
+	advance(time.Second)
+
+	if ok, _ := b.allow(func() error { return errors.New("dial tcp: connection refused") }); ok || b.state != CircuitOpen {
+		t.Fatalf("failed ping: allowed %v, state %d, want the circuit kept open", ok, b.state)
+	}
+	// the failed ping restarted the open timeout
+	if ok, _ := b.allow(func() error { return nil }); ok {
+		t.Fatal("circuit probed again before the open timeout")
+	}
+	advance(time.Second)
+	if ok, transition := b.allow(func() error { return nil }); !ok || transition != "circuit closed" || b.state != CircuitClosed {
+		t.Errorf("successful ping: allowed %v %q, state %d, want the circuit closed", ok, transition, b.state)
+	}
+}
+
+func TestBreakerPerWrapper(t *testing.T) {
+	// wrappers left on the default instance name
+	options := []TraceOption{
+		WithCircuitBreaker(BreakerOptions{ConsecutiveFailures: 1, OpenTimeout: time.Nanosecond}),
+	}
+	var pinged []string
+	register := func(name string) TraceOptions {
+		o := NewTraceOptions(options...)
+		RegisterInstance(&o, Instance{Ping: func() error {
+			pinged = append(pinged, name)
+			return nil
+		}})
+		return o
+	}
+	failing, healthy := register("failing"), register("healthy")
+	defer UnregisterInstance(failing)
+	defer UnregisterInstance(healthy)
+	if failing.breaker == healthy.breaker {
+		t.Fatal("wrappers sharing an instance name share a breaker")
+	}
+
+	call := StartCall(context.Background(), failing, "get", []string{"key"})
+	_ = call.Do(func() Cmd { return NewStringResult("", errors.New("i/o timeout")) })
+	call.End(NewStringResult("", context.DeadlineExceeded))
+	if state, ok := failing.CircuitState(); !ok || state != CircuitOpen {
+		t.Fatalf("state of the failing wrapper = %d, %v, want open", state, ok)
+	}
+	if state, ok := healthy.CircuitState(); !ok || state != CircuitClosed {
+		t.Errorf("state of the healthy wrapper = %d, %v, want closed", state, ok)
+	}
+	call = StartCall(context.Background(), healthy, "get", []string{"key"})
+	if err := call.Do(func() Cmd { return NewStringResult("value", nil) }); err != nil {
+		t.Errorf("call of the healthy wrapper: %v", err)
+	}
+
+	// the probe pings the client of the failing wrapper
+	time.Sleep(time.Millisecond)
+	call = StartCall(context.Background(), failing, "get", []string{"key"})
+	if err := call.Do(func() Cmd { return NewStringResult("value", nil) }); err != nil {
+		t.Fatalf("Do after the open timeout: %v", err)
+	}
+	if len(pinged) != 1 || pinged[0] != "failing" {
+		t.Errorf("pinged %v, want the client of the failing wrapper", pinged)
+	}
+}
+
+func TestBreakerOptionsPerWrapper(t *testing.T) {
+	first := NewTraceOptions(WithInstanceName("breaker-test-options"), WithCircuitBreaker(BreakerOptions{ConsecutiveFailures: 1}))
+	second := NewTraceOptions(WithInstanceName("breaker-test-options"), WithCircuitBreaker(BreakerOptions{ConsecutiveFailures: 3}))
+	if a, b := first.breaker.options.ConsecutiveFailures, second.breaker.options.ConsecutiveFailures; a != 1 || b != 3 {
+		t.Errorf("ConsecutiveFailures = %d and %d, want each wrapper's own 1 and 3", a, b)
+	}
+	if _, ok := NewTraceOptions().CircuitState(); ok {
+		t.Error("options without a breaker report a circuit state")
+	}
+}
+
+// stater is a client with a circuit breaker
+type stater struct {
+	Getter
+	state int
+}
+
+func (s stater) CircuitState() (int, bool) {
+	return s.state, true
+}
+
+func TestCircuitState(t *testing.T) {
+	if _, ok := CircuitState(nil); ok {
+		t.Error("CircuitState of a client without a breaker = true")
+	}
+	client := stater{state: CircuitOpen}
+	if state, ok := CircuitState(client); !ok || state != CircuitOpen {
+		t.Errorf("CircuitState = %d, %v, want open", state, ok)
+	}
+	// layers built on a single client report its state
+	if state, ok := CircuitState(NewForwarder(client)); !ok || state != CircuitOpen {
+		t.Errorf("CircuitState of a forwarder = %d, %v, want the state of its client", state, ok)
+	}
+	routing := NewRoutingForwarder(func(ctx context.Context, command string) (context.Context, Getter) {
+		return ctx, client
+	})
+	if _, ok := CircuitState(routing); ok {
+		t.Error("CircuitState of a routing forwarder = true, want false")
+	}
+}
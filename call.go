@@ -0,0 +1,226 @@
+package ocredis
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// Call instruments a single redis command. Wrappers start a call before
+// running the command and end it with the result, which ends the span and
+// records the stats of the call.
+type Call struct {
+	ctx     context.Context
+	command string
+	keys    []string
+	args    []interface{}
+	options TraceOptions
+	span    *SpanWrapper
+	record  func(cmd Cmd)
+	start   time.Time
+
+	// sanitized holds the sanitized arguments once computed
+	sanitized []string
+
+	// rejected is true when the circuit breaker rejected the call
+	rejected bool
+}
+
+// StartCall starts the instrumentation of the command. keys are the keys the
+// command operates on and args the remaining arguments, they are only
+// exported after being sanitized.
+func StartCall(ctx context.Context, options TraceOptions, command string, keys []string, args ...interface{}) *Call {
+	method := MethodPrefix + command
+	c := &Call{
+		ctx:     ctx,
+		command: command,
+		keys:    keys,
+		args:    args,
+		options: options,
+	}
+	if AllowTrace(ctx, options.Traced(command), options.AllowRoot) {
+		c.span = StartSpan(ctx, method, options)
+	}
+	if c.span != nil && options.Statement {
+		c.span.AddAttributes(trace.StringAttribute("redis.statement", statement(c.command, c.sanitizedArgs())))
+	}
+	if options.keyPatterns != nil && len(keys) > 0 {
+		c.ctx = withKeyPattern(ctx, options.keyPatterns.pattern(keys[0]))
+	}
+	c.record = RecordCall(c.ctx, method, options.InstanceName)
+	c.start = time.Now()
+	return c
+}
+
+// End ends the span of the call and records its stats
+func (c *Call) End(cmd Cmd) {
+	var (
+		err       = cmd.Err()
+		latency   = time.Since(c.start)
+		threshold = c.options.Command(c.command).SlowThreshold
+		slow      = threshold > 0 && latency >= threshold
+	)
+	c.recordBreaker(err)
+	if c.options.KeyAnalyzer != nil && (err == nil || IsNil(err)) {
+		c.analyzeKeys(cmd)
+	}
+	if c.span != nil {
+		if slow {
+			c.span.AddAttributes(trace.BoolAttribute("slow", true))
+		}
+		c.span.EndSpanWithErr(err)
+	}
+	c.record(cmd)
+	if slow {
+		c.recordSlow(err, latency, threshold)
+	}
+	if c.options.Logger != nil {
+		c.log(err, latency, slow)
+	}
+	c.recordDebug(err, latency)
+}
+
+// log passes the call to the Logger when the LogFilter selects it
+func (c *Call) log(err error, latency time.Duration, slow bool) {
+	status, errorType := statusOK, ClassifyError(err)
+	if errorType != "" {
+		status = statusError
+	}
+	entry := LogEntry{
+		InstanceName: c.options.InstanceName,
+		Method:       scriptName(c.ctx, MethodPrefix+c.command),
+		Latency:      latency,
+		Status:       status,
+		Err:          err,
+		ErrorType:    errorType,
+		Slow:         slow,
+		Sampled:      c.span != nil && c.span.SpanContext().IsSampled(),
+	}
+	if c.options.LogFilter != nil && !c.options.LogFilter(entry) {
+		return
+	}
+	entry.Args = c.sanitizedArgs()
+	entry.TraceID, entry.SpanID = c.spanIDs()
+	c.options.Logger.Log(c.ctx, entry)
+}
+
+// sanitizedArgs returns the sanitized keys and arguments of the call
+func (c *Call) sanitizedArgs() []string {
+	if c.sanitized == nil {
+		c.sanitized = c.options.sanitizeArgs(c.command, c.keys, c.args)
+	}
+	return c.sanitized
+}
+
+// recordSlow records a call that exceeded its slow threshold and passes it to
+// the SlowLogger
+func (c *Call) recordSlow(err error, latency, threshold time.Duration) {
+	method := MethodPrefix + c.command
+	_ = stats.RecordWithTags(c.ctx, callTags(c.ctx, method, c.options.InstanceName, err), MeasureSlowCalls.M(1))
+	if c.options.SlowLogger == nil {
+		return
+	}
+	traceID, spanID := c.spanIDs()
+	c.options.SlowLogger(c.ctx, SlowCall{
+		InstanceName: c.options.InstanceName,
+		Command:      scriptName(c.ctx, c.command),
+		Args:         c.sanitizedArgs(),
+		Latency:      latency,
+		Threshold:    threshold,
+		Err:          err,
+		TraceID:      traceID,
+		SpanID:       spanID,
+	})
+}
+
+// spanIDs returns the trace and span IDs of the span of the call, or of the
+// parent span when the call wasn't traced
+func (c *Call) spanIDs() (traceID, spanID string) {
+	var sc trace.SpanContext
+	if c.span != nil {
+		sc = c.span.SpanContext()
+	} else if span := trace.FromContext(c.ctx); span != nil {
+		sc = span.SpanContext()
+	} else {
+		return "", ""
+	}
+	return sc.TraceID.String(), sc.SpanID.String()
+}
+
+// analyzeKeys feeds the keys of the call to the KeyAnalyzer. The size of the
+// value is only known for the first key.
+func (c *Call) analyzeKeys(cmd Cmd) {
+	for i, key := range c.keys {
+		size := 0
+		if i == 0 {
+			size = c.valueSize(cmd)
+		}
+		count, hot := c.options.KeyAnalyzer.Observe(key, size)
+		if !hot || c.span == nil {
+			continue
+		}
+		attributes := []trace.Attribute{trace.Int64Attribute("redis.key.count", count)}
+		// the key is left out when the sanitizer drops it
+		if sanitized := c.options.sanitizeArgs(c.command, []string{key}, nil); len(sanitized) > 0 {
+			attributes = append(attributes, trace.StringAttribute("redis.key", sanitized[0]))
+		}
+		c.span.Annotate(attributes, "hot key")
+	}
+}
+
+// valueSize returns the size of the value read or written by the call, the
+// string result of reads or the largest string argument of writes
+func (c *Call) valueSize(cmd Cmd) int {
+	if s, ok := cmd.(StringCmd); ok && cmd.Err() == nil {
+		return len(s.Val())
+	}
+	size := 0
+	for _, arg := range c.args {
+		n := 0
+		switch v := arg.(type) {
+		case string:
+			n = len(v)
+		case []byte:
+			n = len(v)
+		}
+		if n > size {
+			size = n
+		}
+	}
+	return size
+}
+
+// withKeyPattern tags the context with the key pattern so it's recorded with
+// the stats of the call
+func withKeyPattern(ctx context.Context, pattern string) context.Context {
+	tagged, err := tag.New(ctx, tag.Upsert(GoRedisKeyPattern, pattern))
+	if err != nil {
+		// the pattern isn't a valid tag value
+		tagged, _ = tag.New(ctx, tag.Upsert(GoRedisKeyPattern, KeyPatternOther))
+	}
+	return tagged
+}
+
+// SlowCall describes a call that took at least its slow threshold
+type SlowCall struct {
+	InstanceName string
+	Command      string
+
+	// Args are the keys and arguments of the call after sanitization
+	Args []string
+
+	Latency   time.Duration
+	Threshold time.Duration
+	Err       error
+
+	// TraceID and SpanID identify the span of the call. They are empty when
+	// the call has no span.
+	TraceID string
+	SpanID  string
+}
+
+// SlowLogger receives the calls that took at least their slow threshold
+type SlowLogger func(ctx context.Context, call SlowCall)
@@ -0,0 +1,137 @@
+package codec
+
+import (
+	"context"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/trace"
+)
+
+// Client gets and sets values encoded by a Codec with a wrapped client.
+// Missing keys return the redis.Nil error of the client, see ocredis.IsNil.
+// Commands the client doesn't implement return
+// ocredis.ErrUnsupportedCommand.
+type Client struct {
+	client ocredis.Getter
+	codec  Codec
+}
+
+// NewClient returns a client encoding the values with codec
+func NewClient(client ocredis.Getter, codec Codec) *Client {
+	return &Client{
+		client: client,
+		codec:  codec,
+	}
+}
+
+// GetObject decodes the value of the key into v
+func (c *Client) GetObject(ctx context.Context, key string, v interface{}) error {
+	ctx, span := c.startSpan(ctx, "get")
+	defer span.end()
+	return span.decode(c.client.Get(ctx, key), v)
+}
+
+// SetObject encodes v as the value of the key
+func (c *Client) SetObject(ctx context.Context, key string, v interface{}, expiration time.Duration) error {
+	ctx, span := c.startSpan(ctx, "set")
+	defer span.end()
+	s, ok := c.client.(interface {
+		Set(ctx context.Context, key string, value interface{}, expiration time.Duration) ocredis.StatusCmd
+	})
+	if !ok {
+		return span.fail(ocredis.ErrUnsupportedCommand)
+	}
+	data, err := span.encode(v)
+	if err != nil {
+		return err
+	}
+	return span.fail(s.Set(ctx, key, data, expiration).Err())
+}
+
+// HGetObject decodes the value of the field of the hash into v
+func (c *Client) HGetObject(ctx context.Context, key, field string, v interface{}) error {
+	ctx, span := c.startSpan(ctx, "hget")
+	defer span.end()
+	h, ok := c.client.(ocredis.HashGetter)
+	if !ok {
+		return span.fail(ocredis.ErrUnsupportedCommand)
+	}
+	return span.decode(h.HGet(ctx, key, field), v)
+}
+
+// HSetObject encodes v as the value of the field of the hash
+func (c *Client) HSetObject(ctx context.Context, key, field string, v interface{}) error {
+	ctx, span := c.startSpan(ctx, "hset")
+	defer span.end()
+	h, ok := c.client.(interface {
+		HSet(ctx context.Context, key, field string, value interface{}) ocredis.BoolCmd
+	})
+	if !ok {
+		return span.fail(ocredis.ErrUnsupportedCommand)
+	}
+	data, err := span.encode(v)
+	if err != nil {
+		return err
+	}
+	return span.fail(h.HSet(ctx, key, field, data).Err())
+}
+
+// objectSpan is the span of a typed call. Its span is nil when the call
+// isn't traced.
+type objectSpan struct {
+	span  *trace.Span
+	codec Codec
+}
+
+// startSpan starts the span of the typed call when the context has a span
+func (c *Client) startSpan(ctx context.Context, command string) (context.Context, *objectSpan) {
+	s := &objectSpan{codec: c.codec}
+	if ocredis.AllowTrace(ctx, true, false) {
+		ctx, s.span = trace.StartSpan(ctx, ocredis.MethodPrefix+"object."+command, trace.WithSpanKind(trace.SpanKindClient))
+		s.span.AddAttributes(trace.StringAttribute("redis.codec", c.codec.Name()))
+	}
+	return ctx, s
+}
+
+func (s *objectSpan) encode(v interface{}) ([]byte, error) {
+	start := time.Now()
+	data, err := s.codec.Marshal(v)
+	if s.span != nil {
+		s.span.AddAttributes(
+			trace.Int64Attribute("redis.codec.encode_us", time.Since(start).Microseconds()),
+			trace.Int64Attribute("redis.codec.bytes", int64(len(data))),
+		)
+	}
+	return data, s.fail(err)
+}
+
+func (s *objectSpan) decode(cmd ocredis.StringCmd, v interface{}) error {
+	data, err := cmd.Bytes()
+	if err != nil {
+		return s.fail(err)
+	}
+	start := time.Now()
+	err = s.codec.Unmarshal(data, v)
+	if s.span != nil {
+		s.span.AddAttributes(
+			trace.Int64Attribute("redis.codec.decode_us", time.Since(start).Microseconds()),
+			trace.Int64Attribute("redis.codec.bytes", int64(len(data))),
+		)
+	}
+	return s.fail(err)
+}
+
+// fail sets the status of the span from the error and returns it
+func (s *objectSpan) fail(err error) error {
+	if err != nil && s.span != nil {
+		s.span.SetStatus(trace.Status{Code: ocredis.ErrorStatusCode(ocredis.ClassifyError(err)), Message: err.Error()})
+	}
+	return err
+}
+
+func (s *objectSpan) end() {
+	if s.span != nil {
+		s.span.End()
+	}
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	"github.com/KolbyMcGarrah/ocredis/redistest/v5test"
+	"go.opencensus.io/trace"
+)
+
+func newTestClient(t *testing.T, codec Codec) (*redistest.Server, *Client, *octest.Exporter) {
+	t.Helper()
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	t.Cleanup(e.Unregister)
+	s, w := v5test.NewClient(t)
+	return s, NewClient(w, codec), e
+}
+
+// assertCodecSpan checks the span has the codec, the encoded size and the
+// timing attribute
+func assertCodecSpan(t *testing.T, e *octest.Exporter, name, codec, timing string, size int) {
+	t.Helper()
+	sd := e.AssertSpan(t, name, map[string]interface{}{
+		"redis.codec":       codec,
+		"redis.codec.bytes": int64(size),
+	}, trace.StatusCodeOK)
+	if sd == nil {
+		return
+	}
+	if us, ok := sd.Attributes[timing].(int64); !ok || us < 0 {
+		t.Errorf("%s has %s = %v, want a duration in microseconds", name, timing, sd.Attributes[timing])
+	}
+}
+
+func TestClientObjects(t *testing.T) {
+	want := account{ID: 42, Name: "billing", Balance: 12.5}
+	for _, c := range []Codec{JSON, Gob, Msgpack} {
+		t.Run(c.Name(), func(t *testing.T) {
+			s, client, e := newTestClient(t, c)
+			ctx, span := trace.StartSpan(context.Background(), "parent", trace.WithSampler(trace.AlwaysSample()))
+			defer span.End()
+
+			if err := client.SetObject(ctx, "account", want, 0); err != nil {
+				t.Fatalf("SetObject: %v", err)
+			}
+			var got account
+			if err := client.GetObject(ctx, "account", &got); err != nil {
+				t.Fatalf("GetObject: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetObject = %+v, want %+v", got, want)
+			}
+			stored, _ := s.Get("account")
+			assertCodecSpan(t, e, "go.redis.object.set", c.Name(), "redis.codec.encode_us", len(stored))
+			assertCodecSpan(t, e, "go.redis.object.get", c.Name(), "redis.codec.decode_us", len(stored))
+		})
+	}
+}
+
+func TestClientHashObjects(t *testing.T) {
+	_, client, e := newTestClient(t, JSON)
+	ctx, span := trace.StartSpan(context.Background(), "parent", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+
+	want := account{ID: 7, Tags: []string{"x"}}
+	if err := client.HSetObject(ctx, "accounts", "7", want); err != nil {
+		t.Fatalf("HSetObject: %v", err)
+	}
+	var got account
+	if err := client.HGetObject(ctx, "accounts", "7", &got); err != nil {
+		t.Fatalf("HGetObject: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HGetObject = %+v, want %+v", got, want)
+	}
+	size := len(`{"ID":7,"Name":"","Balance":0,"Tags":["x"]}`)
+	assertCodecSpan(t, e, "go.redis.object.hset", "json", "redis.codec.encode_us", size)
+	assertCodecSpan(t, e, "go.redis.object.hget", "json", "redis.codec.decode_us", size)
+}
+
+func TestClientErrors(t *testing.T) {
+	s, client, e := newTestClient(t, JSON)
+	ctx, span := trace.StartSpan(context.Background(), "parent", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+
+	var got account
+	if err := client.GetObject(ctx, "missing", &got); !ocredis.IsNil(err) {
+		t.Errorf("GetObject of a missing key = %v, want the nil error", err)
+	}
+	s.Set("invalid", "not json")
+	if err := client.GetObject(ctx, "invalid", &got); err == nil {
+		t.Error("GetObject decoded an invalid value")
+	}
+	if err := client.SetObject(ctx, "channel", make(chan int), 0); err == nil {
+		t.Error("SetObject encoded a channel")
+	}
+	if s.Exists("channel") {
+		t.Error("SetObject stored a value it failed to encode")
+	}
+	if spans := e.SpansNamed("go.redis.object.get"); len(spans) != 2 {
+		t.Errorf("recorded %d get spans, want 2", len(spans))
+	}
+
+	// the client doesn't implement SET
+	c := NewClient(getterOnly{}, JSON)
+	if err := c.SetObject(ctx, "key", 1, 0); !errors.Is(err, ocredis.ErrUnsupportedCommand) {
+		t.Errorf("SetObject = %v, want ErrUnsupportedCommand", err)
+	}
+	if err := c.HGetObject(ctx, "key", "field", &got); !errors.Is(err, ocredis.ErrUnsupportedCommand) {
+		t.Errorf("HGetObject = %v, want ErrUnsupportedCommand", err)
+	}
+}
+
+type getterOnly struct{}
+
+func (getterOnly) Get(ctx context.Context, key string) ocredis.StringCmd {
+	return ocredis.NewStringResult("", nil)
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type account struct {
+	ID      int64
+	Name    string
+	Balance float64
+	Tags    []string
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	want := account{ID: 42, Name: "billing", Balance: 12.5, Tags: []string{"a", "b"}}
+	for _, c := range []Codec{JSON, Gob, Msgpack} {
+		data, err := c.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", c.Name(), err)
+		}
+		var got account
+		if err := c.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", c.Name(), err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded %+v, want %+v", c.Name(), got, want)
+		}
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	data, err := Protobuf.Marshal(wrapperspb.String("billing"))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	got := &wrapperspb.StringValue{}
+	if err := Protobuf.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !proto.Equal(got, wrapperspb.String("billing")) {
+		t.Errorf("decoded %v, want billing", got)
+	}
+
+	if _, err := Protobuf.Marshal(account{}); err != ErrNotProtoMessage {
+		t.Errorf("Marshal of a struct = %v, want ErrNotProtoMessage", err)
+	}
+	if err := Protobuf.Unmarshal(data, &account{}); err != ErrNotProtoMessage {
+		t.Errorf("Unmarshal into a struct = %v, want ErrNotProtoMessage", err)
+	}
+}
@@ -52,3 +52,11 @@ type BoolCmd interface {
 	String() string
 	Val() bool
 }
+
+// BoolSliceCmd interface matches the BoolSliceCmd struct returned by redis clients
+type BoolSliceCmd interface {
+	Err() error
+	Result() ([]bool, error)
+	String() string
+	Val() []bool
+}
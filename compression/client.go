@@ -0,0 +1,178 @@
+package compression
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// DefaultThreshold is the size in bytes from which values are compressed
+// when Options doesn't set one
+const DefaultThreshold = 1024
+
+// Options configures a Client
+type Options struct {
+	// Compressor compresses the values written, Snappy when nil
+	Compressor Compressor
+
+	// Threshold is the size in bytes from which values are compressed
+	Threshold int
+
+	// Decompressors are the compressors, besides the built-in ones and
+	// Compressor, whose values can be read
+	Decompressors []Compressor
+}
+
+// Client compresses the string and hash values written with a wrapped
+// client and decompresses the values read. Values that aren't strings or
+// byte slices, and values the compressor doesn't make smaller, are stored
+// uncompressed. The compression ratio and the time spent compressing and
+// decompressing are recorded with the MeasureCompressionRatio and
+// MeasureCompressionTimeMs measures.
+//
+// Commands not implemented by the client return
+// ocredis.ErrUnsupportedCommand.
+type Client struct {
+	ocredis.Forwarder
+
+	compressor  Compressor
+	threshold   int
+	compressors map[byte]Compressor
+}
+
+var (
+	_ ocredis.Client   = &Client{}
+	_ ocredis.Cmdable  = &Client{}
+	_ ocredis.Scripter = &Client{}
+)
+
+// NewClient returns a client compressing the values of client
+func NewClient(client ocredis.Getter, options Options) *Client {
+	if options.Compressor == nil {
+		options.Compressor = Snappy
+	}
+	if options.Threshold <= 0 {
+		options.Threshold = DefaultThreshold
+	}
+	c := &Client{
+		Forwarder:   ocredis.NewForwarder(client),
+		compressor:  options.Compressor,
+		threshold:   options.Threshold,
+		compressors: map[byte]Compressor{},
+	}
+	for _, d := range append([]Compressor{Gzip, Snappy, Zstd, LZ4, options.Compressor}, options.Decompressors...) {
+		c.compressors[d.Header()] = d
+	}
+	return c
+}
+
+// compress returns the value to write
+func (c *Client) compress(ctx context.Context, command string, value interface{}) interface{} {
+	var src []byte
+	switch v := value.(type) {
+	case string:
+		src = []byte(v)
+	case []byte:
+		src = v
+	default:
+		return value
+	}
+	if len(src) < c.threshold {
+		return raw(value, src)
+	}
+	start := time.Now()
+	compressed, err := c.compressor.Compress(src)
+	size := len(Magic) + 1 + len(compressed)
+	if err != nil || size >= len(src) {
+		return raw(value, src)
+	}
+	c.record(ctx, command, c.compressor, start, len(src), size)
+	return header(c.compressor.Header(), compressed)
+}
+
+// raw returns the value to write uncompressed, prefixed with HeaderRaw when
+// it would be taken for a value written by a Client
+func raw(value interface{}, src []byte) interface{} {
+	if !strings.HasPrefix(string(src), Magic) {
+		return value
+	}
+	return header(HeaderRaw, src)
+}
+
+// header returns data prefixed with Magic and h
+func header(h byte, data []byte) []byte {
+	b := make([]byte, 0, len(Magic)+1+len(data))
+	b = append(b, Magic...)
+	b = append(b, h)
+	return append(b, data...)
+}
+
+// decompress returns the command with its value decompressed
+func (c *Client) decompress(ctx context.Context, command string, cmd ocredis.StringCmd) ocredis.StringCmd {
+	data, err := cmd.Bytes()
+	if err != nil || len(data) <= len(Magic) || !strings.HasPrefix(string(data), Magic) {
+		return cmd
+	}
+	h, payload := data[len(Magic)], data[len(Magic)+1:]
+	if h == HeaderRaw {
+		return ocredis.NewStringResult(string(payload), nil)
+	}
+	d, ok := c.compressors[h]
+	if !ok {
+		return cmd
+	}
+	start := time.Now()
+	decompressed, err := d.Decompress(payload)
+	if err != nil {
+		// a legacy value starting with Magic
+		return cmd
+	}
+	c.record(ctx, command, d, start, len(decompressed), len(data))
+	return ocredis.NewStringResult(string(decompressed), nil)
+}
+
+// record records the compression ratio and time of a value
+func (c *Client) record(ctx context.Context, command string, d Compressor, start time.Time, size, compressedSize int) {
+	elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Insert(ocredis.GoRedisMethod, ocredis.MethodPrefix+command),
+		tag.Insert(ocredis.GoRedisCompression, d.Name()),
+	},
+		ocredis.MeasureCompressionRatio.M(float64(size)/float64(compressedSize)),
+		ocredis.MeasureCompressionTimeMs.M(elapsed),
+	)
+}
+
+// Get runs the redis get command and decompresses the value
+func (c *Client) Get(ctx context.Context, key string) ocredis.StringCmd {
+	return c.decompress(ctx, "get", c.Forwarder.Get(ctx, key))
+}
+
+// Set compresses the value and runs the redis set command
+func (c *Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) ocredis.StatusCmd {
+	return c.Forwarder.Set(ctx, key, c.compress(ctx, "set", value), expiration)
+}
+
+// SetNX compresses the value and runs the redis setnx command
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) ocredis.BoolCmd {
+	return c.Forwarder.SetNX(ctx, key, c.compress(ctx, "setnx", value), expiration)
+}
+
+// LPop runs the redis lpop command and decompresses the value
+func (c *Client) LPop(ctx context.Context, key string) ocredis.StringCmd {
+	return c.decompress(ctx, "lpop", c.Forwarder.LPop(ctx, key))
+}
+
+// HGet runs the redis hget command and decompresses the value
+func (c *Client) HGet(ctx context.Context, key, field string) ocredis.StringCmd {
+	return c.decompress(ctx, "hget", c.Forwarder.HGet(ctx, key, field))
+}
+
+// HSet compresses the value and runs the redis hset command
+func (c *Client) HSet(ctx context.Context, key, field string, value interface{}) ocredis.BoolCmd {
+	return c.Forwarder.HSet(ctx, key, field, c.compress(ctx, "hset", value))
+}
@@ -0,0 +1,162 @@
+package compression
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	"github.com/KolbyMcGarrah/ocredis/redistest/v5test"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func newTestClient(t *testing.T, options Options) (*redistest.Server, *Client) {
+	t.Helper()
+	s, w := v5test.NewClient(t)
+	return s, NewClient(w, options)
+}
+
+// roundTripValues are written and read back through the client
+var roundTripValues = map[string]string{
+	"empty":      "",
+	"small":      "value",
+	"large":      strings.Repeat("compressible ", 200),
+	"binary":     "\x02\x00",
+	"header":     "\x01\x02\x03\x04",
+	"magic":      Magic,
+	"magic raw":  Magic + "\x00value",
+	"magic gzip": Magic + "\x01" + strings.Repeat("x", 2000),
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, compressor := range []Compressor{Gzip, Snappy, Zstd, LZ4} {
+		t.Run(compressor.Name(), func(t *testing.T) {
+			s, c := newTestClient(t, Options{Compressor: compressor, Threshold: 64})
+			for name, value := range roundTripValues {
+				if err := c.Set(ctx, name, value, 0).Err(); err != nil {
+					t.Fatalf("Set(%s): %v", name, err)
+				}
+				if v, err := c.Get(ctx, name).Result(); err != nil || v != value {
+					t.Errorf("Get(%s) = %q, %v, want %q", name, v, err, value)
+				}
+				if err := c.HSet(ctx, "hash", name, []byte(value)).Err(); err != nil {
+					t.Fatalf("HSet(%s): %v", name, err)
+				}
+				if v, err := c.HGet(ctx, "hash", name).Result(); err != nil || v != value {
+					t.Errorf("HGet(%s) = %q, %v, want %q", name, v, err, value)
+				}
+			}
+
+			// large values are compressed, small ones stored as they are
+			stored, _ := s.Get("large")
+			if want := Magic + string([]byte{compressor.Header()}); !strings.HasPrefix(stored, want) || len(stored) >= len(roundTripValues["large"]) {
+				t.Errorf("large value stored as %q, want it compressed", stored)
+			}
+			if stored, _ := s.Get("small"); stored != "value" {
+				t.Errorf("small value stored as %q, want it unchanged", stored)
+			}
+		})
+	}
+}
+
+func TestLegacyValues(t *testing.T) {
+	ctx := context.Background()
+	s, c := newTestClient(t, Options{})
+	legacy := map[string]string{
+		"binary":  "\x02\x00",
+		"gzip":    "\x01abc",
+		"empty":   "",
+		"magic":   Magic,
+		"unknown": Magic + "\x7fpayload",
+		"corrupt": Magic + "\x02not snappy",
+	}
+	for key, value := range legacy {
+		s.Set(key, value)
+		if v, err := c.Get(ctx, key).Result(); err != nil || v != value {
+			t.Errorf("Get(%s) = %q, %v, want the legacy value %q", key, v, err, value)
+		}
+	}
+}
+
+func TestIncompressibleValues(t *testing.T) {
+	ctx := context.Background()
+	s, c := newTestClient(t, Options{Compressor: Gzip, Threshold: 1})
+	// gzip makes short values larger, they're stored unchanged
+	c.Set(ctx, "short", "abc", 0)
+	if stored, _ := s.Get("short"); stored != "abc" {
+		t.Errorf("short value stored as %q, want it unchanged", stored)
+	}
+	// counters stored through the client can be incremented
+	c.Set(ctx, "counter", "41", 0)
+	if n, err := s.Do("INCR", "counter"); err != nil || n != int64(42) {
+		t.Errorf("INCR = %v, %v, want 42", n, err)
+	}
+}
+
+func TestDecompressors(t *testing.T) {
+	ctx := context.Background()
+	s, writer := newTestClient(t, Options{Compressor: Zstd, Threshold: 1})
+	value := strings.Repeat("zstd ", 100)
+	writer.Set(ctx, "key", value, 0)
+
+	// every client reads the values of the built-in compressors
+	reader := NewClient(writer.Forwarder, Options{Compressor: Gzip})
+	if v, err := reader.Get(ctx, "key").Result(); err != nil || v != value {
+		t.Errorf("Get with another compressor = %q, %v, want %q", v, err, value)
+	}
+	if stored, _ := s.Get("key"); !strings.HasPrefix(stored, Magic+"\x03") {
+		t.Errorf("value stored as %q, want the zstd header", stored)
+	}
+}
+
+func TestCompressionViews(t *testing.T) {
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	defer e.Unregister()
+	ctx := context.Background()
+	_, c := newTestClient(t, Options{Compressor: Gzip, Threshold: 1})
+	value := strings.Repeat("compressible ", 200)
+	c.Set(ctx, "key", value, 0)
+	c.Get(ctx, "key")
+	// values left uncompressed aren't recorded
+	c.Set(ctx, "incompressible", "\x00", 0)
+	c.Get(ctx, "incompressible")
+
+	for _, v := range []*view.View{ocredis.GoRedisCompressionRatioView, ocredis.GoRedisCompressionTimeView} {
+		rows, err := e.Rows(v)
+		if err != nil {
+			t.Fatalf("reading %s: %v", v.Name, err)
+		}
+		got := map[string]*view.DistributionData{}
+		for _, row := range rows {
+			tags := map[tag.Key]string{}
+			for _, tg := range row.Tags {
+				tags[tg.Key] = tg.Value
+			}
+			if tags[ocredis.GoRedisCompression] != "gzip" {
+				t.Errorf("%s recorded the compression %q, want gzip", v.Name, tags[ocredis.GoRedisCompression])
+			}
+			got[tags[ocredis.GoRedisMethod]] = row.Data.(*view.DistributionData)
+		}
+		if len(got) != 2 {
+			t.Fatalf("%s has the methods %v, want go.redis.set and go.redis.get", v.Name, got)
+		}
+		for _, method := range []string{"go.redis.set", "go.redis.get"} {
+			d := got[method]
+			if d == nil || d.Count != 1 {
+				t.Errorf("%s recorded %v for %s, want a single value", v.Name, d, method)
+				continue
+			}
+			// the value is 2600 bytes, compressed to a few dozens
+			if v == ocredis.GoRedisCompressionRatioView && d.Mean < 10 {
+				t.Errorf("compression ratio of %s = %v, want the size of the value over its compressed size", method, d.Mean)
+			}
+		}
+	}
+}
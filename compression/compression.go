@@ -0,0 +1,132 @@
+// Package compression compresses the string and hash values stored with a
+// wrapped client. Values at least as large as a threshold are compressed and
+// prefixed with Magic and a header byte identifying the algorithm, so reads
+// detect it. Values stored uncompressed that start with Magic are prefixed
+// with Magic and HeaderRaw, the others are stored unchanged. Values without
+// Magic, such as values stored before compression was enabled, are returned
+// unchanged.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	lz4 "github.com/bkaradzic/go-lz4"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic starts the values written by a Client that reads must transform. It
+// is followed by a header byte.
+const Magic = "\x00OCZ"
+
+// Compressor compresses values
+type Compressor interface {
+	// Name is set as the GoRedisCompression tag of the measures
+	Name() string
+
+	// Header is the byte following Magic in the values compressed by the
+	// compressor. The built-in compressors use 1 to 4 and HeaderRaw is
+	// reserved.
+	Header() byte
+
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// The headers following Magic
+const (
+	// HeaderRaw prefixes the values stored uncompressed that start with
+	// Magic
+	HeaderRaw byte = 0x00
+
+	HeaderGzip   byte = 0x01
+	HeaderSnappy byte = 0x02
+	HeaderZstd   byte = 0x03
+	HeaderLZ4    byte = 0x04
+)
+
+// The built-in compressors
+var (
+	Gzip   Compressor = gzipCompressor{}
+	Snappy Compressor = snappyCompressor{}
+	Zstd   Compressor = zstdCompressor{}
+	LZ4    Compressor = lz4Compressor{}
+)
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Header() byte { return HeaderGzip }
+
+func (gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string { return "snappy" }
+
+func (snappyCompressor) Header() byte { return HeaderSnappy }
+
+func (snappyCompressor) Compress(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (snappyCompressor) Decompress(src []byte) ([]byte, error) {
+	return snappy.Decode(nil, src)
+}
+
+// The zstd encoder and decoder are safe for concurrent use with EncodeAll
+// and DecodeAll
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string { return "zstd" }
+
+func (zstdCompressor) Header() byte { return HeaderZstd }
+
+func (zstdCompressor) Compress(src []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(src, nil), nil
+}
+
+func (zstdCompressor) Decompress(src []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(src, nil)
+}
+
+type lz4Compressor struct{}
+
+func (lz4Compressor) Name() string { return "lz4" }
+
+func (lz4Compressor) Header() byte { return HeaderLZ4 }
+
+func (lz4Compressor) Compress(src []byte) ([]byte, error) {
+	return lz4.Encode(nil, src)
+}
+
+func (lz4Compressor) Decompress(src []byte) ([]byte, error) {
+	return lz4.Decode(nil, src)
+}
@@ -0,0 +1,504 @@
+// Package conformance is a test suite checking that every version wrapper
+// produces the same results, spans, stats and option handling for each command.
+//
+// Each version runs the suite from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(addr string, options ...ocredis.TraceOption) interface{} {
+//			return v4.Wrap(redis.NewClient(&redis.Options{Addr: addr}), options...)
+//		}, "ExpireAt", "HSet", "HGet", "HLen")
+//	}
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	"go.opencensus.io/trace"
+)
+
+// Factory returns a wrapped client connected to addr using the given options
+type Factory func(addr string, options ...ocredis.TraceOption) interface{}
+
+// instanceName is used by every client created by the suite
+const instanceName = "conformance"
+
+// evalScript is the script run by the Eval and scripting cases. The fake
+// server can't run lua so a stub returning "ok" is registered for it.
+const evalScript = "return 'ok'"
+
+// testCase exercises a single command. call returns false when the client
+// doesn't support the command.
+type testCase struct {
+	name   string
+	option func(bool) ocredis.TraceOption
+	setup  func(s *redistest.Server)
+	call   func(ctx context.Context, c interface{}) (ocredis.Cmd, bool)
+	want   interface{}
+}
+
+// method is the name used for the span and the GoRedisMethod tag
+func (tc testCase) method() string {
+	return "go.redis." + tc.lowerName()
+}
+
+func (tc testCase) lowerName() string {
+	b := []byte(tc.name)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+var cases = []testCase{
+	{
+		name:   "Get",
+		option: ocredis.WithGet,
+		setup:  func(s *redistest.Server) { s.Set("key", "value") },
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Get(context.Context, string) ocredis.StringCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Get(ctx, "key"), true
+		},
+		want: "value",
+	},
+	{
+		name:   "Set",
+		option: ocredis.WithSet,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Set(context.Context, string, interface{}, time.Duration) ocredis.StatusCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Set(ctx, "key", "value", time.Minute), true
+		},
+		want: "OK",
+	},
+	{
+		name:   "Incr",
+		option: ocredis.WithIncr,
+		setup:  func(s *redistest.Server) { s.Set("key", "41") },
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Incr(context.Context, string) ocredis.IntCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Incr(ctx, "key"), true
+		},
+		want: int64(42),
+	},
+	{
+		name:   "Ping",
+		option: ocredis.WithPing,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Ping(context.Context) ocredis.StatusCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Ping(ctx), true
+		},
+		want: "PONG",
+	},
+	{
+		name:   "Info",
+		option: ocredis.WithInfo,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(ocredis.InfoGetter)
+			if !ok {
+				return nil, false
+			}
+			return g.Info(ctx, "replication"), true
+		},
+		want: "# Replication\r\nrole:master\r\nconnected_slaves:0\r\n",
+	},
+	{
+		name:   "Del",
+		option: ocredis.WithDel,
+		setup: func(s *redistest.Server) {
+			s.Set("a", "1")
+			s.Set("b", "2")
+		},
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Del(context.Context, ...string) ocredis.IntCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Del(ctx, "a", "b", "c"), true
+		},
+		want: int64(2),
+	},
+	{
+		name:   "SetNX",
+		option: ocredis.WithSetNX,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				SetNX(context.Context, string, interface{}, time.Duration) ocredis.BoolCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.SetNX(ctx, "key", "value", time.Minute), true
+		},
+		want: true,
+	},
+	{
+		name:   "Expire",
+		option: ocredis.WithExpire,
+		setup:  func(s *redistest.Server) { s.Set("key", "value") },
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Expire(context.Context, string, time.Duration) ocredis.BoolCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Expire(ctx, "key", time.Minute), true
+		},
+		want: true,
+	},
+	{
+		name:   "ExpireAt",
+		option: ocredis.WithExpireAt,
+		setup:  func(s *redistest.Server) { s.Set("key", "value") },
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				ExpireAt(context.Context, string, time.Time) ocredis.BoolCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.ExpireAt(ctx, "key", time.Now().Add(time.Hour)), true
+		},
+		want: true,
+	},
+	{
+		name:   "HSet",
+		option: ocredis.WithHSet,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				HSet(context.Context, string, string, interface{}) ocredis.BoolCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.HSet(ctx, "hash", "field", "value"), true
+		},
+		want: true,
+	},
+	{
+		name:   "HGet",
+		option: ocredis.WithHGet,
+		setup:  hashSetup,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				HGet(context.Context, string, string) ocredis.StringCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.HGet(ctx, "hash", "field"), true
+		},
+		want: "value",
+	},
+	{
+		name:   "HLen",
+		option: ocredis.WithHLen,
+		setup:  hashSetup,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				HLen(context.Context, string) ocredis.IntCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.HLen(ctx, "hash"), true
+		},
+		want: int64(1),
+	},
+	{
+		name:   "LPop",
+		option: ocredis.WithLPop,
+		setup:  listSetup,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				LPop(context.Context, string) ocredis.StringCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.LPop(ctx, "list"), true
+		},
+		want: "first",
+	},
+	{
+		name:   "Eval",
+		option: ocredis.WithEval,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Eval(context.Context, string, []string, []string) ocredis.RedisCmd
+			})
+			if !ok {
+				return nil, false
+			}
+			return g.Eval(ctx, evalScript, []string{"key"}, []string{"arg"}), true
+		},
+		want: "ok",
+	},
+	{
+		name:   "EvalSha",
+		option: ocredis.WithEvalSha,
+		setup:  scriptSetup,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(ocredis.Scripter)
+			if !ok {
+				return nil, false
+			}
+			return g.EvalSha(ctx, ocredis.NewScript("", evalScript).Hash(), []string{"key"}, []string{"arg"}), true
+		},
+		want: "ok",
+	},
+	{
+		name:   "ScriptExists",
+		option: ocredis.WithScriptExists,
+		setup:  scriptSetup,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(ocredis.Scripter)
+			if !ok {
+				return nil, false
+			}
+			return g.ScriptExists(ctx, ocredis.NewScript("", evalScript).Hash()), true
+		},
+		want: []bool{true},
+	},
+	{
+		name:   "ScriptLoad",
+		option: ocredis.WithScriptLoad,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(ocredis.Scripter)
+			if !ok {
+				return nil, false
+			}
+			return g.ScriptLoad(ctx, evalScript), true
+		},
+		want: ocredis.NewScript("", evalScript).Hash(),
+	},
+	{
+		name:   "ScriptFlush",
+		option: ocredis.WithScriptFlush,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(ocredis.Scripter)
+			if !ok {
+				return nil, false
+			}
+			return g.ScriptFlush(ctx), true
+		},
+		want: "OK",
+	},
+	{
+		name:   "Close",
+		option: ocredis.WithClose,
+		call: func(ctx context.Context, c interface{}) (ocredis.Cmd, bool) {
+			g, ok := c.(interface {
+				Close(context.Context) error
+			})
+			if !ok {
+				return nil, false
+			}
+			err := g.Close(ctx)
+			return ocredis.NewStatusResult("", err), true
+		},
+		want: "",
+	},
+}
+
+func hashSetup(s *redistest.Server) {
+	_, _ = s.Do("HSET", "hash", "field", "value")
+}
+
+func listSetup(s *redistest.Server) {
+	_, _ = s.Do("RPUSH", "list", "first", "second")
+}
+
+func scriptSetup(s *redistest.Server) {
+	_, _ = s.Do("SCRIPT", "LOAD", evalScript)
+}
+
+// Run runs the suite against the clients returned by newClient. unimplemented
+// lists the names of the cases of the commands the client doesn't provide,
+// such as "Incr", "Expire" and "LPop" for the v5 wrapper. Their cases are
+// skipped, while a command missing from the client but not listed fails, as
+// does a listed command the client implements, so the gaps between versions
+// are kept explicit. Clients implementing Close(context.Context) error are
+// closed once used.
+func Run(t *testing.T, newClient Factory, unimplemented ...string) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	defer s.Close()
+	s.RegisterScript(evalScript, func(keys, args []string) (interface{}, error) {
+		return "ok", nil
+	})
+
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("registering exporter: %v", err)
+	}
+	defer e.Unregister()
+
+	gaps := map[string]bool{}
+	for _, name := range unimplemented {
+		gaps[name] = true
+	}
+	for _, tc := range cases {
+		delete(gaps, tc.name)
+	}
+	for name := range gaps {
+		t.Errorf("%s is listed as not implemented but has no case", name)
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			probe := newClient(s.Addr())
+			_, ok := tc.call(context.Background(), probe)
+			closeClient(probe)
+			switch gap := contains(unimplemented, tc.name); {
+			case gap && ok:
+				t.Fatalf("%s is listed as not implemented but the client implements it", tc.name)
+			case gap:
+				t.Skipf("%s is not implemented", tc.name)
+			case !ok:
+				t.Fatalf("%s is not implemented and isn't listed as a gap of the client", tc.name)
+			}
+			t.Run("Result", func(t *testing.T) {
+				runResult(t, s, e, newClient, tc)
+			})
+			t.Run("Options", func(t *testing.T) {
+				runOptions(t, s, e, newClient, tc)
+			})
+		})
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reset clears the server and the recorded telemetry before each run
+func reset(s *redistest.Server, e *octest.Exporter, tc testCase) {
+	s.FlushAll()
+	_, _ = s.Do("SCRIPT", "FLUSH")
+	e.Reset()
+	if tc.setup != nil {
+		tc.setup(s)
+	}
+}
+
+// runResult checks the result, span and stats of a traced call
+func runResult(t *testing.T, s *redistest.Server, e *octest.Exporter, newClient Factory, tc testCase) {
+	reset(s, e, tc)
+	c := newClient(s.Addr(),
+		tc.option(true),
+		ocredis.WithAllowRoot(true),
+		ocredis.WithInstanceName(instanceName),
+	)
+	defer closeClient(c)
+	cmd, _ := tc.call(context.Background(), c)
+	if err := cmd.Err(); err != nil {
+		t.Fatalf("%s returned error: %v", tc.name, err)
+	}
+	if got := value(cmd); !reflect.DeepEqual(got, tc.want) {
+		t.Errorf("%s = %#v, want %#v", tc.name, got, tc.want)
+	}
+	e.AssertSpan(t, tc.method(), map[string]interface{}{
+		"cache.instance": instanceName,
+	}, trace.StatusCodeOK)
+	e.AssertCallCount(t, instanceName, tc.method(), "OK", 1)
+}
+
+// runOptions checks the command is only traced when its option is enabled
+func runOptions(t *testing.T, s *redistest.Server, e *octest.Exporter, newClient Factory, tc testCase) {
+	for _, o := range []struct {
+		name    string
+		options []ocredis.TraceOption
+		traced  bool
+	}{
+		{"Default", nil, false},
+		{"Disabled", []ocredis.TraceOption{tc.option(false)}, false},
+		{"Enabled", []ocredis.TraceOption{tc.option(true)}, true},
+		{"AllTraceOptions", []ocredis.TraceOption{ocredis.WithAllTraceOptions()}, true},
+		{"WithCommands", []ocredis.TraceOption{ocredis.WithCommands(tc.lowerName())}, true},
+		{"WithoutCommands", []ocredis.TraceOption{ocredis.WithAllTraceOptions(), ocredis.WithoutCommands(tc.lowerName())}, false},
+	} {
+		reset(s, e, tc)
+		options := append([]ocredis.TraceOption{
+			ocredis.WithAllowRoot(true),
+			ocredis.WithInstanceName(instanceName),
+		}, o.options...)
+		c := newClient(s.Addr(), options...)
+		_, ok := tc.call(context.Background(), c)
+		closeClient(c)
+		if !ok {
+			t.Fatalf("%s is not implemented", tc.name)
+		}
+		if o.traced {
+			e.AssertSpan(t, tc.method(), nil, trace.StatusCodeOK)
+		} else {
+			e.AssertNoSpan(t, tc.method())
+		}
+		// Stats are recorded whether or not the call is traced
+		e.AssertCallCount(t, instanceName, tc.method(), "OK", 1)
+	}
+
+	// Without a parent span and AllowRoot the call is never traced
+	reset(s, e, tc)
+	c := newClient(s.Addr(), tc.option(true))
+	tc.call(context.Background(), c)
+	closeClient(c)
+	e.AssertNoSpan(t, tc.method())
+}
+
+// closeClient closes the client when it can be closed. Clients closed by the
+// Close case return an error which is ignored.
+func closeClient(c interface{}) {
+	if closer, ok := c.(interface {
+		Close(context.Context) error
+	}); ok {
+		_ = closer.Close(context.Background())
+	}
+}
+
+// value returns the value held by a command
+func value(cmd ocredis.Cmd) interface{} {
+	v := reflect.ValueOf(cmd).MethodByName("Val")
+	if !v.IsValid() {
+		panic(fmt.Sprintf("conformance: %T has no Val method", cmd))
+	}
+	return v.Call(nil)[0].Interface()
+}
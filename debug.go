@@ -0,0 +1,578 @@
+package ocredis
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+)
+
+// The number of calls, errors and spans kept for each instance by the debug
+// handler
+const (
+	debugRecentCalls  = 50
+	debugRecentErrors = 50
+	debugSlowestSpans = 10
+)
+
+// PoolStats holds the connection pool stats of a client
+type PoolStats struct {
+	Requests   uint32 `json:"requests"`
+	Hits       uint32 `json:"hits"`
+	Waits      uint32 `json:"waits"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	FreeConns  uint32 `json:"free_conns"`
+}
+
+func (s *PoolStats) add(o PoolStats) {
+	s.Requests += o.Requests
+	s.Hits += o.Hits
+	s.Waits += o.Waits
+	s.Timeouts += o.Timeouts
+	s.TotalConns += o.TotalConns
+	s.FreeConns += o.FreeConns
+}
+
+// Instance gives access to the client of a wrapper
+type Instance struct {
+	// PoolStats returns the connection pool stats of the client, it's nil
+	// when the client has no pool
+	PoolStats func() PoolStats
+
+	// Ping pings the server without instrumentation
+	Ping func() error
+}
+
+// debugInstance holds what the debug handler shows about an instance
+type debugInstance struct {
+	mu         sync.Mutex
+	registered []*registeredInstance
+	calls      []DebugCall
+	errors     []DebugCall
+	spans      []*trace.SpanData
+}
+
+// registeredInstance is a wrapper registered with RegisterInstance
+type registeredInstance struct {
+	options  TraceOptions
+	instance Instance
+
+	// shown is set once the wrapper is shown by the debug handler, closed
+	// once it's unregistered. They're guarded by the debugState lock.
+	shown  int32
+	closed bool
+}
+
+var debugState = struct {
+	sync.RWMutex
+	instances map[string]*debugInstance
+
+	// enabled is set once a debug handler is created, wrappers aren't shown
+	// and calls aren't kept before that
+	enabled  int32
+	exporter sync.Once
+}{
+	instances: map[string]*debugInstance{},
+}
+
+// RegisterInstance gives the circuit breaker of the options access to the
+// client of the wrapper and makes the wrapper visible in the debug handler.
+// The wrappers register themselves when created and unregister when closed.
+//
+// Wrappers are only kept by the debug handler once one exists: the wrappers
+// created before it are shown from their first call after it's created, so
+// wrappers are never kept alive when no debug handler is used. Wrappers
+// sharing an instance name are shown together, each keeps its own client.
+func RegisterInstance(options *TraceOptions, instance Instance) {
+	r := &registeredInstance{instance: instance}
+	options.instance = r
+	r.options = *options
+	if atomic.LoadInt32(&debugState.enabled) == 1 {
+		r.show()
+	}
+}
+
+// show adds the wrapper to the debug handler unless it's shown already or
+// was unregistered
+func (r *registeredInstance) show() {
+	if atomic.LoadInt32(&r.shown) == 1 {
+		return
+	}
+	debugState.Lock()
+	defer debugState.Unlock()
+	if atomic.LoadInt32(&r.shown) == 1 || r.closed {
+		return
+	}
+	name := r.options.InstanceName
+	d, ok := debugState.instances[name]
+	if !ok {
+		d = &debugInstance{}
+		debugState.instances[name] = d
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.registered = append(d.registered, r)
+	atomic.StoreInt32(&r.shown, 1)
+}
+
+// UnregisterInstance removes the wrapper with the options from the debug
+// handler. The instance is no longer shown once its last wrapper is
+// unregistered.
+func UnregisterInstance(options TraceOptions) {
+	r := options.instance
+	if r == nil {
+		return
+	}
+	debugState.Lock()
+	defer debugState.Unlock()
+	r.closed = true
+	if atomic.LoadInt32(&r.shown) == 0 {
+		return
+	}
+	d, ok := debugState.instances[options.InstanceName]
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, registered := range d.registered {
+		if registered == r {
+			d.registered = append(d.registered[:i:i], d.registered[i+1:]...)
+			break
+		}
+	}
+	if len(d.registered) == 0 {
+		delete(debugState.instances, options.InstanceName)
+	}
+}
+
+// ping returns the Ping of the client the options were registered with, or
+// nil when they weren't registered
+func (o TraceOptions) ping() func() error {
+	if o.instance == nil {
+		return nil
+	}
+	return o.instance.instance.Ping
+}
+
+func lookupInstance(name string) *debugInstance {
+	debugState.RLock()
+	defer debugState.RUnlock()
+	return debugState.instances[name]
+}
+
+// DebugCall is a call shown by the debug handler
+type DebugCall struct {
+	Time    time.Time     `json:"time"`
+	Method  string        `json:"method"`
+	Args    []string      `json:"args"`
+	Latency time.Duration `json:"latency"`
+	Status  string        `json:"status"`
+	Err     string        `json:"error,omitempty"`
+	TraceID string        `json:"trace_id,omitempty"`
+}
+
+// recordDebug keeps the call for the debug handler of its instance
+func (c *Call) recordDebug(err error, latency time.Duration) {
+	if atomic.LoadInt32(&debugState.enabled) == 0 {
+		return
+	}
+	if r := c.options.instance; r != nil {
+		r.show()
+	}
+	d := lookupInstance(c.options.InstanceName)
+	if d == nil {
+		return
+	}
+	call := DebugCall{
+		Time:    c.start,
+		Method:  scriptName(c.ctx, MethodPrefix+c.command),
+		Args:    c.sanitizedArgs(),
+		Latency: latency,
+		Status:  statusOK,
+	}
+	call.TraceID, _ = c.spanIDs()
+	failed := err != nil && !IsNil(err)
+	if failed {
+		call.Status = statusError
+		call.Err = err.Error()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = appendRecent(d.calls, call, debugRecentCalls)
+	if failed {
+		d.errors = appendRecent(d.errors, call, debugRecentErrors)
+	}
+}
+
+// appendRecent appends the call, dropping the oldest calls beyond max
+func appendRecent(calls []DebugCall, call DebugCall, max int) []DebugCall {
+	calls = append(calls, call)
+	if len(calls) > max {
+		calls = calls[len(calls)-max:]
+	}
+	return calls
+}
+
+// debugExporter keeps the slowest sampled spans of each instance
+type debugExporter struct{}
+
+// ExportSpan keeps the span when it's one of the slowest of its instance.
+// Only the spans of registered commands are kept, not those of retry
+// attempts or of the helpers built on the wrappers.
+func (debugExporter) ExportSpan(s *trace.SpanData) {
+	if !strings.HasPrefix(s.Name, MethodPrefix) {
+		return
+	}
+	// the span names of scripts end with the script name
+	command := strings.SplitN(commandName(s.Name), ".", 2)[0]
+	if _, ok := LookupCommand(command); !ok {
+		return
+	}
+	name := DefaultInstanceName
+	if instance, ok := s.Attributes["cache.instance"].(string); ok {
+		name = instance
+	}
+	d := lookupInstance(name)
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.spans = append(d.spans, s)
+	sort.Slice(d.spans, func(i, j int) bool {
+		return spanLatency(d.spans[i]) > spanLatency(d.spans[j])
+	})
+	if len(d.spans) > debugSlowestSpans {
+		d.spans = d.spans[:debugSlowestSpans]
+	}
+}
+
+func spanLatency(s *trace.SpanData) time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// DebugHandler returns a handler showing, for each wrapped instance, the
+// options in effect, the recent calls and errors, the pool stats and the
+// slowest sampled spans, along with latency percentiles by method from the
+// GoRedisLatencyView when it's registered. The view isn't tagged by instance
+// so the percentiles are those of every instance of the process. Wrappers,
+// calls and spans are only kept once the handler is created. Append
+// ?format=json for a JSON response.
+//
+// Arguments are sanitized but keys are shown, so the handler should only be
+// served on a debug port.
+func DebugHandler() http.Handler {
+	atomic.StoreInt32(&debugState.enabled, 1)
+	debugState.exporter.Do(func() {
+		trace.RegisterExporter(debugExporter{})
+	})
+	return http.HandlerFunc(serveDebug)
+}
+
+// DebugPage is the content of the debug handler
+type DebugPage struct {
+	Instances []DebugInstance `json:"instances"`
+
+	// Latency holds the latency percentiles by method of every instance of
+	// the process, the GoRedisLatencyView isn't tagged by instance. It's
+	// empty when the view isn't registered.
+	Latency []DebugLatency `json:"latency"`
+}
+
+// DebugInstance is what the debug handler shows about an instance
+type DebugInstance struct {
+	Name         string            `json:"name"`
+	Options      map[string]string `json:"options"`
+	Traced       []string          `json:"traced"`
+	PoolStats    *PoolStats        `json:"pool_stats,omitempty"`
+	RecentCalls  []DebugCall       `json:"recent_calls"`
+	RecentErrors []DebugCall       `json:"recent_errors"`
+	SlowestSpans []DebugSpan       `json:"slowest_spans"`
+}
+
+// DebugSpan is a sampled span shown by the debug handler
+type DebugSpan struct {
+	Name    string        `json:"name"`
+	TraceID string        `json:"trace_id"`
+	SpanID  string        `json:"span_id"`
+	Start   time.Time     `json:"start"`
+	Latency time.Duration `json:"latency"`
+	Status  string        `json:"status"`
+}
+
+// DebugLatency holds the latency percentiles of a method in milliseconds
+type DebugLatency struct {
+	Method string  `json:"method"`
+	Status string  `json:"status"`
+	Count  int64   `json:"count"`
+	Mean   float64 `json:"mean"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+}
+
+// NewDebugPage returns the current content of the debug handler
+func NewDebugPage() DebugPage {
+	debugState.RLock()
+	names := make([]string, 0, len(debugState.instances))
+	for name := range debugState.instances {
+		names = append(names, name)
+	}
+	debugState.RUnlock()
+	sort.Strings(names)
+
+	var page DebugPage
+	for _, name := range names {
+		// the instance may have been unregistered meanwhile
+		if d := lookupInstance(name); d != nil {
+			page.Instances = append(page.Instances, d.page(name))
+		}
+	}
+	page.Latency = latencyPercentiles()
+	return page
+}
+
+func (d *debugInstance) page(name string) DebugInstance {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p := DebugInstance{
+		Name:         name,
+		RecentCalls:  reversed(d.calls),
+		RecentErrors: reversed(d.errors),
+	}
+	if len(d.registered) == 0 {
+		return p
+	}
+	// the options of the most recently registered wrapper are shown
+	options := d.registered[len(d.registered)-1].options
+	p.Options = describeOptions(options)
+	for _, c := range Commands() {
+		if options.Traced(c.Name) {
+			p.Traced = append(p.Traced, c.Name)
+		}
+	}
+	// the pools of the wrappers sharing the instance name are added up
+	for _, r := range d.registered {
+		if r.instance.PoolStats == nil {
+			continue
+		}
+		if p.PoolStats == nil {
+			p.PoolStats = &PoolStats{}
+		}
+		p.PoolStats.add(r.instance.PoolStats())
+	}
+	for _, s := range d.spans {
+		p.SlowestSpans = append(p.SlowestSpans, DebugSpan{
+			Name:    s.Name,
+			TraceID: s.TraceID.String(),
+			SpanID:  s.SpanID.String(),
+			Start:   s.StartTime,
+			Latency: spanLatency(s),
+			Status:  s.Status.Message,
+		})
+	}
+	return p
+}
+
+// reversed returns a copy of the calls, most recent first
+func reversed(calls []DebugCall) []DebugCall {
+	out := make([]DebugCall, len(calls))
+	for i, c := range calls {
+		out[len(calls)-1-i] = c
+	}
+	return out
+}
+
+// describeOptions returns the options in effect as strings
+func describeOptions(o TraceOptions) map[string]string {
+	set := func(b bool) string {
+		if b {
+			return "set"
+		}
+		return "unset"
+	}
+	duration := func(d time.Duration) string {
+		if d == 0 {
+			return "disabled"
+		}
+		return d.String()
+	}
+	return map[string]string{
+		"AllowRoot":        set(o.AllowRoot),
+		"Sampler":          set(o.Sampler != nil),
+		"SampleErrors":     set(o.SampleErrors),
+		"SampleSlowerThan": duration(o.SampleSlowerThan),
+		"SlowThreshold":    duration(o.SlowThreshold),
+		"SlowLogger":       set(o.SlowLogger != nil),
+		"Statement":        set(o.Statement),
+		"Logger":           set(o.Logger != nil),
+		"KeyPattern":       set(o.KeyPattern != nil),
+		"KeyAnalyzer":      set(o.KeyAnalyzer != nil),
+		"ArgSanitizer":     set(o.ArgSanitizer != nil),
+		"RetryPolicy":      retries(o.retryPolicy),
+		"CircuitBreaker":   circuit(o.breaker),
+	}
+}
+
+func retries(p *retryPolicy) string {
+	if p == nil || p.MaxAttempts < 2 {
+		return "disabled"
+	}
+	return fmt.Sprintf("%d attempts, %s-%s backoff", p.MaxAttempts, p.MinBackoff, p.MaxBackoff)
+}
+
+func circuit(b *circuitBreaker) string {
+	if b == nil {
+		return "disabled"
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// latencyPercentiles estimates the latency percentiles of each method from
+// the buckets of the GoRedisLatencyView
+func latencyPercentiles() []DebugLatency {
+	rows, err := view.RetrieveData(GoRedisLatencyView.Name)
+	if err != nil {
+		return nil
+	}
+	var latencies []DebugLatency
+	for _, row := range rows {
+		dist, ok := row.Data.(*view.DistributionData)
+		if !ok || dist.Count == 0 {
+			continue
+		}
+		l := DebugLatency{
+			Count: dist.Count,
+			Mean:  dist.Mean,
+			P50:   percentile(dist, GoRedisLatencyView.Aggregation.Buckets, 0.5),
+			P90:   percentile(dist, GoRedisLatencyView.Aggregation.Buckets, 0.9),
+			P99:   percentile(dist, GoRedisLatencyView.Aggregation.Buckets, 0.99),
+		}
+		for _, t := range row.Tags {
+			switch t.Key {
+			case GoRedisMethod:
+				l.Method = t.Value
+			case GoRedisStatus:
+				l.Status = t.Value
+			}
+		}
+		latencies = append(latencies, l)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		if latencies[i].Method != latencies[j].Method {
+			return latencies[i].Method < latencies[j].Method
+		}
+		return latencies[i].Status < latencies[j].Status
+	})
+	return latencies
+}
+
+// percentile estimates the q quantile of the distribution by interpolating
+// within the bucket holding it
+func percentile(dist *view.DistributionData, bounds []float64, q float64) float64 {
+	rank := q * float64(dist.Count)
+	var seen float64
+	for i, count := range dist.CountPerBucket {
+		if count == 0 {
+			continue
+		}
+		if seen+float64(count) < rank {
+			seen += float64(count)
+			continue
+		}
+		lower, upper := dist.Min, dist.Max
+		if i > 0 && bounds[i-1] > lower {
+			lower = bounds[i-1]
+		}
+		if i < len(bounds) && bounds[i] < upper {
+			upper = bounds[i]
+		}
+		if upper < lower {
+			// the distribution only holds zeros, its Max is never set
+			upper = lower
+		}
+		return lower + (upper-lower)*(rank-seen)/float64(count)
+	}
+	return dist.Max
+}
+
+func serveDebug(w http.ResponseWriter, r *http.Request) {
+	page := NewDebugPage()
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = debugTemplate.Execute(w, page)
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>ocredis</title>
+<style>
+body{font-family:monospace}
+table{border-collapse:collapse;margin-bottom:1em}
+td,th{border:1px solid #ccc;padding:2px 6px;text-align:left}
+</style>
+</head>
+<body>
+<h1>ocredis</h1>
+<h2>Latency of every instance (ms)</h2>
+{{if .Latency}}
+<table>
+<tr><th>Method</th><th>Status</th><th>Count</th><th>Mean</th><th>P50</th><th>P90</th><th>P99</th></tr>
+{{range .Latency}}<tr><td>{{.Method}}</td><td>{{.Status}}</td><td>{{.Count}}</td><td>{{printf "%.3f" .Mean}}</td><td>{{printf "%.3f" .P50}}</td><td>{{printf "%.3f" .P90}}</td><td>{{printf "%.3f" .P99}}</td></tr>
+{{end}}</table>
+{{else}}<p>Register GoRedisLatencyView to see the latency percentiles of every instance.</p>{{end}}
+{{range .Instances}}
+<h2>Instance {{.Name}}</h2>
+<h3>Options</h3>
+<table>
+{{range $name, $value := .Options}}<tr><td>{{$name}}</td><td>{{$value}}</td></tr>
+{{end}}<tr><td>Traced</td><td>{{range .Traced}}{{.}} {{end}}</td></tr>
+</table>
+{{with .PoolStats}}
+<h3>Pool</h3>
+<table>
+<tr><th>Requests</th><th>Hits</th><th>Waits</th><th>Timeouts</th><th>Total conns</th><th>Free conns</th></tr>
+<tr><td>{{.Requests}}</td><td>{{.Hits}}</td><td>{{.Waits}}</td><td>{{.Timeouts}}</td><td>{{.TotalConns}}</td><td>{{.FreeConns}}</td></tr>
+</table>
+{{end}}
+<h3>Recent calls</h3>
+<table>
+<tr><th>Time</th><th>Method</th><th>Args</th><th>Latency</th><th>Status</th><th>Trace</th></tr>
+{{range .RecentCalls}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td>{{range .Args}}{{.}} {{end}}</td><td>{{.Latency}}</td><td>{{.Status}}</td><td>{{.TraceID}}</td></tr>
+{{end}}</table>
+<h3>Recent errors</h3>
+<table>
+<tr><th>Time</th><th>Method</th><th>Args</th><th>Latency</th><th>Error</th><th>Trace</th></tr>
+{{range .RecentErrors}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td>{{range .Args}}{{.}} {{end}}</td><td>{{.Latency}}</td><td>{{.Err}}</td><td>{{.TraceID}}</td></tr>
+{{end}}</table>
+<h3>Slowest sampled spans</h3>
+<table>
+<tr><th>Start</th><th>Name</th><th>Latency</th><th>Status</th><th>Trace</th><th>Span</th></tr>
+{{range .SlowestSpans}}<tr><td>{{.Start.Format "15:04:05.000"}}</td><td>{{.Name}}</td><td>{{.Latency}}</td><td>{{.Status}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,60 @@
+package ocredis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegisterInstanceWithoutDebugHandler(t *testing.T) {
+	enabled := atomic.LoadInt32(&debugState.enabled)
+	atomic.StoreInt32(&debugState.enabled, 0)
+	defer atomic.StoreInt32(&debugState.enabled, enabled)
+
+	var pinged bool
+	o := NewTraceOptions(WithInstanceName("debug-lazy"))
+	RegisterInstance(&o, Instance{Ping: func() error {
+		pinged = true
+		return nil
+	}})
+	call := func() {
+		StartCall(context.Background(), o, "get", []string{"key"}).End(NewStringResult("value", nil))
+	}
+	call()
+	if lookupInstance("debug-lazy") != nil {
+		t.Fatal("wrapper kept without a debug handler")
+	}
+	// the breaker still has access to the client
+	if ping := o.ping(); ping == nil || ping() != nil || !pinged {
+		t.Error("ping of the registered client isn't available")
+	}
+
+	// the wrapper is shown from its first call once a handler exists
+	atomic.StoreInt32(&debugState.enabled, 1)
+	if lookupInstance("debug-lazy") != nil {
+		t.Fatal("wrapper shown before its first call")
+	}
+	call()
+	d := lookupInstance("debug-lazy")
+	if d == nil {
+		t.Fatal("wrapper isn't shown after a call")
+	}
+	if n := len(d.page("debug-lazy").RecentCalls); n != 1 {
+		t.Errorf("shown %d recent calls, want 1", n)
+	}
+
+	// a closed wrapper isn't shown again by its later calls
+	UnregisterInstance(o)
+	call()
+	if lookupInstance("debug-lazy") != nil {
+		t.Error("wrapper shown again after it was unregistered")
+	}
+
+	// wrappers created once a handler exists are shown right away
+	created := NewTraceOptions(WithInstanceName("debug-created"))
+	RegisterInstance(&created, Instance{})
+	defer UnregisterInstance(created)
+	if lookupInstance("debug-created") == nil {
+		t.Error("wrapper created after the handler isn't shown")
+	}
+}
@@ -0,0 +1,99 @@
+package ocredis_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v4 "github.com/KolbyMcGarrah/ocredis/v4"
+	redis "gopkg.in/redis.v4"
+)
+
+// debugInstance returns the instance shown by the JSON debug page
+func debugInstance(t *testing.T, name string) (ocredis.DebugInstance, bool) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ocredis.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/redis?format=json", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var page ocredis.DebugPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("decoding debug page: %v", err)
+	}
+	for _, instance := range page.Instances {
+		if instance.Name == name {
+			return instance, true
+		}
+	}
+	return ocredis.DebugInstance{}, false
+}
+
+func TestDebugHandler(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	defer s.Close()
+	s.SetError("incr", "ERR injected")
+	handler := ocredis.DebugHandler()
+
+	newWrapper := func() *v4.Wrapper {
+		return v4.Wrap(redis.NewClient(&redis.Options{Addr: s.Addr()}),
+			ocredis.WithInstanceName("debug"),
+			ocredis.WithGet(true),
+		)
+	}
+	first, second := newWrapper(), newWrapper()
+	ctx := context.Background()
+	first.Set(ctx, "key", "value", 0)
+	second.Incr(ctx, "key")
+
+	instance, ok := debugInstance(t, "debug")
+	if !ok {
+		t.Fatal("instance debug isn't shown")
+	}
+	if n := len(instance.RecentCalls); n != 2 {
+		t.Fatalf("shown %d recent calls, want 2", n)
+	}
+	if c := instance.RecentCalls[0]; c.Method != "go.redis.incr" || c.Status != "ERROR" || c.Err != "ERR injected" {
+		t.Errorf("most recent call = %+v, want the failed incr", c)
+	}
+	if c := instance.RecentCalls[1]; c.Method != "go.redis.set" || strings.Join(c.Args, " ") != "key ? ?" {
+		t.Errorf("first call = %+v, want set with sanitized args", c)
+	}
+	if n := len(instance.RecentErrors); n != 1 {
+		t.Errorf("shown %d recent errors, want 1", n)
+	}
+	if len(instance.Traced) != 1 || instance.Traced[0] != "get" {
+		t.Errorf("traced commands = %v, want [get]", instance.Traced)
+	}
+	if instance.PoolStats == nil || instance.PoolStats.TotalConns != 2 {
+		t.Errorf("pool stats = %+v, want the connections of both wrappers", instance.PoolStats)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/redis", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	for _, want := range []string{"Instance debug", "go.redis.incr", "ERR injected"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("HTML page doesn't contain %q", want)
+		}
+	}
+
+	// the instance is shown until its last wrapper is closed
+	_ = first.Close(ctx)
+	if _, ok := debugInstance(t, "debug"); !ok {
+		t.Error("instance debug isn't shown while a wrapper is open")
+	}
+	_ = second.Close(ctx)
+	if _, ok := debugInstance(t, "debug"); ok {
+		t.Error("instance debug is shown once its wrappers are closed")
+	}
+}
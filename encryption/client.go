@@ -0,0 +1,197 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// Options configures a Client
+type Options struct {
+	Keys KeyProvider
+
+	// BindKey, if set to true, authenticates the name of the redis key, and
+	// the field for hash values, with the value, so a value copied to
+	// another key or field fails to decrypt
+	BindKey bool
+
+	// AllowPlaintext, if set to true, returns the values that aren't
+	// encrypted as they are instead of failing, for instance while the
+	// values stored before encryption was enabled expire
+	AllowPlaintext bool
+}
+
+// Client encrypts the values written with Set, SetNX and HSet and decrypts
+// the values read with Get, HGet and LPop. Each of these calls gets a
+// go.redis.encrypted.<command> span the span of the redis call is a child
+// of. Values that can't be decrypted return an error wrapping
+// ocredis.ErrDecrypt, whose error type is ocredis.ErrorTypeDecrypt.
+//
+// Commands not implemented by the client return
+// ocredis.ErrUnsupportedCommand.
+type Client struct {
+	ocredis.Forwarder
+
+	options Options
+}
+
+var (
+	_ ocredis.Client   = &Client{}
+	_ ocredis.Cmdable  = &Client{}
+	_ ocredis.Scripter = &Client{}
+)
+
+// NewClient returns a client encrypting the values of client. It returns
+// ErrNoKeys when options.Keys is nil.
+func NewClient(client ocredis.Getter, options Options) (*Client, error) {
+	if options.Keys == nil {
+		return nil, ErrNoKeys
+	}
+	return &Client{
+		Forwarder: ocredis.NewForwarder(client),
+		options:   options,
+	}, nil
+}
+
+// startSpan starts the span of the call when the context has a span
+func (c *Client) startSpan(ctx context.Context, command string) (context.Context, *trace.Span) {
+	if !ocredis.AllowTrace(ctx, true, false) {
+		return ctx, nil
+	}
+	return trace.StartSpan(ctx, ocredis.MethodPrefix+"encrypted."+command, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+// end sets the status of the span from the error and ends it
+func (c *Client) end(ctx context.Context, span *trace.Span, command string, err error) {
+	errorType := ocredis.ClassifyError(err)
+	if errorType == ocredis.ErrorTypeDecrypt {
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{
+			tag.Insert(ocredis.GoRedisMethod, ocredis.MethodPrefix+command),
+			tag.Insert(ocredis.GoRedisErrorType, errorType),
+		}, ocredis.MeasureErrors.M(1))
+	}
+	if span == nil {
+		return
+	}
+	if errorType != "" {
+		span.AddAttributes(trace.StringAttribute("redis.error_type", errorType))
+		span.SetStatus(trace.Status{Code: ocredis.ErrorStatusCode(errorType), Message: err.Error()})
+	}
+	span.End()
+}
+
+// aad returns the additional data authenticated with the value of the key,
+// or of the field of the hash when field isn't nil
+func (c *Client) aad(key string, field *string) []byte {
+	if !c.options.BindKey {
+		return nil
+	}
+	return aad(key, field)
+}
+
+// encrypt returns the value to write
+func (c *Client) encrypt(ctx context.Context, span *trace.Span, key string, field *string, value interface{}) ([]byte, error) {
+	var plaintext []byte
+	switch v := value.(type) {
+	case string:
+		plaintext = []byte(v)
+	case []byte:
+		plaintext = v
+	default:
+		return nil, ErrUnsupportedValue
+	}
+	id, k, err := c.options.Keys.CurrentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if span != nil {
+		span.AddAttributes(trace.StringAttribute("redis.encryption.key_id", id))
+	}
+	return seal(id, k, plaintext, c.aad(key, field))
+}
+
+// decrypt returns the command with its value decrypted
+func (c *Client) decrypt(ctx context.Context, span *trace.Span, key string, field *string, cmd ocredis.StringCmd) ocredis.StringCmd {
+	data, err := cmd.Bytes()
+	if err != nil {
+		return cmd
+	}
+	id, err := keyID(data)
+	if err != nil {
+		if err == errPlaintext && c.options.AllowPlaintext {
+			return cmd
+		}
+		return ocredis.NewStringResult("", err)
+	}
+	if span != nil {
+		span.AddAttributes(trace.StringAttribute("redis.encryption.key_id", id))
+	}
+	k, err := c.options.Keys.Key(ctx, id)
+	if err != nil {
+		return ocredis.NewStringResult("", fmt.Errorf("%w: %v", ocredis.ErrDecrypt, err))
+	}
+	plaintext, err := open(k, data, c.aad(key, field))
+	if err != nil {
+		return ocredis.NewStringResult("", err)
+	}
+	return ocredis.NewStringResult(string(plaintext), nil)
+}
+
+// Get runs the redis get command and decrypts the value
+func (c *Client) Get(ctx context.Context, key string) (cmd ocredis.StringCmd) {
+	ctx, span := c.startSpan(ctx, "get")
+	defer func() { c.end(ctx, span, "get", cmd.Err()) }()
+	return c.decrypt(ctx, span, key, nil, c.Forwarder.Get(ctx, key))
+}
+
+// Set encrypts the value and runs the redis set command
+func (c *Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) (cmd ocredis.StatusCmd) {
+	ctx, span := c.startSpan(ctx, "set")
+	defer func() { c.end(ctx, span, "set", cmd.Err()) }()
+	data, err := c.encrypt(ctx, span, key, nil, value)
+	if err != nil {
+		return ocredis.NewStatusResult("", err)
+	}
+	return c.Forwarder.Set(ctx, key, data, expiration)
+}
+
+// SetNX encrypts the value and runs the redis setnx command
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (cmd ocredis.BoolCmd) {
+	ctx, span := c.startSpan(ctx, "setnx")
+	defer func() { c.end(ctx, span, "setnx", cmd.Err()) }()
+	data, err := c.encrypt(ctx, span, key, nil, value)
+	if err != nil {
+		return ocredis.NewBoolResult(false, err)
+	}
+	return c.Forwarder.SetNX(ctx, key, data, expiration)
+}
+
+// LPop runs the redis lpop command and decrypts the value
+func (c *Client) LPop(ctx context.Context, key string) (cmd ocredis.StringCmd) {
+	ctx, span := c.startSpan(ctx, "lpop")
+	defer func() { c.end(ctx, span, "lpop", cmd.Err()) }()
+	return c.decrypt(ctx, span, key, nil, c.Forwarder.LPop(ctx, key))
+}
+
+// HGet runs the redis hget command and decrypts the value
+func (c *Client) HGet(ctx context.Context, key, field string) (cmd ocredis.StringCmd) {
+	ctx, span := c.startSpan(ctx, "hget")
+	defer func() { c.end(ctx, span, "hget", cmd.Err()) }()
+	return c.decrypt(ctx, span, key, &field, c.Forwarder.HGet(ctx, key, field))
+}
+
+// HSet encrypts the value and runs the redis hset command
+func (c *Client) HSet(ctx context.Context, key, field string, value interface{}) (cmd ocredis.BoolCmd) {
+	ctx, span := c.startSpan(ctx, "hset")
+	defer func() { c.end(ctx, span, "hset", cmd.Err()) }()
+	data, err := c.encrypt(ctx, span, key, &field, value)
+	if err != nil {
+		return ocredis.NewBoolResult(false, err)
+	}
+	return c.Forwarder.HSet(ctx, key, field, data)
+}
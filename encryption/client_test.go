@@ -0,0 +1,156 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	"github.com/KolbyMcGarrah/ocredis/redistest/v5test"
+	v5 "github.com/KolbyMcGarrah/ocredis/v5"
+)
+
+var testKeys = StaticKeys{
+	Current: "k1",
+	Keys: map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("0123456789abcdef0123456789abcdef"),
+	},
+}
+
+func newTestClient(t *testing.T, options Options) (*redistest.Server, *v5.Wrapper, *Client) {
+	t.Helper()
+	s, w := v5test.NewClient(t)
+	if options.Keys == nil {
+		options.Keys = testKeys
+	}
+	c, err := NewClient(w, options)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return s, w, c
+}
+
+func TestNewClientWithoutKeys(t *testing.T) {
+	if _, err := NewClient(nil, Options{}); err != ErrNoKeys {
+		t.Errorf("NewClient without keys = %v, want ErrNoKeys", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s, _, c := newTestClient(t, Options{BindKey: true})
+	for _, value := range []string{"", "secret", "\x00\xe1binary", strings.Repeat("long ", 1000)} {
+		if err := c.Set(ctx, "key", value, 0).Err(); err != nil {
+			t.Fatalf("Set(%q): %v", value, err)
+		}
+		stored, _ := s.Get("key")
+		if !strings.HasPrefix(stored, magic) || (value != "" && strings.Contains(stored, value)) {
+			t.Errorf("Set(%q) stored %q, want it encrypted", value, stored)
+		}
+		if v, err := c.Get(ctx, "key").Result(); err != nil || v != value {
+			t.Errorf("Get = %q, %v, want %q", v, err, value)
+		}
+		if err := c.HSet(ctx, "hash", "field", []byte(value)).Err(); err != nil {
+			t.Fatalf("HSet(%q): %v", value, err)
+		}
+		if v, err := c.HGet(ctx, "hash", "field").Result(); err != nil || v != value {
+			t.Errorf("HGet = %q, %v, want %q", v, err, value)
+		}
+	}
+	if err := c.Set(ctx, "key", 42, 0).Err(); err != ErrUnsupportedValue {
+		t.Errorf("Set of an int = %v, want ErrUnsupportedValue", err)
+	}
+	if v, err := c.Get(ctx, "missing").Result(); !ocredis.IsNil(err) {
+		t.Errorf("Get of a missing key = %q, %v, want the nil error", v, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	s, w, c := newTestClient(t, Options{})
+	c.Set(ctx, "old", "value", 0)
+
+	keys := testKeys
+	keys.Current = "k2"
+	rotated, err := NewClient(w, Options{Keys: keys})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	rotated.Set(ctx, "new", "value", 0)
+	for _, key := range []string{"old", "new"} {
+		if v, err := rotated.Get(ctx, key).Result(); err != nil || v != "value" {
+			t.Errorf("Get(%s) after the rotation = %q, %v, want value", key, v, err)
+		}
+	}
+	for key, id := range map[string]string{"old": "k1", "new": "k2"} {
+		stored, _ := s.Get(key)
+		if got, err := keyID([]byte(stored)); err != nil || got != id {
+			t.Errorf("%s is encrypted with %q, %v, want %s", key, got, err, id)
+		}
+	}
+
+	// the values of a retired key can't be read
+	retired, _ := NewClient(w, Options{Keys: StaticKeys{Current: "k2", Keys: map[string][]byte{"k2": keys.Keys["k2"]}}})
+	if err := retired.Get(ctx, "old").Err(); !errors.Is(err, ocredis.ErrDecrypt) {
+		t.Errorf("Get with a retired key = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	ctx := context.Background()
+	s, _, c := newTestClient(t, Options{BindKey: true})
+	if err := c.Set(ctx, "key", "secret", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.HSet(ctx, "hash", "a", "secret").Err(); err != nil {
+		t.Fatalf("HSet: %v", err)
+	}
+	stored, _ := s.Get("key")
+	field, _ := s.Do("HGET", "hash", "a")
+
+	tampered := []byte(stored)
+	tampered[len(tampered)-1] ^= 1
+	s.Set("tampered", string(tampered))
+	// a value copied to another key or field
+	s.Set("copy", stored)
+	s.Do("HSET", "hash", "b", field.(string))
+	s.Set("truncated", stored[:len(magic)+3])
+	s.Set("plaintext", "secret")
+
+	for _, key := range []string{"tampered", "copy", "truncated", "plaintext"} {
+		if err := c.Get(ctx, key).Err(); !errors.Is(err, ocredis.ErrDecrypt) {
+			t.Errorf("Get(%s) = %v, want ErrDecrypt", key, err)
+		}
+		if got := ocredis.ClassifyError(c.Get(ctx, key).Err()); got != ocredis.ErrorTypeDecrypt {
+			t.Errorf("error type of Get(%s) = %q, want %q", key, got, ocredis.ErrorTypeDecrypt)
+		}
+	}
+	if err := c.HGet(ctx, "hash", "b").Err(); !errors.Is(err, ocredis.ErrDecrypt) {
+		t.Errorf("HGet of a value copied to another field = %v, want ErrDecrypt", err)
+	}
+	if v, err := c.HGet(ctx, "hash", "a").Result(); err != nil || v != "secret" {
+		t.Errorf("HGet = %q, %v, want secret", v, err)
+	}
+}
+
+func TestAllowPlaintext(t *testing.T) {
+	ctx := context.Background()
+	s, _, c := newTestClient(t, Options{AllowPlaintext: true})
+	// legacy values, including one starting with the first byte of magic
+	for _, value := range []string{"plaintext", "\xe1", "\xe1\x02id", magic} {
+		s.Set("legacy", value)
+		if v, err := c.Get(ctx, "legacy").Result(); err != nil || v != value {
+			t.Errorf("Get(%q) = %q, %v, want the plaintext", value, v, err)
+		}
+	}
+	// encrypted values that fail to decrypt still fail
+	c.Set(ctx, "key", "secret", 0)
+	stored, _ := s.Get("key")
+	s.Set("key", stored[:len(stored)-1])
+	if err := c.Get(ctx, "key").Err(); !errors.Is(err, ocredis.ErrDecrypt) {
+		t.Errorf("Get of a truncated value = %v, want ErrDecrypt", err)
+	}
+}
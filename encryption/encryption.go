@@ -0,0 +1,139 @@
+// Package encryption encrypts the values stored with a wrapped client using
+// AES-GCM. The ID of the key encrypting a value is stored with it, so keys
+// can be rotated while values encrypted with older keys remain readable.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/KolbyMcGarrah/ocredis"
+)
+
+// Errors returned when encrypting values
+var (
+	ErrUnsupportedValue = errors.New("encryption: only string and []byte values can be encrypted")
+	ErrKeyID            = errors.New("encryption: key ID longer than 255 bytes")
+)
+
+// ErrNoKeys is returned by NewClient when Options has no KeyProvider
+var ErrNoKeys = errors.New("encryption: no key provider")
+
+// magic starts the encrypted values. Values not starting with it are
+// plaintext.
+const magic = "\xe1OCE"
+
+// KeyProvider provides the AES keys, of 16, 24 or 32 bytes
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting new values and its ID
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+
+	// Key returns the key with the ID
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider with a fixed set of keys
+type StaticKeys struct {
+	// Current is the ID of the key encrypting new values
+	Current string
+
+	// Keys are the keys by ID
+	Keys map[string][]byte
+}
+
+// CurrentKey returns the current key
+func (s StaticKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := s.Key(ctx, s.Current)
+	return s.Current, key, err
+}
+
+// Key returns the key with the ID
+func (s StaticKeys) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("encryption: unknown key %q", id)
+	}
+	return key, nil
+}
+
+// seal encrypts the plaintext with the key. The result is magic, the length
+// of the key ID, the key ID, the nonce and the ciphertext.
+func seal(id string, key, plaintext, aad []byte) ([]byte, error) {
+	if len(id) > 255 {
+		return nil, ErrKeyID
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(magic)+1+len(id)+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	out = append(out, magic...)
+	out = append(out, byte(len(id)))
+	out = append(out, id...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, aad), nil
+}
+
+// errPlaintext is wrapped by the error of keyID for values that aren't
+// encrypted
+var errPlaintext = fmt.Errorf("%w: not an encrypted value", ocredis.ErrDecrypt)
+
+// keyID returns the ID of the key that encrypted the data
+func keyID(data []byte) (string, error) {
+	if len(data) <= len(magic) || string(data[:len(magic)]) != magic {
+		return "", errPlaintext
+	}
+	end := len(magic) + 1 + int(data[len(magic)])
+	if len(data) < end {
+		return "", fmt.Errorf("%w: value too short", ocredis.ErrDecrypt)
+	}
+	return string(data[len(magic)+1 : end]), nil
+}
+
+// aad returns the additional data authenticated with the value of the key,
+// or of the field of the hash when field isn't nil
+func aad(key string, field *string) []byte {
+	if field == nil {
+		return []byte(key)
+	}
+	// the length of the key keeps the key and the field apart
+	b := make([]byte, 4, 4+len(key)+len(*field))
+	binary.BigEndian.PutUint32(b, uint32(len(key)))
+	b = append(b, key...)
+	return append(b, *field...)
+}
+
+// open decrypts data sealed with the key
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ocredis.ErrDecrypt, err)
+	}
+	data = data[len(magic)+1+int(data[len(magic)]):]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: value too short", ocredis.ErrDecrypt)
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ocredis.ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,138 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"go.opencensus.io/trace"
+)
+
+// The error types set as GoRedisErrorType tag values. Infrastructure
+// problems such as timeouts and failovers are told apart from errors caused
+// by the application such as WRONGTYPE.
+const (
+	ErrorTypeTimeout     = "timeout"
+	ErrorTypeNetwork     = "network"
+	ErrorTypePoolTimeout = "pool_timeout"
+	ErrorTypeConnRefused = "connection_refused"
+	ErrorTypeClosed      = "closed"
+	ErrorTypeCanceled    = "canceled"
+	ErrorTypeReadOnly    = "readonly"
+	ErrorTypeLoading     = "loading"
+	ErrorTypeMoved       = "moved"
+	ErrorTypeAsk         = "ask"
+	ErrorTypeClusterDown = "clusterdown"
+	ErrorTypeTryAgain    = "tryagain"
+	ErrorTypeOOM         = "oom"
+	ErrorTypeNoScript    = "noscript"
+	ErrorTypeWrongType   = "wrongtype"
+	ErrorTypeBusy        = "busy"
+	ErrorTypeNoAuth      = "noauth"
+	ErrorTypeRedis       = "redis"
+	ErrorTypeDecrypt     = "decrypt"
+	ErrorTypeUnknown     = "unknown"
+)
+
+// ErrDecrypt is wrapped by the errors of values that can't be decrypted, see
+// the encryption package
+var ErrDecrypt = errors.New("ocredis: decryption failed")
+
+// The messages of the errors returned by every supported redis version
+const (
+	poolTimeoutMessage  = "redis: connection pool timeout"
+	clientClosedMessage = "redis: client is closed"
+)
+
+// errorPrefixes maps the prefix of redis error replies to their type
+var errorPrefixes = map[string]string{
+	"READONLY":    ErrorTypeReadOnly,
+	"LOADING":     ErrorTypeLoading,
+	"MOVED":       ErrorTypeMoved,
+	"ASK":         ErrorTypeAsk,
+	"CLUSTERDOWN": ErrorTypeClusterDown,
+	"TRYAGAIN":    ErrorTypeTryAgain,
+	"OOM":         ErrorTypeOOM,
+	"NOSCRIPT":    ErrorTypeNoScript,
+	"WRONGTYPE":   ErrorTypeWrongType,
+	"BUSY":        ErrorTypeBusy,
+	"NOAUTH":      ErrorTypeNoAuth,
+	"ERR":         ErrorTypeRedis,
+}
+
+// ClassifyError returns the type of the error. It returns an empty string
+// for nil errors and for redis.Nil, which isn't a failure.
+func ClassifyError(err error) string {
+	if err == nil || IsNil(err) {
+		return ""
+	}
+	msg := err.Error()
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorTypeCircuitOpen
+	case errors.Is(err, ErrDecrypt):
+		return ErrorTypeDecrypt
+	case msg == poolTimeoutMessage:
+		return ErrorTypePoolTimeout
+	case msg == clientClosedMessage:
+		return ErrorTypeClosed
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeTimeout
+	case errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(msg, "connection refused"):
+		return ErrorTypeConnRefused
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTypeTimeout
+		}
+		return ErrorTypeNetwork
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "use of closed network connection") {
+		return ErrorTypeNetwork
+	}
+	prefix := msg
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		prefix = msg[:i]
+	}
+	if t, ok := errorPrefixes[prefix]; ok {
+		return t
+	}
+	return ErrorTypeUnknown
+}
+
+// ErrorStatusCode returns the OpenCensus status code of an error type
+func ErrorStatusCode(errorType string) int32 {
+	switch errorType {
+	case "":
+		return trace.StatusCodeOK
+	case ErrorTypeTimeout:
+		return trace.StatusCodeDeadlineExceeded
+	case ErrorTypeCanceled:
+		return trace.StatusCodeCancelled
+	case ErrorTypeNetwork, ErrorTypeConnRefused, ErrorTypeReadOnly, ErrorTypeLoading,
+		ErrorTypeMoved, ErrorTypeAsk, ErrorTypeClusterDown, ErrorTypeTryAgain, ErrorTypeBusy,
+		ErrorTypeCircuitOpen:
+		return trace.StatusCodeUnavailable
+	case ErrorTypePoolTimeout, ErrorTypeOOM:
+		return trace.StatusCodeResourceExhausted
+	case ErrorTypeClosed:
+		return trace.StatusCodeFailedPrecondition
+	case ErrorTypeNoScript:
+		return trace.StatusCodeNotFound
+	case ErrorTypeWrongType, ErrorTypeRedis:
+		return trace.StatusCodeInvalidArgument
+	case ErrorTypeNoAuth:
+		return trace.StatusCodeUnauthenticated
+	case ErrorTypeDecrypt:
+		return trace.StatusCodeDataLoss
+	}
+	return trace.StatusCodeUnknown
+}
@@ -0,0 +1,64 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+// timeoutError is a net.Error timing out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		errorType string
+		code      int32
+	}{
+		{nil, "", trace.StatusCodeOK},
+		{errors.New("redis: nil"), "", trace.StatusCodeOK},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), ErrorTypeTimeout, trace.StatusCodeDeadlineExceeded},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, ErrorTypeTimeout, trace.StatusCodeDeadlineExceeded},
+		{context.Canceled, ErrorTypeCanceled, trace.StatusCodeCancelled},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ErrorTypeConnRefused, trace.StatusCodeUnavailable},
+		{&net.OpError{Op: "write", Err: errors.New("broken")}, ErrorTypeNetwork, trace.StatusCodeUnavailable},
+		{io.EOF, ErrorTypeNetwork, trace.StatusCodeUnavailable},
+		{errors.New("read tcp: connection reset by peer"), ErrorTypeNetwork, trace.StatusCodeUnavailable},
+		{errors.New("redis: connection pool timeout"), ErrorTypePoolTimeout, trace.StatusCodeResourceExhausted},
+		{errors.New("redis: client is closed"), ErrorTypeClosed, trace.StatusCodeFailedPrecondition},
+		{ErrCircuitOpen, ErrorTypeCircuitOpen, trace.StatusCodeUnavailable},
+		{fmt.Errorf("%w: bad tag", ErrDecrypt), ErrorTypeDecrypt, trace.StatusCodeDataLoss},
+		{errors.New("READONLY You can't write against a read only replica."), ErrorTypeReadOnly, trace.StatusCodeUnavailable},
+		{errors.New("LOADING Redis is loading the dataset in memory"), ErrorTypeLoading, trace.StatusCodeUnavailable},
+		{errors.New("MOVED 3999 127.0.0.1:6381"), ErrorTypeMoved, trace.StatusCodeUnavailable},
+		{errors.New("ASK 3999 127.0.0.1:6381"), ErrorTypeAsk, trace.StatusCodeUnavailable},
+		{errors.New("CLUSTERDOWN The cluster is down"), ErrorTypeClusterDown, trace.StatusCodeUnavailable},
+		{errors.New("TRYAGAIN Multiple keys request during rehashing of slot"), ErrorTypeTryAgain, trace.StatusCodeUnavailable},
+		{errors.New("BUSY Redis is busy running a script."), ErrorTypeBusy, trace.StatusCodeUnavailable},
+		{errors.New("OOM command not allowed when used memory > 'maxmemory'."), ErrorTypeOOM, trace.StatusCodeResourceExhausted},
+		{errors.New("NOSCRIPT No matching script. Please use EVAL."), ErrorTypeNoScript, trace.StatusCodeNotFound},
+		{errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), ErrorTypeWrongType, trace.StatusCodeInvalidArgument},
+		{errors.New("ERR unknown command 'foo'"), ErrorTypeRedis, trace.StatusCodeInvalidArgument},
+		{errors.New("NOAUTH Authentication required."), ErrorTypeNoAuth, trace.StatusCodeUnauthenticated},
+		{errors.New("something else"), ErrorTypeUnknown, trace.StatusCodeUnknown},
+	} {
+		errorType := ClassifyError(tc.err)
+		if errorType != tc.errorType {
+			t.Errorf("ClassifyError(%v) = %q, want %q", tc.err, errorType, tc.errorType)
+		}
+		if code := ErrorStatusCode(errorType); code != tc.code {
+			t.Errorf("ErrorStatusCode(%q) = %d, want %d", errorType, code, tc.code)
+		}
+	}
+}
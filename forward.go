@@ -0,0 +1,283 @@
+package ocredis
+
+import (
+	"context"
+	"time"
+)
+
+// Forwarder implements the commands of Client, Cmdable and Scripter by
+// forwarding them to a client. Commands the client doesn't implement return
+// ErrUnsupportedCommand. The layers built on the wrappers, such as Router and
+// NearCache, embed it and only override the commands they change.
+type Forwarder struct {
+	target func(ctx context.Context, command string) (context.Context, Getter)
+
+	// client is the client of a Forwarder returned by NewForwarder
+	client Getter
+}
+
+var (
+	_ Client   = Forwarder{}
+	_ Cmdable  = Forwarder{}
+	_ Scripter = Forwarder{}
+)
+
+// NewForwarder returns a Forwarder forwarding every command to client
+func NewForwarder(client Getter) Forwarder {
+	return Forwarder{
+		target: func(ctx context.Context, command string) (context.Context, Getter) {
+			return ctx, client
+		},
+		client: client,
+	}
+}
+
+// InstanceName returns the instance name of the client of a Forwarder
+// returned by NewForwarder, see InstanceName, and DefaultInstanceName
+// otherwise
+func (f Forwarder) InstanceName() string {
+	if f.client == nil {
+		return DefaultInstanceName
+	}
+	return InstanceName(f.client)
+}
+
+// InstanceNamer is implemented by the clients knowing the instance name of
+// the wrapper running their calls, such as the wrappers and the layers built
+// on a single client
+type InstanceNamer interface {
+	InstanceName() string
+}
+
+// InstanceName returns the instance name of client, DefaultInstanceName when
+// it doesn't implement InstanceNamer
+func InstanceName(client Getter) string {
+	if n, ok := client.(InstanceNamer); ok {
+		return n.InstanceName()
+	}
+	return DefaultInstanceName
+}
+
+// CircuitState returns the state of the circuit breaker of the client of a
+// Forwarder returned by NewForwarder, see CircuitState, and false otherwise
+func (f Forwarder) CircuitState() (int, bool) {
+	if f.client == nil {
+		return CircuitClosed, false
+	}
+	return CircuitState(f.client)
+}
+
+// NewRoutingForwarder returns a Forwarder forwarding each command to the
+// client returned by route, with the context it returns. command is the
+// lowercase name of the command in the command registry.
+func NewRoutingForwarder(route func(ctx context.Context, command string) (context.Context, Getter)) Forwarder {
+	return Forwarder{target: route}
+}
+
+// Get forwards the redis get command
+func (f Forwarder) Get(ctx context.Context, key string) StringCmd {
+	ctx, c := f.target(ctx, "get")
+	return c.Get(ctx, key)
+}
+
+// Set forwards the redis set command
+func (f Forwarder) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd {
+	ctx, g := f.target(ctx, "set")
+	c, ok := g.(interface {
+		Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd
+	})
+	if !ok {
+		return NewStatusResult("", ErrUnsupportedCommand)
+	}
+	return c.Set(ctx, key, value, expiration)
+}
+
+// Incr forwards the redis incr command
+func (f Forwarder) Incr(ctx context.Context, key string) IntCmd {
+	ctx, g := f.target(ctx, "incr")
+	c, ok := g.(interface {
+		Incr(ctx context.Context, key string) IntCmd
+	})
+	if !ok {
+		return NewIntResult(0, ErrUnsupportedCommand)
+	}
+	return c.Incr(ctx, key)
+}
+
+// Ping forwards the redis ping command
+func (f Forwarder) Ping(ctx context.Context) StatusCmd {
+	ctx, g := f.target(ctx, "ping")
+	c, ok := g.(interface {
+		Ping(ctx context.Context) StatusCmd
+	})
+	if !ok {
+		return NewStatusResult("", ErrUnsupportedCommand)
+	}
+	return c.Ping(ctx)
+}
+
+// Del forwards the redis del command
+func (f Forwarder) Del(ctx context.Context, keys ...string) IntCmd {
+	ctx, g := f.target(ctx, "del")
+	c, ok := g.(interface {
+		Del(ctx context.Context, keys ...string) IntCmd
+	})
+	if !ok {
+		return NewIntResult(0, ErrUnsupportedCommand)
+	}
+	return c.Del(ctx, keys...)
+}
+
+// SetNX forwards the redis setnx command
+func (f Forwarder) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) BoolCmd {
+	ctx, g := f.target(ctx, "setnx")
+	c, ok := g.(interface {
+		SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) BoolCmd
+	})
+	if !ok {
+		return NewBoolResult(false, ErrUnsupportedCommand)
+	}
+	return c.SetNX(ctx, key, value, expiration)
+}
+
+// Close closes the client
+func (f Forwarder) Close(ctx context.Context) error {
+	ctx, g := f.target(ctx, "close")
+	c, ok := g.(interface {
+		Close(ctx context.Context) error
+	})
+	if !ok {
+		return ErrUnsupportedCommand
+	}
+	return c.Close(ctx)
+}
+
+// LPop forwards the redis lpop command
+func (f Forwarder) LPop(ctx context.Context, key string) StringCmd {
+	ctx, g := f.target(ctx, "lpop")
+	c, ok := g.(interface {
+		LPop(ctx context.Context, key string) StringCmd
+	})
+	if !ok {
+		return NewStringResult("", ErrUnsupportedCommand)
+	}
+	return c.LPop(ctx, key)
+}
+
+// Expire forwards the redis expire command
+func (f Forwarder) Expire(ctx context.Context, key string, expiration time.Duration) BoolCmd {
+	ctx, g := f.target(ctx, "expire")
+	c, ok := g.(interface {
+		Expire(ctx context.Context, key string, expiration time.Duration) BoolCmd
+	})
+	if !ok {
+		return NewBoolResult(false, ErrUnsupportedCommand)
+	}
+	return c.Expire(ctx, key, expiration)
+}
+
+// ExpireAt forwards the redis expireat command
+func (f Forwarder) ExpireAt(ctx context.Context, key string, tm time.Time) BoolCmd {
+	ctx, g := f.target(ctx, "expireat")
+	c, ok := g.(interface {
+		ExpireAt(ctx context.Context, key string, tm time.Time) BoolCmd
+	})
+	if !ok {
+		return NewBoolResult(false, ErrUnsupportedCommand)
+	}
+	return c.ExpireAt(ctx, key, tm)
+}
+
+// HLen forwards the redis hlen command
+func (f Forwarder) HLen(ctx context.Context, key string) IntCmd {
+	ctx, g := f.target(ctx, "hlen")
+	c, ok := g.(interface {
+		HLen(ctx context.Context, key string) IntCmd
+	})
+	if !ok {
+		return NewIntResult(0, ErrUnsupportedCommand)
+	}
+	return c.HLen(ctx, key)
+}
+
+// HGet forwards the redis hget command
+func (f Forwarder) HGet(ctx context.Context, key, field string) StringCmd {
+	ctx, g := f.target(ctx, "hget")
+	c, ok := g.(HashGetter)
+	if !ok {
+		return NewStringResult("", ErrUnsupportedCommand)
+	}
+	return c.HGet(ctx, key, field)
+}
+
+// HSet forwards the redis hset command
+func (f Forwarder) HSet(ctx context.Context, key, field string, value interface{}) BoolCmd {
+	ctx, g := f.target(ctx, "hset")
+	c, ok := g.(interface {
+		HSet(ctx context.Context, key, field string, value interface{}) BoolCmd
+	})
+	if !ok {
+		return NewBoolResult(false, ErrUnsupportedCommand)
+	}
+	return c.HSet(ctx, key, field, value)
+}
+
+// Eval forwards the redis eval command
+func (f Forwarder) Eval(ctx context.Context, script string, keys []string, args []string) RedisCmd {
+	ctx, g := f.target(ctx, "eval")
+	c, ok := g.(interface {
+		Eval(ctx context.Context, script string, keys []string, args []string) RedisCmd
+	})
+	if !ok {
+		return NewCmdResult(nil, ErrUnsupportedCommand)
+	}
+	return c.Eval(ctx, script, keys, args)
+}
+
+// EvalSha forwards the redis evalsha command
+func (f Forwarder) EvalSha(ctx context.Context, sha1 string, keys []string, args []string) RedisCmd {
+	ctx, g := f.target(ctx, "evalsha")
+	c, ok := g.(interface {
+		EvalSha(ctx context.Context, sha1 string, keys []string, args []string) RedisCmd
+	})
+	if !ok {
+		return NewCmdResult(nil, ErrUnsupportedCommand)
+	}
+	return c.EvalSha(ctx, sha1, keys, args)
+}
+
+// ScriptExists forwards the redis script exists command
+func (f Forwarder) ScriptExists(ctx context.Context, scripts ...string) BoolSliceCmd {
+	ctx, g := f.target(ctx, "scriptexists")
+	c, ok := g.(interface {
+		ScriptExists(ctx context.Context, scripts ...string) BoolSliceCmd
+	})
+	if !ok {
+		return NewBoolSliceResult(nil, ErrUnsupportedCommand)
+	}
+	return c.ScriptExists(ctx, scripts...)
+}
+
+// ScriptFlush forwards the redis script flush command
+func (f Forwarder) ScriptFlush(ctx context.Context) StatusCmd {
+	ctx, g := f.target(ctx, "scriptflush")
+	c, ok := g.(interface {
+		ScriptFlush(ctx context.Context) StatusCmd
+	})
+	if !ok {
+		return NewStatusResult("", ErrUnsupportedCommand)
+	}
+	return c.ScriptFlush(ctx)
+}
+
+// ScriptLoad forwards the redis script load command
+func (f Forwarder) ScriptLoad(ctx context.Context, script string) StringCmd {
+	ctx, g := f.target(ctx, "scriptload")
+	c, ok := g.(interface {
+		ScriptLoad(ctx context.Context, script string) StringCmd
+	})
+	if !ok {
+		return NewStringResult("", ErrUnsupportedCommand)
+	}
+	return c.ScriptLoad(ctx, script)
+}
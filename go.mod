@@ -3,18 +3,25 @@ module github.com/KolbyMcGarrah/ocredis
 go 1.15
 
 require (
+	github.com/bkaradzic/go-lz4 v1.0.0
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/garyburd/redigo v1.6.0 // indirect
-	github.com/golang/protobuf v1.3.2 // indirect
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.13.6
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/onsi/ginkgo v1.12.1 // indirect
 	github.com/onsi/gomega v1.10.0 // indirect
+	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	go.opencensus.io v0.22.5
 	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
-	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	google.golang.org/protobuf v1.28.1
 	gopkg.in/bsm/ratelimit.v1 v1.0.0-20160220154919-db14e161995a // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/redis.v3 v3.6.4
 	gopkg.in/redis.v4 v4.2.4
 	gopkg.in/redis.v5 v5.2.9
 	gopkg.in/yaml.v2 v2.2.8 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The status of the responses of the handlers
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Response is the JSON body of the responses of the handlers
+type Response struct {
+	Status string `json:"status"`
+
+	// Instances holds the status of each checker by instance name. Checkers
+	// sharing the name of a previous one are suffixed with #2, #3 and so on,
+	// in the order they were passed to the handler.
+	Instances map[string]Status `json:"instances"`
+}
+
+// ReadinessHandler returns a handler responding 200 when every instance is
+// healthy and 503 otherwise, for use as a readiness probe
+func ReadinessHandler(checkers ...*Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready := true
+		for _, c := range checkers {
+			if !c.Healthy() {
+				ready = false
+			}
+		}
+		respond(w, ready, checkers)
+	})
+}
+
+// LivenessHandler returns a handler responding 503 when the checks of a
+// started checker stopped running, and 200 otherwise, for use as a liveness
+// probe. Unhealthy instances don't fail it, so that processes aren't
+// restarted while redis is down.
+func LivenessHandler(checkers ...*Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alive := true
+		now := time.Now()
+		for _, c := range checkers {
+			if c.stalled(now) {
+				alive = false
+			}
+		}
+		respond(w, alive, checkers)
+	})
+}
+
+func respond(w http.ResponseWriter, ok bool, checkers []*Checker) {
+	resp := Response{
+		Status:    StatusOK,
+		Instances: make(map[string]Status, len(checkers)),
+	}
+	for _, c := range checkers {
+		name := c.InstanceName()
+		for i := 2; ; i++ {
+			if _, ok := resp.Instances[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s#%d", c.InstanceName(), i)
+		}
+		resp.Instances[name] = c.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		resp.Status = StatusUnavailable
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,252 @@
+// Package health periodically checks redis instances through their wrapped
+// clients, and serves the results as readiness and liveness probes. The
+// results are recorded into the HealthViews of the ocredis package.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// The defaults of Options
+const (
+	DefaultInterval         = 10 * time.Second
+	DefaultTimeout          = time.Second
+	DefaultFailureThreshold = 3
+)
+
+// The replication roles reported by INFO
+const (
+	RolePrimary = "master"
+	RoleReplica = "slave"
+)
+
+// ErrReplicationLinkDown fails the checks of replicas whose link to their
+// primary is down
+var ErrReplicationLinkDown = errors.New("ocredis: replication link to the primary is down")
+
+// Pinger is implemented by the wrapped clients
+type Pinger interface {
+	Ping(ctx context.Context) ocredis.StatusCmd
+}
+
+// Options configures a Checker. Zero fields use the defaults.
+type Options struct {
+	// InstanceName is the GoRedisInstanceName tag of the stats. When empty
+	// it's the instance name of the client if it implements
+	// ocredis.InstanceNamer, as the wrappers do, and DefaultInstanceName
+	// otherwise.
+	InstanceName string
+
+	// Interval is the time between checks
+	Interval time.Duration
+
+	// Timeout bounds the time a check can take before it fails
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed checks after
+	// which the instance is unhealthy
+	FailureThreshold int
+
+	// Replication, if set to true, also runs INFO replication, failing the
+	// checks of replicas whose link to their primary is down. The client
+	// must implement ocredis.InfoGetter.
+	Replication bool
+}
+
+// Status is the result of the checks of an instance
+type Status struct {
+	Healthy             bool          `json:"healthy"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	RTT                 time.Duration `json:"rtt"`
+	Role                string        `json:"role,omitempty"`
+	LastCheck           time.Time     `json:"last_check"`
+	Err                 string        `json:"error,omitempty"`
+}
+
+// Checker periodically pings an instance once started. The instance is
+// unhealthy until a check passes, and once FailureThreshold checks failed in
+// a row.
+type Checker struct {
+	client  Pinger
+	options Options
+
+	mu      sync.Mutex
+	status  Status
+	started time.Time
+
+	start sync.Once
+	stop  sync.Once
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewChecker returns a checker of the instance of client
+func NewChecker(client Pinger, options Options) *Checker {
+	if options.InstanceName == "" {
+		options.InstanceName = ocredis.DefaultInstanceName
+		if n, ok := client.(ocredis.InstanceNamer); ok {
+			options.InstanceName = n.InstanceName()
+		}
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = DefaultFailureThreshold
+	}
+	return &Checker{
+		client:  client,
+		options: options,
+		done:    make(chan struct{}),
+	}
+}
+
+// InstanceName returns the name of the instance checked
+func (c *Checker) InstanceName() string {
+	return c.options.InstanceName
+}
+
+// Start runs a check now and then every Interval until Stop is called
+func (c *Checker) Start() {
+	c.start.Do(func() {
+		c.mu.Lock()
+		c.started = time.Now()
+		c.mu.Unlock()
+		c.wg.Add(1)
+		go c.run()
+	})
+}
+
+// Stop stops the checks and waits for the running check to end
+func (c *Checker) Stop() {
+	c.stop.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+}
+
+func (c *Checker) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+	for {
+		c.Check(context.Background())
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the instance now and returns the updated status
+func (c *Checker) Check(ctx context.Context) Status {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.client.Ping(ctx).Err()
+	rtt := time.Since(start)
+	if err == nil && rtt > c.options.Timeout {
+		err = context.DeadlineExceeded
+	}
+	var role string
+	if err == nil && c.options.Replication {
+		role, err = c.checkReplication(ctx)
+	}
+
+	c.mu.Lock()
+	s := &c.status
+	s.LastCheck, s.RTT, s.Role, s.Err = start, rtt, role, ""
+	if err != nil {
+		s.ConsecutiveFailures++
+		s.Err = err.Error()
+		if s.ConsecutiveFailures >= c.options.FailureThreshold {
+			s.Healthy = false
+		}
+	} else {
+		s.ConsecutiveFailures = 0
+		s.Healthy = true
+	}
+	status := *s
+	c.mu.Unlock()
+
+	c.record(status)
+	return status
+}
+
+// checkReplication returns the role of the instance, failing when it's a
+// replica whose link to its primary is down
+func (c *Checker) checkReplication(ctx context.Context) (string, error) {
+	client, ok := c.client.(ocredis.InfoGetter)
+	if !ok {
+		return "", ocredis.ErrUnsupportedCommand
+	}
+	reply, err := client.Info(ctx, "replication").Result()
+	if err != nil {
+		return "", err
+	}
+	info := ocredis.ParseInfo(reply)
+	role, _ := info.Get("replication", "role")
+	if role == RoleReplica {
+		if link, _ := info.Get("replication", "master_link_status"); link != "up" {
+			return role, ErrReplicationLinkDown
+		}
+	}
+	return role, nil
+}
+
+// record records the status with the GoRedisInstanceName tag
+func (c *Checker) record(s Status) {
+	var healthy int64
+	if s.Healthy {
+		healthy = 1
+	}
+	tags := []tag.Mutator{tag.Insert(ocredis.GoRedisInstanceName, c.options.InstanceName)}
+	_ = stats.RecordWithTags(context.Background(), tags,
+		ocredis.MeasureHealthy.M(healthy),
+		ocredis.MeasureHealthFailures.M(int64(s.ConsecutiveFailures)),
+		ocredis.MeasurePingRTTMs.M(float64(s.RTT)/float64(time.Millisecond)),
+	)
+}
+
+// Status returns the status of the last check
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Healthy reports whether the instance is healthy
+func (c *Checker) Healthy() bool {
+	return c.Status().Healthy
+}
+
+// stalled reports whether the checks of a started checker stopped running,
+// such as when a check hangs
+func (c *Checker) stalled(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started.IsZero() {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	last := c.status.LastCheck
+	if last.IsZero() {
+		last = c.started
+	}
+	return now.Sub(last) > 2*c.options.Interval+c.options.Timeout
+}
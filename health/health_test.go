@@ -0,0 +1,205 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+)
+
+// fakeClient replies to PING and INFO with the configured results
+type fakeClient struct {
+	mu    sync.Mutex
+	err   error
+	delay time.Duration
+	info  string
+}
+
+func (c *fakeClient) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *fakeClient) Ping(ctx context.Context) ocredis.StatusCmd {
+	c.mu.Lock()
+	err, delay := c.err, c.delay
+	c.mu.Unlock()
+	time.Sleep(delay)
+	return ocredis.NewStatusResult("PONG", err)
+}
+
+func (c *fakeClient) Info(ctx context.Context, section ...string) ocredis.StringCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ocredis.NewStringResult(c.info, nil)
+}
+
+func TestCheckerHealthyTransitions(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	c := NewChecker(client, Options{InstanceName: "cache", FailureThreshold: 2})
+	if c.Healthy() {
+		t.Fatal("Healthy before the first check")
+	}
+
+	steps := []struct {
+		err      error
+		healthy  bool
+		failures int
+	}{
+		{nil, true, 0},
+		// a single failure is tolerated
+		{errors.New("connection refused"), true, 1},
+		{nil, true, 0},
+		{errors.New("connection refused"), true, 1},
+		{errors.New("connection refused"), false, 2},
+		{errors.New("connection refused"), false, 3},
+		// a single success makes the instance healthy again
+		{nil, true, 0},
+	}
+	for i, step := range steps {
+		client.fail(step.err)
+		s := c.Check(ctx)
+		if s.Healthy != step.healthy || s.ConsecutiveFailures != step.failures || c.Healthy() != step.healthy {
+			t.Errorf("check %d: healthy %v with %d failures, want %v with %d", i, s.Healthy, s.ConsecutiveFailures, step.healthy, step.failures)
+		}
+		if (s.Err != "") != (step.err != nil) {
+			t.Errorf("check %d: error %q, want %v", i, s.Err, step.err)
+		}
+	}
+}
+
+func TestCheckerFailsUnhealthyFromTheStart(t *testing.T) {
+	client := &fakeClient{err: errors.New("connection refused")}
+	c := NewChecker(client, Options{})
+	if s := c.Check(context.Background()); s.Healthy {
+		t.Error("a failed first check made the instance healthy")
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	client := &fakeClient{delay: 20 * time.Millisecond}
+	c := NewChecker(client, Options{Timeout: 5 * time.Millisecond, FailureThreshold: 1})
+	s := c.Check(context.Background())
+	if s.Healthy || s.Err != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check = healthy %v with %q, want a deadline failure", s.Healthy, s.Err)
+	}
+}
+
+func TestCheckerReplication(t *testing.T) {
+	client := &fakeClient{info: "# Replication\r\nrole:slave\r\nmaster_link_status:down\r\n"}
+	c := NewChecker(client, Options{Replication: true, FailureThreshold: 1})
+	s := c.Check(context.Background())
+	if s.Healthy || s.Role != RoleReplica || s.Err != ErrReplicationLinkDown.Error() {
+		t.Errorf("replica with its link down = %+v, want unhealthy", s)
+	}
+
+	client.info = "# Replication\r\nrole:slave\r\nmaster_link_status:up\r\n"
+	if s := c.Check(context.Background()); !s.Healthy {
+		t.Errorf("replica with its link up = %+v, want healthy", s)
+	}
+	client.info = "# Replication\r\nrole:master\r\nconnected_slaves:1\r\n"
+	if s := c.Check(context.Background()); !s.Healthy || s.Role != RolePrimary {
+		t.Errorf("primary = %+v, want healthy", s)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	ctx := context.Background()
+	primary := NewChecker(&fakeClient{}, Options{InstanceName: "primary"})
+	failing := &fakeClient{err: errors.New("connection refused")}
+	replica := NewChecker(failing, Options{InstanceName: "replica"})
+	primary.Check(ctx)
+	replica.Check(ctx)
+
+	get := func(h http.Handler) (int, Response) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding the response: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := get(ReadinessHandler(primary, replica))
+	if code != http.StatusServiceUnavailable || resp.Status != StatusUnavailable {
+		t.Errorf("readiness with an unhealthy instance = %d %s, want 503", code, resp.Status)
+	}
+	if !resp.Instances["primary"].Healthy || resp.Instances["replica"].Healthy {
+		t.Errorf("readiness instances = %+v", resp.Instances)
+	}
+	// unhealthy instances don't fail the liveness probe
+	if code, resp := get(LivenessHandler(primary, replica)); code != http.StatusOK || resp.Status != StatusOK {
+		t.Errorf("liveness = %d %s, want 200", code, resp.Status)
+	}
+
+	failing.fail(nil)
+	replica.Check(ctx)
+	if code, _ := get(ReadinessHandler(primary, replica)); code != http.StatusOK {
+		t.Errorf("readiness with healthy instances = %d, want 200", code)
+	}
+
+	// the checks of a started checker stopped running
+	replica.mu.Lock()
+	replica.started = time.Now()
+	replica.status.LastCheck = time.Now().Add(-time.Hour)
+	replica.mu.Unlock()
+	if code, _ := get(LivenessHandler(primary, replica)); code != http.StatusServiceUnavailable {
+		t.Errorf("liveness with stalled checks = %d, want 503", code)
+	}
+}
+
+// namedClient is a client with an instance name, as the wrappers are
+type namedClient struct {
+	*fakeClient
+	name string
+}
+
+func (c namedClient) InstanceName() string {
+	return c.name
+}
+
+func TestCheckerInstanceName(t *testing.T) {
+	for _, tc := range []struct {
+		client  Pinger
+		options Options
+		want    string
+	}{
+		{&fakeClient{}, Options{}, ocredis.DefaultInstanceName},
+		{namedClient{&fakeClient{}, "sessions"}, Options{}, "sessions"},
+		{namedClient{&fakeClient{}, "sessions"}, Options{InstanceName: "cache"}, "cache"},
+	} {
+		if got := NewChecker(tc.client, tc.options).InstanceName(); got != tc.want {
+			t.Errorf("InstanceName with the options %+v = %q, want %q", tc.options, got, tc.want)
+		}
+	}
+}
+
+func TestHandlersDuplicateNames(t *testing.T) {
+	healthy := NewChecker(&fakeClient{}, Options{})
+	unhealthy := NewChecker(&fakeClient{}, Options{})
+	other := NewChecker(&fakeClient{}, Options{})
+	healthy.Check(context.Background())
+
+	rec := httptest.NewRecorder()
+	ReadinessHandler(healthy, unhealthy, other).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding the response: %v", err)
+	}
+	name := ocredis.DefaultInstanceName
+	if len(resp.Instances) != 3 || !resp.Instances[name].Healthy || resp.Instances[name+"#2"].Healthy {
+		t.Errorf("instances = %+v, want the 3 checkers in order", resp.Instances)
+	}
+	if _, ok := resp.Instances[name+"#3"]; !ok {
+		t.Errorf("instances = %+v, want %s#3", resp.Instances, name)
+	}
+}
@@ -0,0 +1,252 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// ErrUnsupportedCommand is returned when a client doesn't implement a command
+var ErrUnsupportedCommand = errors.New("ocredis: command not supported by the client")
+
+// Getter is implemented by every wrapper
+type Getter interface {
+	Get(ctx context.Context, key string) StringCmd
+}
+
+// HashGetter is implemented by the wrappers supporting HGET
+type HashGetter interface {
+	HGet(ctx context.Context, key, field string) StringCmd
+}
+
+// The defaults of HedgeOptions
+const (
+	DefaultHedgePercentile = 0.95
+	DefaultHedgeDelay      = 10 * time.Millisecond
+	DefaultHedgeSamples    = 256
+	DefaultHedgeMinSamples = 32
+)
+
+// The values of the GoRedisHedgeWinner tag
+const (
+	HedgePrimary = "primary"
+	HedgeReplica = "replica"
+)
+
+// HedgeOptions configures a HedgedReader. Zero fields use the defaults.
+type HedgeOptions struct {
+	// Percentile of the recent latencies of the primary after which the read
+	// is hedged to a replica, such as 0.95
+	Percentile float64
+
+	// Samples is the number of recent latencies of the primary kept. Until
+	// MinSamples latencies are known reads are hedged after Delay.
+	Samples    int
+	MinSamples int
+	Delay      time.Duration
+
+	// MinDelay and MaxDelay bound the delay derived from the percentile
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// AllowRoot, if set to true, creates the hedge span in absence of a
+	// parent span
+	AllowRoot bool
+}
+
+// HedgedReader reads from a primary and, when it doesn't reply within a delay
+// derived from its recent latencies, sends the same read to a replica and
+// returns the first reply. Each read gets a go.redis.hedged.<command> span
+// the spans of the attempts are children of.
+//
+// The redis clients don't take a context, so the read losing the race can't
+// be interrupted. Its context is canceled and its result discarded.
+type HedgedReader struct {
+	primary  Getter
+	replicas []Getter
+	options  HedgeOptions
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	recorded  int
+	delay     time.Duration
+	replica   int
+}
+
+// NewHedgedReader returns a reader hedging the reads of primary to the
+// replicas, used in turn
+func NewHedgedReader(options HedgeOptions, primary Getter, replicas ...Getter) *HedgedReader {
+	if options.Percentile <= 0 || options.Percentile >= 1 {
+		options.Percentile = DefaultHedgePercentile
+	}
+	if options.Samples <= 0 {
+		options.Samples = DefaultHedgeSamples
+	}
+	if options.MinSamples <= 0 {
+		options.MinSamples = DefaultHedgeMinSamples
+	}
+	if options.MinSamples > options.Samples {
+		options.MinSamples = options.Samples
+	}
+	if options.Delay <= 0 {
+		options.Delay = DefaultHedgeDelay
+	}
+	return &HedgedReader{
+		primary:   primary,
+		replicas:  replicas,
+		options:   options,
+		latencies: make([]time.Duration, options.Samples),
+		delay:     options.Delay,
+	}
+}
+
+// Get reads the key, hedging to a replica when the primary is slow
+func (h *HedgedReader) Get(ctx context.Context, key string) StringCmd {
+	return h.read(ctx, "get", func(ctx context.Context, g Getter) StringCmd {
+		return g.Get(ctx, key)
+	})
+}
+
+// HGet reads the field of the hash, hedging to a replica when the primary is
+// slow. Clients that don't support HGET return ErrUnsupportedCommand.
+func (h *HedgedReader) HGet(ctx context.Context, key, field string) StringCmd {
+	return h.read(ctx, "hget", func(ctx context.Context, g Getter) StringCmd {
+		hg, ok := g.(HashGetter)
+		if !ok {
+			return NewStringResult("", ErrUnsupportedCommand)
+		}
+		return hg.HGet(ctx, key, field)
+	})
+}
+
+// Delay returns the delay after which reads are hedged
+func (h *HedgedReader) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+type hedgeResult struct {
+	cmd    StringCmd
+	winner string
+}
+
+func (h *HedgedReader) read(ctx context.Context, command string, read func(ctx context.Context, g Getter) StringCmd) StringCmd {
+	method := MethodPrefix + "hedged." + command
+	var span *trace.Span
+	if AllowTrace(ctx, true, h.options.AllowRoot) {
+		ctx, span = trace.StartSpan(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+		defer span.End()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	start := time.Now()
+	go func() {
+		cmd := read(ctx, h.primary)
+		h.observe(time.Since(start))
+		results <- hedgeResult{cmd: cmd, winner: HedgePrimary}
+	}()
+
+	var (
+		timer   = time.NewTimer(h.Delay())
+		pending = 1
+		hedged  bool
+		last    hedgeResult
+	)
+	defer timer.Stop()
+	if len(h.replicas) == 0 {
+		timer.Stop()
+	}
+	hedge := func() {
+		hedged = true
+		pending++
+		replica := h.nextReplica()
+		go func() {
+			results <- hedgeResult{cmd: read(ctx, replica), winner: HedgeReplica}
+		}()
+	}
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedge()
+			}
+		case last = <-results:
+			pending--
+			if ClassifyError(last.cmd.Err()) == "" {
+				pending = 0
+			} else if !hedged && len(h.replicas) > 0 {
+				// hedge right away when the primary failed
+				timer.Stop()
+				hedge()
+			}
+		}
+	}
+	if hedged {
+		h.recordHedge(ctx, method, last.winner)
+	}
+	if span != nil {
+		span.AddAttributes(
+			trace.BoolAttribute("redis.hedge.fired", hedged),
+			trace.StringAttribute("redis.hedge.winner", last.winner),
+		)
+		span.SetStatus(trace.Status{Code: ErrorStatusCode(ClassifyError(last.cmd.Err())), Message: errorMessage(last.cmd.Err())})
+	}
+	return last.cmd
+}
+
+func (h *HedgedReader) nextReplica() Getter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.replicas[h.replica%len(h.replicas)]
+	h.replica++
+	return r
+}
+
+// observe records a latency of the primary and updates the delay
+func (h *HedgedReader) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % len(h.latencies)
+	h.recorded++
+	if h.recorded < h.options.MinSamples {
+		return
+	}
+	// recompute the percentile every few samples only
+	if h.recorded%8 != 0 && h.recorded != h.options.MinSamples {
+		return
+	}
+	n := h.recorded
+	if n > len(h.latencies) {
+		n = len(h.latencies)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, h.latencies[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	delay := sorted[int(h.options.Percentile*float64(n-1))]
+	if h.options.MinDelay > 0 && delay < h.options.MinDelay {
+		delay = h.options.MinDelay
+	}
+	if h.options.MaxDelay > 0 && delay > h.options.MaxDelay {
+		delay = h.options.MaxDelay
+	}
+	h.delay = delay
+}
+
+// recordHedge counts a hedged read by the attempt that won it
+func (h *HedgedReader) recordHedge(ctx context.Context, method, winner string) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Insert(GoRedisMethod, method),
+		tag.Insert(GoRedisHedgeWinner, winner),
+	}, MeasureHedges.M(1))
+}
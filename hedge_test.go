@@ -0,0 +1,172 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// slowGetter replies to reads after its latency unless the read is canceled
+// first
+type slowGetter struct {
+	latency time.Duration
+	val     string
+	err     error
+
+	mu       sync.Mutex
+	calls    int
+	canceled int
+}
+
+func (g *slowGetter) Get(ctx context.Context, key string) StringCmd {
+	g.mu.Lock()
+	g.calls++
+	g.mu.Unlock()
+	select {
+	case <-time.After(g.latency):
+		return NewStringResult(g.val, g.err)
+	case <-ctx.Done():
+		g.mu.Lock()
+		g.canceled++
+		g.mu.Unlock()
+		return NewStringResult("", ctx.Err())
+	}
+}
+
+func (g *slowGetter) counts() (calls, canceled int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls, g.canceled
+}
+
+// hedgeCount returns the number of hedged reads won by winner
+func hedgeCount(t *testing.T, winner string) int64 {
+	t.Helper()
+	rows, err := view.RetrieveData(GoRedisHedgesView.Name)
+	if err != nil {
+		t.Fatalf("retrieving hedges: %v", err)
+	}
+	for _, row := range rows {
+		for _, tg := range row.Tags {
+			if tg == (tag.Tag{Key: GoRedisHedgeWinner, Value: winner}) {
+				return row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func registerHedgesView(t *testing.T) {
+	t.Helper()
+	if err := view.Register(GoRedisHedgesView); err != nil {
+		t.Fatalf("registering view: %v", err)
+	}
+	t.Cleanup(func() { view.Unregister(GoRedisHedgesView) })
+}
+
+func TestHedgeNotFiredForFastPrimary(t *testing.T) {
+	registerHedgesView(t)
+	primary := &slowGetter{val: "primary"}
+	replica := &slowGetter{val: "replica"}
+	h := NewHedgedReader(HedgeOptions{Delay: time.Second}, primary, replica)
+
+	if v, err := h.Get(context.Background(), "key").Result(); err != nil || v != "primary" {
+		t.Fatalf("Get = %q, %v, want primary", v, err)
+	}
+	if calls, _ := replica.counts(); calls != 0 {
+		t.Errorf("replica was called %d times, want 0", calls)
+	}
+	if n := hedgeCount(t, HedgePrimary) + hedgeCount(t, HedgeReplica); n != 0 {
+		t.Errorf("recorded %d hedges, want 0", n)
+	}
+}
+
+func TestHedgeFiresAfterDelay(t *testing.T) {
+	registerHedgesView(t)
+	primary := &slowGetter{latency: time.Second, val: "primary"}
+	replica := &slowGetter{val: "replica"}
+	h := NewHedgedReader(HedgeOptions{Delay: 10 * time.Millisecond}, primary, replica)
+
+	start := time.Now()
+	if v, err := h.Get(context.Background(), "key").Result(); err != nil || v != "replica" {
+		t.Fatalf("Get = %q, %v, want replica", v, err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Get took %v, want about the hedge delay", elapsed)
+	}
+	if n := hedgeCount(t, HedgeReplica); n != 1 {
+		t.Errorf("recorded %d hedges won by the replica, want 1", n)
+	}
+	// the primary lost the race so its read is canceled
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, canceled := primary.counts(); canceled == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the read of the primary wasn't canceled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgePrimaryWinsRace(t *testing.T) {
+	registerHedgesView(t)
+	primary := &slowGetter{latency: 30 * time.Millisecond, val: "primary"}
+	replica := &slowGetter{latency: time.Second, val: "replica"}
+	h := NewHedgedReader(HedgeOptions{Delay: 5 * time.Millisecond}, primary, replica)
+
+	if v, err := h.Get(context.Background(), "key").Result(); err != nil || v != "primary" {
+		t.Fatalf("Get = %q, %v, want primary", v, err)
+	}
+	if n := hedgeCount(t, HedgePrimary); n != 1 {
+		t.Errorf("recorded %d hedges won by the primary, want 1", n)
+	}
+}
+
+func TestHedgeOnPrimaryFailure(t *testing.T) {
+	registerHedgesView(t)
+	primary := &slowGetter{err: errors.New("READONLY You can't write against a read only replica.")}
+	replica := &slowGetter{val: "replica"}
+	h := NewHedgedReader(HedgeOptions{Delay: time.Hour}, primary, replica)
+
+	if v, err := h.Get(context.Background(), "key").Result(); err != nil || v != "replica" {
+		t.Fatalf("Get = %q, %v, want the replica read", v, err)
+	}
+	if calls, _ := replica.counts(); calls != 1 {
+		t.Errorf("replica was called %d times, want 1", calls)
+	}
+	if n := hedgeCount(t, HedgeReplica); n != 1 {
+		t.Errorf("recorded %d hedges won by the replica, want 1", n)
+	}
+
+	// a missing key isn't a failure so it isn't hedged
+	primary.err = errors.New("redis: nil")
+	if err := h.Get(context.Background(), "key").Err(); !IsNil(err) {
+		t.Errorf("Get of a missing key = %v, want redis: nil", err)
+	}
+	if calls, _ := replica.counts(); calls != 1 {
+		t.Errorf("replica was called %d times after a missing key, want 1", calls)
+	}
+}
+
+func TestHedgeDelayFromPercentile(t *testing.T) {
+	h := NewHedgedReader(HedgeOptions{Percentile: 0.5, Samples: 8, MinSamples: 4, MaxDelay: 25 * time.Millisecond}, &slowGetter{})
+	for _, l := range []time.Duration{10, 20, 30, 40} {
+		h.observe(l * time.Millisecond)
+	}
+	if d := h.Delay(); d != 20*time.Millisecond {
+		t.Errorf("Delay = %v, want the median 20ms", d)
+	}
+	for i := 0; i < 4; i++ {
+		h.observe(time.Second)
+	}
+	if d := h.Delay(); d != 25*time.Millisecond {
+		t.Errorf("Delay = %v, want MaxDelay", d)
+	}
+}
@@ -0,0 +1,63 @@
+package ocredis
+
+import (
+	"context"
+	"strings"
+)
+
+// InfoGetter is implemented by the wrappers supporting INFO
+type InfoGetter interface {
+	Info(ctx context.Context, section ...string) StringCmd
+}
+
+// Info holds the fields of an INFO reply by section. Section names are lower
+// cased, such as "replication".
+type Info map[string]map[string]string
+
+// ParseInfo parses an INFO reply. Fields before the first section header are
+// kept in the "" section.
+func ParseInfo(reply string) Info {
+	info := Info{}
+	section := ""
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			section = strings.ToLower(strings.TrimSpace(line[1:]))
+			if info[section] == nil {
+				info[section] = map[string]string{}
+			}
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		if info[section] == nil {
+			info[section] = map[string]string{}
+		}
+		info[section][line[:i]] = line[i+1:]
+	}
+	return info
+}
+
+// Get returns the value of the field of the section
+func (i Info) Get(section, field string) (string, bool) {
+	value, ok := i[strings.ToLower(section)][field]
+	return value, ok
+}
+
+// ParseInfoValue parses the comma separated key=value pairs of the value of
+// fields such as those of the keyspace and commandstats sections, for
+// instance "keys=1,expires=0,avg_ttl=0"
+func ParseInfoValue(value string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			values[pair[:i]] = pair[i+1:]
+		}
+	}
+	return values
+}
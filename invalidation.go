@@ -0,0 +1,107 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PubSub is the pub/sub connection of a redis client. The wrapper packages
+// adapt the pub/sub of their redis client to it.
+type PubSub interface {
+	Subscribe(channels ...string) error
+	PSubscribe(patterns ...string) error
+
+	// ReceiveMessage blocks until a message is received on a channel or a
+	// pattern subscribed to
+	ReceiveMessage() (channel, payload string, err error)
+	Publish(channel, message string) error
+	Close() error
+}
+
+// invalidationBackoff is the wait before receiving again after a failure, it
+// doubles with every consecutive failure
+var invalidationBackoff = RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// SubscribeInvalidations invalidates the keys of the near cache as the pub/sub
+// messages selected by the options are received, and publishes the keys
+// written through the near cache on the channel of the options. The near
+// cache is purged when receiving fails, since invalidations may have been
+// lost, and receiving is retried with an exponential backoff. Closing the
+// returned Closer stops the subscription, stops publishing the keys written
+// and closes pubsub. The wrapper packages provide a SubscribeInvalidations function
+// taking their redis client.
+func SubscribeInvalidations(cache *NearCache, pubsub PubSub, options InvalidationOptions) (io.Closer, error) {
+	var err error
+	pattern := fmt.Sprintf("__keyspace@%d__:*", options.DB)
+	switch {
+	case options.Channel != "":
+		if err = pubsub.Subscribe(options.Channel); err == nil && options.Keyspace {
+			err = pubsub.PSubscribe(pattern)
+		}
+	case options.Keyspace:
+		err = pubsub.PSubscribe(pattern)
+	default:
+		return nil, errors.New("ocredis: no invalidation channel nor keyspace notifications")
+	}
+	if err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+	if options.Channel != "" {
+		cache.SetPublisher(func(keys []string) {
+			for _, key := range keys {
+				_ = pubsub.Publish(options.Channel, key)
+			}
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscription{pubsub: pubsub, cache: cache, options: options, ctx: ctx, cancel: cancel}
+	go s.receive()
+	return s, nil
+}
+
+type subscription struct {
+	pubsub  PubSub
+	cache   *NearCache
+	options InvalidationOptions
+
+	// ctx is canceled when the subscription is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *subscription) receive() {
+	backoff := newRetryPolicy(invalidationBackoff)
+	failures := 0
+	for {
+		channel, payload, err := s.pubsub.ReceiveMessage()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.cache.Purge()
+			if s.options.ErrorLogger != nil {
+				s.options.ErrorLogger(err)
+			}
+			failures++
+			if !sleep(s.ctx, backoff.backoff(failures)) {
+				return
+			}
+			continue
+		}
+		failures = 0
+		s.cache.HandleInvalidation(channel, payload)
+	}
+}
+
+// Close stops the subscription
+func (s *subscription) Close() error {
+	s.cancel()
+	if s.options.Channel != "" {
+		s.cache.SetPublisher(nil)
+	}
+	return s.pubsub.Close()
+}
@@ -0,0 +1,294 @@
+package ocredis
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The defaults of KeyAnalyzerOptions
+const (
+	DefaultAnalyzerWindow       = time.Minute
+	DefaultAnalyzerTopK         = 10
+	DefaultAnalyzerHotThreshold = 1000
+	DefaultSketchWidth          = 2048
+	DefaultSketchDepth          = 4
+)
+
+// analyzerSlots is the number of slots the window of a KeyAnalyzer slides by
+const analyzerSlots = 6
+
+// MinAnalyzerWindow is the shortest window of a KeyAnalyzer, shorter windows
+// are raised to it
+const MinAnalyzerWindow = analyzerSlots * time.Millisecond
+
+// KeyAnalyzerOptions configures a KeyAnalyzer. Zero fields use the defaults.
+type KeyAnalyzerOptions struct {
+	// Window is the duration accesses and sizes are kept for, at least
+	// MinAnalyzerWindow
+	Window time.Duration
+
+	// TopK is the number of most accessed keys tracked
+	TopK int
+
+	// HotThreshold is the number of accesses within the window after which a
+	// key is hot
+	HotThreshold int64
+
+	// KeyPattern groups keys for the big key tracking, KeyIDSegments is used
+	// when it's nil. MaxKeyPatterns caps the number of distinct patterns.
+	KeyPattern     KeyPatternFunc
+	MaxKeyPatterns int
+
+	// SketchWidth and SketchDepth size the count-min sketch estimating the
+	// access counts. Wider sketches overestimate less.
+	SketchWidth int
+	SketchDepth int
+}
+
+// KeyCount is the estimated number of accesses of a key within the window
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Hot   bool   `json:"hot"`
+}
+
+// KeySize is the largest value seen for a key pattern within the window
+type KeySize struct {
+	Pattern string `json:"pattern"`
+	Key     string `json:"key"`
+	Bytes   int    `json:"bytes"`
+}
+
+// KeyAnalyzer finds hot keys and big keys from the calls of the wrappers it's
+// given to with WithKeyAnalyzer. Access counts are estimated with a count-min
+// sketch and only the top K keys are kept, so memory doesn't grow with the
+// number of keys.
+type KeyAnalyzer struct {
+	mu       sync.Mutex
+	options  KeyAnalyzerOptions
+	patterns *keyPatterns
+	slots    [analyzerSlots]*analyzerSlot
+	slot     int64
+	top      map[string]int64
+	now      func() time.Time
+}
+
+// analyzerSlot holds the accesses and sizes of a slot of the window
+type analyzerSlot struct {
+	sketch  [][]uint32
+	biggest map[string]KeySize
+}
+
+// NewKeyAnalyzer returns a KeyAnalyzer configured by o
+func NewKeyAnalyzer(o KeyAnalyzerOptions) *KeyAnalyzer {
+	if o.Window <= 0 {
+		o.Window = DefaultAnalyzerWindow
+	} else if o.Window < MinAnalyzerWindow {
+		o.Window = MinAnalyzerWindow
+	}
+	if o.TopK <= 0 {
+		o.TopK = DefaultAnalyzerTopK
+	}
+	if o.HotThreshold <= 0 {
+		o.HotThreshold = DefaultAnalyzerHotThreshold
+	}
+	if o.KeyPattern == nil {
+		o.KeyPattern = KeyIDSegments
+	}
+	if o.SketchWidth <= 0 {
+		o.SketchWidth = DefaultSketchWidth
+	}
+	if o.SketchDepth <= 0 {
+		o.SketchDepth = DefaultSketchDepth
+	}
+	a := &KeyAnalyzer{
+		options:  o,
+		patterns: newKeyPatterns(o.KeyPattern, o.MaxKeyPatterns),
+		top:      map[string]int64{},
+		now:      time.Now,
+	}
+	a.Reset()
+	return a
+}
+
+// Reset forgets every access and size
+func (a *KeyAnalyzer) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range a.slots {
+		a.slots[i] = a.newSlot()
+	}
+	a.top = map[string]int64{}
+	a.slot = a.slotOf(a.now())
+}
+
+func (a *KeyAnalyzer) newSlot() *analyzerSlot {
+	s := &analyzerSlot{
+		sketch:  make([][]uint32, a.options.SketchDepth),
+		biggest: map[string]KeySize{},
+	}
+	for i := range s.sketch {
+		s.sketch[i] = make([]uint32, a.options.SketchWidth)
+	}
+	return s
+}
+
+func (a *KeyAnalyzer) slotOf(t time.Time) int64 {
+	return t.UnixNano() / int64(a.options.Window/analyzerSlots)
+}
+
+// advance clears the slots that left the window
+func (a *KeyAnalyzer) advance() {
+	slot := a.slotOf(a.now())
+	if slot == a.slot {
+		return
+	}
+	for s := a.slot + 1; s <= slot && s <= a.slot+analyzerSlots; s++ {
+		a.slots[s%analyzerSlots] = a.newSlot()
+	}
+	a.slot = slot
+	for key := range a.top {
+		if a.top[key] = a.estimate(key); a.top[key] == 0 {
+			delete(a.top, key)
+		}
+	}
+}
+
+// Observe records an access of the key with a value of size bytes, a size of
+// zero when it isn't known. It returns the estimated number of accesses of
+// the key within the window and whether it's hot.
+func (a *KeyAnalyzer) Observe(key string, size int) (count int64, hot bool) {
+	pattern := a.patterns.pattern(key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.advance()
+	current := a.slots[a.slot%analyzerSlots]
+	h1, h2 := keyHashes(key)
+	for i, row := range current.sketch {
+		row[a.index(h1, h2, i)]++
+	}
+	if size > 0 {
+		if biggest, ok := current.biggest[pattern]; !ok || size > biggest.Bytes {
+			current.biggest[pattern] = KeySize{Pattern: pattern, Key: key, Bytes: size}
+		}
+	}
+	count = a.estimate(key)
+	a.updateTop(key, count)
+	return count, count >= a.options.HotThreshold
+}
+
+// updateTop keeps the key in the top K when it's accessed more than the least
+// accessed of them
+func (a *KeyAnalyzer) updateTop(key string, count int64) {
+	if _, ok := a.top[key]; ok || len(a.top) < a.options.TopK {
+		a.top[key] = count
+		return
+	}
+	var (
+		minKey   string
+		minCount int64 = -1
+	)
+	for k, c := range a.top {
+		if minCount < 0 || c < minCount {
+			minKey, minCount = k, c
+		}
+	}
+	if count > minCount {
+		delete(a.top, minKey)
+		a.top[key] = count
+	}
+}
+
+// estimate returns the estimated number of accesses of the key within the
+// window, the sum over the slots of the minimum of the counters of the key
+func (a *KeyAnalyzer) estimate(key string) int64 {
+	h1, h2 := keyHashes(key)
+	var total int64
+	for _, s := range a.slots {
+		var min uint32
+		for i, row := range s.sketch {
+			if c := row[a.index(h1, h2, i)]; i == 0 || c < min {
+				min = c
+			}
+		}
+		total += int64(min)
+	}
+	return total
+}
+
+func (a *KeyAnalyzer) index(h1, h2 uint32, row int) int {
+	return int((h1 + uint32(row)*h2) % uint32(a.options.SketchWidth))
+}
+
+// keyHashes returns the two hashes the counters of a key are derived from
+func keyHashes(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+// HotKeys returns the most accessed keys within the window, most accessed
+// first
+func (a *KeyAnalyzer) HotKeys() []KeyCount {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.advance()
+	keys := make([]KeyCount, 0, len(a.top))
+	for key, count := range a.top {
+		keys = append(keys, KeyCount{Key: key, Count: count, Hot: count >= a.options.HotThreshold})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// BigKeys returns the largest value seen for each key pattern within the
+// window, largest first
+func (a *KeyAnalyzer) BigKeys() []KeySize {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.advance()
+	biggest := map[string]KeySize{}
+	for _, s := range a.slots {
+		for pattern, size := range s.biggest {
+			if b, ok := biggest[pattern]; !ok || size.Bytes > b.Bytes {
+				biggest[pattern] = size
+			}
+		}
+	}
+	sizes := make([]KeySize, 0, len(biggest))
+	for _, size := range biggest {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].Pattern < sizes[j].Pattern
+	})
+	return sizes
+}
+
+// ServeHTTP writes the hot keys and big keys as JSON. The keys aren't
+// sanitized, so the handler should only be served on a debug port.
+func (a *KeyAnalyzer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Window  string     `json:"window"`
+		HotKeys []KeyCount `json:"hot_keys"`
+		BigKeys []KeySize  `json:"big_keys"`
+	}{
+		Window:  a.options.Window.String(),
+		HotKeys: a.HotKeys(),
+		BigKeys: a.BigKeys(),
+	})
+}
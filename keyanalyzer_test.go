@@ -0,0 +1,89 @@
+package ocredis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestAnalyzer returns an analyzer whose clock only moves with the
+// returned function
+func newTestAnalyzer(o KeyAnalyzerOptions) (*KeyAnalyzer, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	a := NewKeyAnalyzer(o)
+	a.now = func() time.Time { return now }
+	a.Reset()
+	return a, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestKeyAnalyzerCounts(t *testing.T) {
+	a, _ := newTestAnalyzer(KeyAnalyzerOptions{HotThreshold: 5})
+	for i := 0; i < 5; i++ {
+		count, hot := a.Observe("hot", 0)
+		if count != int64(i+1) {
+			t.Errorf("count after %d accesses = %d", i+1, count)
+		}
+		if hot != (i == 4) {
+			t.Errorf("hot after %d accesses = %v", i+1, hot)
+		}
+	}
+	// the sketch never underestimates
+	for i := 0; i < 1000; i++ {
+		a.Observe(fmt.Sprintf("key%d", i), 0)
+	}
+	if count, _ := a.Observe("hot", 0); count < 6 {
+		t.Errorf("estimate of hot = %d, want at least 6", count)
+	}
+}
+
+func TestKeyAnalyzerTopK(t *testing.T) {
+	a, _ := newTestAnalyzer(KeyAnalyzerOptions{TopK: 2, HotThreshold: 3})
+	for key, n := range map[string]int{"a": 1, "b": 3, "c": 2} {
+		for i := 0; i < n; i++ {
+			a.Observe(key, 0)
+		}
+	}
+	got := a.HotKeys()
+	want := []KeyCount{{Key: "b", Count: 3, Hot: true}, {Key: "c", Count: 2}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("HotKeys = %v, want %v", got, want)
+	}
+}
+
+func TestKeyAnalyzerWindow(t *testing.T) {
+	a, advance := newTestAnalyzer(KeyAnalyzerOptions{Window: 6 * time.Second})
+	a.Observe("key", 100)
+	advance(3 * time.Second)
+	a.Observe("key", 0)
+	if got := a.HotKeys(); len(got) != 1 || got[0].Count != 2 {
+		t.Errorf("HotKeys within the window = %v, want key with 2 accesses", got)
+	}
+	// the first access left the window
+	advance(4 * time.Second)
+	if got := a.HotKeys(); len(got) != 1 || got[0].Count != 1 {
+		t.Errorf("HotKeys after the first slot left = %v, want key with 1 access", got)
+	}
+	if got := a.BigKeys(); len(got) != 0 {
+		t.Errorf("BigKeys after the size left the window = %v", got)
+	}
+	advance(time.Minute)
+	if got := a.HotKeys(); len(got) != 0 {
+		t.Errorf("HotKeys after the window = %v", got)
+	}
+}
+
+func TestKeyAnalyzerBigKeys(t *testing.T) {
+	a, _ := newTestAnalyzer(KeyAnalyzerOptions{})
+	a.Observe("user:1", 10)
+	a.Observe("user:2", 300)
+	a.Observe("user:3", 20)
+	a.Observe("page:1", 50)
+	a.Observe("page:2", 0)
+	want := []KeySize{
+		{Pattern: "user:{id}", Key: "user:2", Bytes: 300},
+		{Pattern: "page:{id}", Key: "page:1", Bytes: 50},
+	}
+	if got := a.BigKeys(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("BigKeys = %v, want %v", got, want)
+	}
+}
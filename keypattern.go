@@ -0,0 +1,128 @@
+package ocredis
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// KeyPatternFunc returns the pattern of a key, such as "user:{id}" for
+// "user:42". Patterns tag stats with the GoRedisKeyPattern tag so they must
+// have a low cardinality.
+type KeyPatternFunc func(key string) string
+
+// KeyPatternOther is the pattern of keys once the maximum number of distinct
+// patterns is reached, or of keys the extractor returned no pattern for
+const KeyPatternOther = "other"
+
+// DefaultMaxKeyPatterns is the maximum number of distinct patterns used when
+// WithKeyPattern isn't given a maximum
+const DefaultMaxKeyPatterns = 100
+
+// KeyPrefix returns the part of the key before the first ':', or the whole
+// key when it has none
+func KeyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+var (
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// KeyIDSegments replaces the numeric and UUID segments of the key with
+// "{id}". Segments are separated by ':', '/' or '.', so "user:42:profile"
+// becomes "user:{id}:profile".
+func KeyIDSegments(key string) string {
+	var (
+		b     strings.Builder
+		start int
+	)
+	for i := 0; i <= len(key); i++ {
+		if i < len(key) && !isKeySeparator(key[i]) {
+			continue
+		}
+		segment := key[start:i]
+		if numericSegment.MatchString(segment) || uuidSegment.MatchString(segment) {
+			b.WriteString("{id}")
+		} else {
+			b.WriteString(segment)
+		}
+		if i < len(key) {
+			b.WriteByte(key[i])
+		}
+		start = i + 1
+	}
+	return b.String()
+}
+
+func isKeySeparator(c byte) bool {
+	return c == ':' || c == '/' || c == '.'
+}
+
+// KeyTemplate maps the keys matching Regexp to Pattern. Pattern can refer to
+// the submatches of Regexp as in regexp.Regexp.Expand, such as "$1:{id}".
+type KeyTemplate struct {
+	Regexp  *regexp.Regexp
+	Pattern string
+}
+
+// KeyTemplates returns the pattern of the first template matching the key.
+// Keys matching no template get no pattern and are counted as "other".
+func KeyTemplates(templates ...KeyTemplate) KeyPatternFunc {
+	return func(key string) string {
+		for _, t := range templates {
+			match := t.Regexp.FindStringSubmatchIndex(key)
+			if match == nil {
+				continue
+			}
+			return string(t.Regexp.ExpandString(nil, t.Pattern, key, match))
+		}
+		return ""
+	}
+}
+
+// keyPatterns caps the number of distinct patterns returned by a
+// KeyPatternFunc
+type keyPatterns struct {
+	fn  KeyPatternFunc
+	max int
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+func newKeyPatterns(fn KeyPatternFunc, max int) *keyPatterns {
+	if max <= 0 {
+		max = DefaultMaxKeyPatterns
+	}
+	return &keyPatterns{fn: fn, max: max, seen: map[string]struct{}{}}
+}
+
+// pattern returns the pattern of the key, or "other" when the pattern would
+// exceed the maximum number of distinct patterns
+func (p *keyPatterns) pattern(key string) string {
+	pattern := p.fn(key)
+	if pattern == "" {
+		return KeyPatternOther
+	}
+	p.mu.RLock()
+	_, ok := p.seen[pattern]
+	p.mu.RUnlock()
+	if ok {
+		return pattern
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.seen[pattern]; ok {
+		return pattern
+	}
+	if len(p.seen) >= p.max {
+		return KeyPatternOther
+	}
+	p.seen[pattern] = struct{}{}
+	return pattern
+}
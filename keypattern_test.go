@@ -0,0 +1,66 @@
+package ocredis
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestKeyIDSegments(t *testing.T) {
+	for key, want := range map[string]string{
+		"user:42:profile": "user:{id}:profile",
+		"session/0b6a3f9e-4c1d-4a4e-9f0a-2d5c7b8e1f23": "session/{id}",
+		"cache.v2.html": "cache.v2.html",
+		"42":            "{id}",
+		"":              "",
+	} {
+		if got := KeyIDSegments(key); got != want {
+			t.Errorf("KeyIDSegments(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestKeyTemplates(t *testing.T) {
+	fn := KeyTemplates(
+		KeyTemplate{Regexp: regexp.MustCompile(`^(\w+):\d+$`), Pattern: "$1:{id}"},
+		KeyTemplate{Regexp: regexp.MustCompile(`^lock:`), Pattern: "lock"},
+	)
+	for key, want := range map[string]string{
+		"user:42":   "user:{id}",
+		"lock:jobs": "lock",
+		"unmatched": "",
+	} {
+		if got := fn(key); got != want {
+			t.Errorf("pattern of %q = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestKeyPatternsCap(t *testing.T) {
+	p := newKeyPatterns(KeyPrefix, 3)
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("prefix%d:key", i)
+		if got, want := p.pattern(key), fmt.Sprintf("prefix%d", i); got != want {
+			t.Errorf("pattern(%q) = %q, want %q", key, got, want)
+		}
+	}
+	// the cap is reached so new patterns are counted as other
+	if got := p.pattern("prefix3:key"); got != KeyPatternOther {
+		t.Errorf("pattern over the cap = %q, want %q", got, KeyPatternOther)
+	}
+	// patterns seen before the cap are still used
+	if got := p.pattern("prefix1:other"); got != "prefix1" {
+		t.Errorf("pattern of a known prefix = %q, want prefix1", got)
+	}
+	if n := len(p.seen); n != 3 {
+		t.Errorf("tracked %d patterns, want 3", n)
+	}
+
+	empty := newKeyPatterns(func(string) string { return "" }, 0)
+	if got := empty.pattern("key"); got != KeyPatternOther {
+		t.Errorf("empty pattern = %q, want %q", got, KeyPatternOther)
+	}
+	if empty.max != DefaultMaxKeyPatterns {
+		t.Errorf("default cap = %d, want %d", empty.max, DefaultMaxKeyPatterns)
+	}
+}
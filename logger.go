@@ -0,0 +1,84 @@
+package ocredis
+
+import (
+	"context"
+	"time"
+)
+
+// Logger logs the calls of a wrapper. Adapters for common logging packages
+// are in the logging package.
+type Logger interface {
+	Log(ctx context.Context, entry LogEntry)
+}
+
+// LoggerFunc is a function implementing Logger
+type LoggerFunc func(ctx context.Context, entry LogEntry)
+
+// Log calls f
+func (f LoggerFunc) Log(ctx context.Context, entry LogEntry) {
+	f(ctx, entry)
+}
+
+// LogEntry describes a call passed to the Logger
+type LogEntry struct {
+	InstanceName string
+	Method       string
+
+	// Args are the keys and arguments of the call after sanitization
+	Args []string
+
+	Latency time.Duration
+
+	// Status is the GoRedisStatus tag value of the call
+	Status string
+	Err    error
+
+	// ErrorType is the type of Err, see ClassifyError
+	ErrorType string
+
+	// Slow is true when the call took at least its slow threshold
+	Slow bool
+
+	// Sampled is true when the span of the call was sampled
+	Sampled bool
+
+	// TraceID and SpanID identify the span of the call. They are empty when
+	// the call has no span.
+	TraceID string
+	SpanID  string
+}
+
+// LogFilter selects the calls passed to the Logger
+type LogFilter func(entry LogEntry) bool
+
+// LogAll logs every call
+func LogAll(entry LogEntry) bool {
+	return true
+}
+
+// LogErrors logs the calls that failed. A missing key isn't a failure.
+func LogErrors(entry LogEntry) bool {
+	return entry.ErrorType != ""
+}
+
+// LogSampled logs the calls whose span was sampled
+func LogSampled(entry LogEntry) bool {
+	return entry.Sampled
+}
+
+// LogSlow logs the calls that took at least their slow threshold
+func LogSlow(entry LogEntry) bool {
+	return entry.Slow
+}
+
+// LogAny logs the calls selected by any of the filters
+func LogAny(filters ...LogFilter) LogFilter {
+	return func(entry LogEntry) bool {
+		for _, f := range filters {
+			if f(entry) {
+				return true
+			}
+		}
+		return false
+	}
+}
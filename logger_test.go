@@ -0,0 +1,87 @@
+package ocredis_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v4 "github.com/KolbyMcGarrah/ocredis/v4"
+	"go.opencensus.io/trace"
+	redis "gopkg.in/redis.v4"
+)
+
+// entryRecorder records the entries passed to the Logger
+type entryRecorder struct {
+	mu      sync.Mutex
+	entries []ocredis.LogEntry
+}
+
+func (r *entryRecorder) Log(ctx context.Context, entry ocredis.LogEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	defer s.Close()
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	defer e.Unregister()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	for _, tc := range []struct {
+		name      string
+		sanitizer ocredis.ArgSanitizer
+		key       string
+		want      []string
+	}{
+		{"Default", nil, "user:1", []string{"user:1", "?", "?"}},
+		{"RedactKeys", ocredis.RedactKeys(nil, "session:*"), "session:1", []string{"?", "?", "?"}},
+		{"Verbose", ocredis.VerboseArgSanitizer, "user:1", []string{"user:1", "secret", "0s"}},
+	} {
+		e.Reset()
+		r := &entryRecorder{}
+		c := v4.Wrap(client,
+			ocredis.WithAllTraceOptions(),
+			ocredis.WithAllowRoot(true),
+			ocredis.WithStatement(true),
+			ocredis.WithArgSanitizer(tc.sanitizer),
+			ocredis.WithLogger(r, ocredis.LogAll),
+		)
+		c.Set(context.Background(), tc.key, "secret", 0)
+
+		if len(r.entries) != 1 {
+			t.Fatalf("%s: logged %d entries, want 1", tc.name, len(r.entries))
+		}
+		if got := r.entries[0].Args; !equalStrings(got, tc.want) {
+			t.Errorf("%s: logged args %q, want %q", tc.name, got, tc.want)
+		}
+		// spans are sanitized the same way as logs
+		e.AssertSpan(t, "go.redis.set", map[string]interface{}{
+			"redis.statement": "SET " + strings.Join(tc.want, " "),
+		}, trace.StatusCodeOK)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+// Package logging adapts common logging packages to the ocredis.Logger
+// interface. Failed calls are logged at the error level, slow calls at the
+// warn level and every other call at the info level.
+//
+// The zap and logrus adapters live in the zaplog and logruslog modules so
+// ocredis doesn't depend on those packages, this package only depends on the
+// standard library.
+package logging
+
+import "github.com/KolbyMcGarrah/ocredis"
+
+// Message is the message of every entry
+const Message = "redis call"
+
+// The field names of the entries
+const (
+	FieldInstance  = "instance"
+	FieldMethod    = "method"
+	FieldArgs      = "args"
+	FieldLatency   = "latency"
+	FieldStatus    = "status"
+	FieldError     = "error"
+	FieldErrorType = "error_type"
+	FieldSlow      = "slow"
+	FieldTraceID   = "trace_id"
+	FieldSpanID    = "span_id"
+)
+
+// Level is the level an entry is logged at
+type Level int
+
+// The levels of the entries
+const (
+	LevelInfo Level = iota
+	LevelWarn
+	LevelError
+)
+
+// EntryLevel returns the level of the entry
+func EntryLevel(entry ocredis.LogEntry) Level {
+	switch {
+	case entry.ErrorType != "":
+		return LevelError
+	case entry.Slow:
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// Fields returns the fields of the entry. Empty fields are left out.
+func Fields(entry ocredis.LogEntry) map[string]interface{} {
+	f := map[string]interface{}{
+		FieldInstance: entry.InstanceName,
+		FieldMethod:   entry.Method,
+		FieldArgs:     entry.Args,
+		FieldLatency:  entry.Latency,
+		FieldStatus:   entry.Status,
+	}
+	if entry.Err != nil {
+		f[FieldError] = entry.Err.Error()
+	}
+	if entry.ErrorType != "" {
+		f[FieldErrorType] = entry.ErrorType
+	}
+	if entry.Slow {
+		f[FieldSlow] = true
+	}
+	if entry.TraceID != "" {
+		f[FieldTraceID] = entry.TraceID
+		f[FieldSpanID] = entry.SpanID
+	}
+	return f
+}
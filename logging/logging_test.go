@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+)
+
+func TestEntryLevel(t *testing.T) {
+	for _, tc := range []struct {
+		entry ocredis.LogEntry
+		want  Level
+	}{
+		{ocredis.LogEntry{}, LevelInfo},
+		{ocredis.LogEntry{Slow: true}, LevelWarn},
+		{ocredis.LogEntry{Slow: true, ErrorType: ocredis.ErrorTypeTimeout}, LevelError},
+	} {
+		if got := EntryLevel(tc.entry); got != tc.want {
+			t.Errorf("EntryLevel(%+v) = %v, want %v", tc.entry, got, tc.want)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	f := Fields(ocredis.LogEntry{
+		InstanceName: "cache",
+		Method:       "go.redis.get",
+		Args:         []string{"key"},
+		Latency:      time.Millisecond,
+		Status:       "ERROR",
+		Err:          errors.New("i/o timeout"),
+		ErrorType:    ocredis.ErrorTypeTimeout,
+	})
+	if f[FieldError] != "i/o timeout" || f[FieldErrorType] != ocredis.ErrorTypeTimeout {
+		t.Errorf("error fields = %v, %v", f[FieldError], f[FieldErrorType])
+	}
+	for _, name := range []string{FieldSlow, FieldTraceID, FieldSpanID} {
+		if _, ok := f[name]; ok {
+			t.Errorf("empty field %s was kept", name)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/KolbyMcGarrah/ocredis/logging/logruslog
+
+go 1.15
+
+replace github.com/KolbyMcGarrah/ocredis => ../..
+
+require (
+	github.com/KolbyMcGarrah/ocredis v0.0.0
+	github.com/sirupsen/logrus v1.9.0
+)
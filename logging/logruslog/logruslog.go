@@ -0,0 +1,26 @@
+// Package logruslog adapts logrus loggers to the ocredis.Logger interface. It
+// is a separate module so ocredis doesn't depend on logrus.
+package logruslog
+
+import (
+	"context"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// New returns a Logger logging to l
+func New(l logrus.FieldLogger) ocredis.Logger {
+	return ocredis.LoggerFunc(func(ctx context.Context, entry ocredis.LogEntry) {
+		e := l.WithFields(logrus.Fields(logging.Fields(entry)))
+		switch logging.EntryLevel(entry) {
+		case logging.LevelError:
+			e.Error(logging.Message)
+		case logging.LevelWarn:
+			e.Warn(logging.Message)
+		default:
+			e.Info(logging.Message)
+		}
+	})
+}
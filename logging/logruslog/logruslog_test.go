@@ -0,0 +1,34 @@
+package logruslog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestNew(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	l := New(logger)
+	ctx := context.Background()
+	l.Log(ctx, ocredis.LogEntry{Method: "go.redis.get", Args: []string{"key"}, Status: "OK"})
+	l.Log(ctx, ocredis.LogEntry{Method: "go.redis.get", Status: "OK", Latency: time.Second, Slow: true})
+	l.Log(ctx, ocredis.LogEntry{Method: "go.redis.set", Status: "ERROR", Err: errors.New("ERR failure"), ErrorType: ocredis.ErrorTypeRedis})
+
+	entries := hook.AllEntries()
+	if len(entries) != 3 {
+		t.Fatalf("logged %d entries, want 3", len(entries))
+	}
+	for i, want := range []logrus.Level{logrus.InfoLevel, logrus.WarnLevel, logrus.ErrorLevel} {
+		if entries[i].Level != want {
+			t.Errorf("entry %d logged at %v, want %v", i, entries[i].Level, want)
+		}
+	}
+	if got := entries[2].Data["error_type"]; got != ocredis.ErrorTypeRedis {
+		t.Errorf("error_type = %v, want %s", got, ocredis.ErrorTypeRedis)
+	}
+}
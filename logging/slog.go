@@ -0,0 +1,44 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/KolbyMcGarrah/ocredis"
+)
+
+// Slog returns a Logger logging to l. It requires go 1.21.
+func Slog(l *slog.Logger) ocredis.Logger {
+	return ocredis.LoggerFunc(func(ctx context.Context, entry ocredis.LogEntry) {
+		attrs := []slog.Attr{
+			slog.String(FieldInstance, entry.InstanceName),
+			slog.String(FieldMethod, entry.Method),
+			slog.Any(FieldArgs, entry.Args),
+			slog.Duration(FieldLatency, entry.Latency),
+			slog.String(FieldStatus, entry.Status),
+		}
+		if entry.Err != nil {
+			attrs = append(attrs, slog.String(FieldError, entry.Err.Error()))
+		}
+		if entry.ErrorType != "" {
+			attrs = append(attrs, slog.String(FieldErrorType, entry.ErrorType))
+		}
+		if entry.Slow {
+			attrs = append(attrs, slog.Bool(FieldSlow, true))
+		}
+		if entry.TraceID != "" {
+			attrs = append(attrs, slog.String(FieldTraceID, entry.TraceID), slog.String(FieldSpanID, entry.SpanID))
+		}
+		lvl := slog.LevelInfo
+		switch EntryLevel(entry) {
+		case LevelError:
+			lvl = slog.LevelError
+		case LevelWarn:
+			lvl = slog.LevelWarn
+		}
+		l.LogAttrs(ctx, lvl, Message, attrs...)
+	})
+}
@@ -0,0 +1,10 @@
+module github.com/KolbyMcGarrah/ocredis/logging/zaplog
+
+go 1.15
+
+replace github.com/KolbyMcGarrah/ocredis => ../..
+
+require (
+	github.com/KolbyMcGarrah/ocredis v0.0.0
+	go.uber.org/zap v1.19.0
+)
@@ -0,0 +1,44 @@
+// Package zaplog adapts zap loggers to the ocredis.Logger interface. It is a
+// separate module so ocredis doesn't depend on zap.
+package zaplog
+
+import (
+	"context"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/logging"
+	"go.uber.org/zap"
+)
+
+// New returns a Logger logging to l
+func New(l *zap.Logger) ocredis.Logger {
+	return ocredis.LoggerFunc(func(ctx context.Context, entry ocredis.LogEntry) {
+		f := []zap.Field{
+			zap.String(logging.FieldInstance, entry.InstanceName),
+			zap.String(logging.FieldMethod, entry.Method),
+			zap.Strings(logging.FieldArgs, entry.Args),
+			zap.Duration(logging.FieldLatency, entry.Latency),
+			zap.String(logging.FieldStatus, entry.Status),
+		}
+		if entry.Err != nil {
+			f = append(f, zap.String(logging.FieldError, entry.Err.Error()))
+		}
+		if entry.ErrorType != "" {
+			f = append(f, zap.String(logging.FieldErrorType, entry.ErrorType))
+		}
+		if entry.Slow {
+			f = append(f, zap.Bool(logging.FieldSlow, true))
+		}
+		if entry.TraceID != "" {
+			f = append(f, zap.String(logging.FieldTraceID, entry.TraceID), zap.String(logging.FieldSpanID, entry.SpanID))
+		}
+		switch logging.EntryLevel(entry) {
+		case logging.LevelError:
+			l.Error(logging.Message, f...)
+		case logging.LevelWarn:
+			l.Warn(logging.Message, f...)
+		default:
+			l.Info(logging.Message, f...)
+		}
+	})
+}
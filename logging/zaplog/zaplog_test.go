@@ -0,0 +1,35 @@
+package zaplog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNew(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	l := New(zap.New(core))
+	ctx := context.Background()
+	l.Log(ctx, ocredis.LogEntry{Method: "go.redis.get", Args: []string{"key"}, Status: "OK"})
+	l.Log(ctx, ocredis.LogEntry{Method: "go.redis.get", Status: "OK", Latency: time.Second, Slow: true})
+	l.Log(ctx, ocredis.LogEntry{Method: "go.redis.set", Status: "ERROR", Err: errors.New("ERR failure"), ErrorType: ocredis.ErrorTypeRedis})
+
+	entries := logs.All()
+	if len(entries) != 3 {
+		t.Fatalf("logged %d entries, want 3", len(entries))
+	}
+	for i, want := range []zapcore.Level{zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel} {
+		if entries[i].Level != want {
+			t.Errorf("entry %d logged at %v, want %v", i, entries[i].Level, want)
+		}
+	}
+	if got := entries[2].ContextMap()["error_type"]; got != ocredis.ErrorTypeRedis {
+		t.Errorf("error_type = %v, want %s", got, ocredis.ErrorTypeRedis)
+	}
+}
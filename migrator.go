@@ -0,0 +1,478 @@
+package ocredis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// The nodes of a Migrator, set as the redis.node attribute of the spans of
+// the calls it runs
+const (
+	MigrationSource      = "source"
+	MigrationDestination = "destination"
+)
+
+// RoleShadow is the redis.node.role attribute of the calls a Migrator runs
+// on the side that doesn't serve reads
+const RoleShadow = "shadow"
+
+// The reasons of a mismatch, set as GoRedisMismatch tag values
+const (
+	// MismatchValue is a read returning different values
+	MismatchValue = "value"
+
+	// MismatchMissing is a key found on one side only
+	MismatchMissing = "missing"
+
+	// MismatchError is a shadow read failing while the served read succeeded
+	MismatchError = "error"
+
+	// MismatchWrite is a shadow write failing while the served write
+	// succeeded
+	MismatchWrite = "write"
+)
+
+// Mismatch describes a call the source and the destination of a migration
+// disagreed on. The values aren't included as they may be sensitive.
+type Mismatch struct {
+	Method string
+
+	// Key is the key of the call, the keys separated by spaces for the
+	// commands taking several keys
+	Key    string
+	Reason string
+
+	// Shadow is the side the mismatching call ran on as a shadow and Err its
+	// error, if any
+	Shadow string
+	Err    error
+}
+
+// MismatchLogger receives the mismatches of a Migrator
+type MismatchLogger func(ctx context.Context, m Mismatch)
+
+// The defaults of MigratorOptions
+const (
+	// DefaultMaxShadowReads is the number of shadow reads a Migrator runs at
+	// once
+	DefaultMaxShadowReads = 64
+
+	// DefaultShadowReadTimeout bounds the context of a shadow read
+	DefaultShadowReadTimeout = time.Second
+)
+
+// MigratorOptions configures a Migrator
+type MigratorOptions struct {
+	// MismatchLogger, if set, is called with every mismatch
+	MismatchLogger MismatchLogger
+
+	// MaxShadowReads bounds the shadow reads running at once,
+	// DefaultMaxShadowReads when zero. The reads served while the bound is
+	// reached aren't compared.
+	MaxShadowReads int
+
+	// ShadowReadTimeout is the timeout of the context of the shadow reads,
+	// DefaultShadowReadTimeout when zero. Shadow reads run once the served
+	// read returned, so their context keeps the values of the context of
+	// the read, such as its span, but not its deadline or cancelation.
+	ShadowReadTimeout time.Duration
+}
+
+// Migrator helps moving data between two redis deployments. Writes run on
+// the source and then on the destination. Reads are served by the source
+// and run in the background on the destination, the results are compared
+// and the mismatches recorded with the MeasureMismatches measure. After
+// SetCutover the destination serves the reads and the source is the shadow.
+//
+// The results of the writes are those of the side serving the reads. Writes
+// failing there don't run on the shadow. SetNX and Incr are mirrored from
+// that result so the sides can't drift, and the
+// scripts missing from the script cache of the shadow are loaded there when
+// their source is known. The commands not implemented by a client return
+// ErrUnsupportedCommand.
+type Migrator struct {
+	Forwarder
+
+	source      Getter
+	destination Getter
+	options     MigratorOptions
+	cutover     int32
+
+	// shadowReads holds a token per shadow read running
+	shadowReads chan struct{}
+
+	// scripts maps the SHA1 digests of the scripts loaded through the
+	// migrator to their source
+	scripts sync.Map
+}
+
+var (
+	_ Client   = &Migrator{}
+	_ Cmdable  = &Migrator{}
+	_ Scripter = &Migrator{}
+)
+
+// NewMigrator returns a migrator from source to destination
+func NewMigrator(options MigratorOptions, source, destination Getter) *Migrator {
+	if options.MaxShadowReads <= 0 {
+		options.MaxShadowReads = DefaultMaxShadowReads
+	}
+	if options.ShadowReadTimeout <= 0 {
+		options.ShadowReadTimeout = DefaultShadowReadTimeout
+	}
+	m := &Migrator{
+		source:      source,
+		destination: destination,
+		options:     options,
+		shadowReads: make(chan struct{}, options.MaxShadowReads),
+	}
+	// the commands the migrator doesn't override, such as PING, are served
+	// by the serving side only
+	m.Forwarder = NewRoutingForwarder(func(ctx context.Context, command string) (context.Context, Getter) {
+		serving, _ := m.sides()
+		return serving.context(ctx, RolePrimary), serving.client
+	})
+	return m
+}
+
+// SetCutover switches the reads to the destination when on is true, and
+// back to the source otherwise
+func (m *Migrator) SetCutover(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&m.cutover, v)
+}
+
+// Cutover reports whether the destination serves the reads
+func (m *Migrator) Cutover() bool {
+	return atomic.LoadInt32(&m.cutover) == 1
+}
+
+type migrationSide struct {
+	name   string
+	client Getter
+}
+
+// sides returns the side serving the reads and the shadow
+func (m *Migrator) sides() (serving, shadow migrationSide) {
+	source := migrationSide{name: MigrationSource, client: m.source}
+	destination := migrationSide{name: MigrationDestination, client: m.destination}
+	if m.Cutover() {
+		return destination, source
+	}
+	return source, destination
+}
+
+func (s migrationSide) context(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route{node: s.name, role: role})
+}
+
+// forwarder returns a Forwarder running the commands on the side with role
+func (s migrationSide) forwarder(role string) Forwarder {
+	return NewRoutingForwarder(func(ctx context.Context, command string) (context.Context, Getter) {
+		return s.context(ctx, role), s.client
+	})
+}
+
+// read serves the read from one side and compares it in the background with
+// the result of the other. read returns the command and its value.
+func (m *Migrator) read(ctx context.Context, command, key string, read func(ctx context.Context, f Forwarder) (Cmd, interface{})) Cmd {
+	serving, shadow := m.sides()
+	cmd, val := read(ctx, serving.forwarder(RolePrimary))
+	if ClassifyError(cmd.Err()) != "" {
+		return cmd
+	}
+	select {
+	case m.shadowReads <- struct{}{}:
+	default:
+		// too many shadow reads are running, this one isn't compared
+		return cmd
+	}
+	go func() {
+		defer func() { <-m.shadowReads }()
+		ctx, cancel := context.WithTimeout(detachedContext{ctx}, m.options.ShadowReadTimeout)
+		defer cancel()
+		shadowCmd, shadowVal := read(ctx, shadow.forwarder(RoleShadow))
+		var (
+			reason string
+			err    error
+		)
+		switch {
+		case ClassifyError(shadowCmd.Err()) != "":
+			reason, err = MismatchError, shadowCmd.Err()
+		case IsNil(cmd.Err()) != IsNil(shadowCmd.Err()):
+			reason = MismatchMissing
+		case val != shadowVal:
+			reason = MismatchValue
+		default:
+			return
+		}
+		m.mismatch(ctx, command, key, reason, shadow.name, err)
+	}()
+	return cmd
+}
+
+// detachedContext carries the values of its parent, such as its span and
+// tags, without its deadline and cancelation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// write runs the write on both sides and returns the result of the side
+// serving the reads
+func (m *Migrator) write(ctx context.Context, command string, keys []string, write func(ctx context.Context, f Forwarder) Cmd) Cmd {
+	return m.mirror(ctx, command, keys, write, func(ctx context.Context, serving, shadow Forwarder, cmd Cmd) Cmd {
+		return write(ctx, shadow)
+	})
+}
+
+// mirror runs the write on the side serving the reads, then mirror on the
+// shadow with its result unless the write failed, so a write is never
+// applied to the shadow only. mirror returns nil when it didn't write
+// anything.
+func (m *Migrator) mirror(ctx context.Context, command string, keys []string, write func(ctx context.Context, f Forwarder) Cmd, mirror func(ctx context.Context, serving, shadow Forwarder, cmd Cmd) Cmd) Cmd {
+	serving, shadow := m.sides()
+	servingForwarder := serving.forwarder(RolePrimary)
+	cmd := write(ctx, servingForwarder)
+	if ClassifyError(cmd.Err()) != "" {
+		return cmd
+	}
+	shadowCmd := mirror(ctx, servingForwarder, shadow.forwarder(RoleShadow), cmd)
+	if shadowCmd != nil && ClassifyError(shadowCmd.Err()) != "" {
+		m.mismatch(ctx, command, strings.Join(keys, " "), MismatchWrite, shadow.name, shadowCmd.Err())
+	}
+	return cmd
+}
+
+// mismatch records the mismatch and passes it to the MismatchLogger
+func (m *Migrator) mismatch(ctx context.Context, command, key, reason, shadow string, err error) {
+	method := MethodPrefix + command
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Insert(GoRedisMethod, method),
+		tag.Insert(GoRedisMismatch, reason),
+	}, MeasureMismatches.M(1))
+	if m.options.MismatchLogger != nil {
+		m.options.MismatchLogger(ctx, Mismatch{
+			Method: method,
+			Key:    key,
+			Reason: reason,
+			Shadow: shadow,
+			Err:    err,
+		})
+	}
+}
+
+// copyValue sets the key on the shadow to the value the serving side holds.
+// The remaining time to live of the key isn't known, expiration is used
+// instead. It returns nil when the shadow already holds the value.
+func copyValue(ctx context.Context, serving, shadow Forwarder, key string, expiration time.Duration) Cmd {
+	cmd := serving.Get(ctx, key)
+	val, err := cmd.Result()
+	switch {
+	case IsNil(err):
+		return shadow.Del(ctx, key)
+	case err != nil:
+		return cmd
+	}
+	if current, err := shadow.Get(ctx, key).Result(); err == nil && current == val {
+		return nil
+	}
+	return shadow.Set(ctx, key, val, expiration)
+}
+
+// scriptSource returns the source of the script with the SHA1 digest, when
+// it's run as a Script or was loaded through the migrator
+func (m *Migrator) scriptSource(ctx context.Context, sha1 string) (string, bool) {
+	if s := scriptFromContext(ctx); s != nil && s.hash == sha1 {
+		return s.src, true
+	}
+	src, ok := m.scripts.Load(sha1)
+	if !ok {
+		return "", false
+	}
+	return src.(string), true
+}
+
+// Get reads the key from the serving side and compares it with the shadow
+func (m *Migrator) Get(ctx context.Context, key string) StringCmd {
+	return m.read(ctx, "get", key, func(ctx context.Context, f Forwarder) (Cmd, interface{}) {
+		cmd := f.Get(ctx, key)
+		return cmd, cmd.Val()
+	}).(StringCmd)
+}
+
+// HGet reads the field from the serving side and compares it with the shadow
+func (m *Migrator) HGet(ctx context.Context, key, field string) StringCmd {
+	return m.read(ctx, "hget", key, func(ctx context.Context, f Forwarder) (Cmd, interface{}) {
+		cmd := f.HGet(ctx, key, field)
+		return cmd, cmd.Val()
+	}).(StringCmd)
+}
+
+// HLen reads the length of the hash from the serving side and compares it
+// with the shadow
+func (m *Migrator) HLen(ctx context.Context, key string) IntCmd {
+	return m.read(ctx, "hlen", key, func(ctx context.Context, f Forwarder) (Cmd, interface{}) {
+		cmd := f.HLen(ctx, key)
+		return cmd, cmd.Val()
+	}).(IntCmd)
+}
+
+// Set writes the key on both sides
+func (m *Migrator) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd {
+	return m.write(ctx, "set", []string{key}, func(ctx context.Context, f Forwarder) Cmd {
+		return f.Set(ctx, key, value, expiration)
+	}).(StatusCmd)
+}
+
+// Incr increments the key on the serving side. The shadow is incremented as
+// well and, when it doesn't reach the same value, set to the value of the
+// serving side, which clears its expiration.
+func (m *Migrator) Incr(ctx context.Context, key string) IntCmd {
+	incr := func(ctx context.Context, f Forwarder) Cmd {
+		return f.Incr(ctx, key)
+	}
+	return m.mirror(ctx, "incr", []string{key}, incr, func(ctx context.Context, serving, shadow Forwarder, cmd Cmd) Cmd {
+		n, err := cmd.(IntCmd).Result()
+		if err != nil {
+			return nil
+		}
+		shadowCmd := shadow.Incr(ctx, key)
+		if v, err := shadowCmd.Result(); err != nil || v == n {
+			return shadowCmd
+		}
+		return shadow.Set(ctx, key, n, 0)
+	}).(IntCmd)
+}
+
+// Del deletes the keys on both sides
+func (m *Migrator) Del(ctx context.Context, keys ...string) IntCmd {
+	return m.write(ctx, "del", keys, func(ctx context.Context, f Forwarder) Cmd {
+		return f.Del(ctx, keys...)
+	}).(IntCmd)
+}
+
+// SetNX writes the key on the serving side when it doesn't exist. The shadow
+// then holds the value the serving side holds, whether it was written or
+// already there.
+func (m *Migrator) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) BoolCmd {
+	setNX := func(ctx context.Context, f Forwarder) Cmd {
+		return f.SetNX(ctx, key, value, expiration)
+	}
+	return m.mirror(ctx, "setnx", []string{key}, setNX, func(ctx context.Context, serving, shadow Forwarder, cmd Cmd) Cmd {
+		set, err := cmd.(BoolCmd).Result()
+		switch {
+		case err != nil:
+			return nil
+		case set:
+			return shadow.Set(ctx, key, value, expiration)
+		}
+		return copyValue(ctx, serving, shadow, key, expiration)
+	}).(BoolCmd)
+}
+
+// Close closes both sides and returns the first error
+func (m *Migrator) Close(ctx context.Context) error {
+	var first error
+	serving, shadow := m.sides()
+	for _, f := range []Forwarder{serving.forwarder(RolePrimary), shadow.forwarder(RoleShadow)} {
+		if err := f.Close(ctx); err != nil && err != ErrUnsupportedCommand && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// LPop pops the list on both sides
+func (m *Migrator) LPop(ctx context.Context, key string) StringCmd {
+	return m.write(ctx, "lpop", []string{key}, func(ctx context.Context, f Forwarder) Cmd {
+		return f.LPop(ctx, key)
+	}).(StringCmd)
+}
+
+// Expire sets the expiration of the key on both sides
+func (m *Migrator) Expire(ctx context.Context, key string, expiration time.Duration) BoolCmd {
+	return m.write(ctx, "expire", []string{key}, func(ctx context.Context, f Forwarder) Cmd {
+		return f.Expire(ctx, key, expiration)
+	}).(BoolCmd)
+}
+
+// ExpireAt sets the expiration time of the key on both sides
+func (m *Migrator) ExpireAt(ctx context.Context, key string, tm time.Time) BoolCmd {
+	return m.write(ctx, "expireat", []string{key}, func(ctx context.Context, f Forwarder) Cmd {
+		return f.ExpireAt(ctx, key, tm)
+	}).(BoolCmd)
+}
+
+// HSet writes the field on both sides
+func (m *Migrator) HSet(ctx context.Context, key, field string, value interface{}) BoolCmd {
+	return m.write(ctx, "hset", []string{key}, func(ctx context.Context, f Forwarder) Cmd {
+		return f.HSet(ctx, key, field, value)
+	}).(BoolCmd)
+}
+
+// Eval runs the script on both sides
+func (m *Migrator) Eval(ctx context.Context, script string, keys []string, args []string) RedisCmd {
+	return m.write(ctx, "eval", keys, func(ctx context.Context, f Forwarder) Cmd {
+		return f.Eval(ctx, script, keys, args)
+	}).(RedisCmd)
+}
+
+// EvalSha runs the cached script on both sides. Like every failed write it
+// doesn't run on the shadow when the serving side doesn't have it cached, as
+// Script.Run then loads it and runs it again. When the shadow doesn't have it cached the script is
+// loaded there, if its source is known, and run again.
+func (m *Migrator) EvalSha(ctx context.Context, sha1 string, keys []string, args []string) RedisCmd {
+	evalSha := func(ctx context.Context, f Forwarder) Cmd {
+		return f.EvalSha(ctx, sha1, keys, args)
+	}
+	return m.mirror(ctx, "evalsha", keys, evalSha, func(ctx context.Context, serving, shadow Forwarder, cmd Cmd) Cmd {
+		shadowCmd := shadow.EvalSha(ctx, sha1, keys, args)
+		if !isNoScriptErr(shadowCmd.Err()) {
+			return shadowCmd
+		}
+		src, ok := m.scriptSource(ctx, sha1)
+		if !ok {
+			return shadowCmd
+		}
+		if err := shadow.ScriptLoad(ctx, src).Err(); err != nil {
+			return shadow.Eval(ctx, src, keys, args)
+		}
+		return shadow.EvalSha(ctx, sha1, keys, args)
+	}).(RedisCmd)
+}
+
+// ScriptFlush flushes the script cache of both sides
+func (m *Migrator) ScriptFlush(ctx context.Context) StatusCmd {
+	return m.write(ctx, "scriptflush", nil, func(ctx context.Context, f Forwarder) Cmd {
+		return f.ScriptFlush(ctx)
+	}).(StatusCmd)
+}
+
+// ScriptLoad loads the script into the script cache of both sides, so
+// EvalSha runs on both
+func (m *Migrator) ScriptLoad(ctx context.Context, script string) StringCmd {
+	cmd := m.write(ctx, "scriptload", nil, func(ctx context.Context, f Forwarder) Cmd {
+		return f.ScriptLoad(ctx, script)
+	}).(StringCmd)
+	if sha1, err := cmd.Result(); err == nil {
+		m.scripts.Store(sha1, script)
+	}
+	return cmd
+}
@@ -0,0 +1,270 @@
+package ocredis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v4 "github.com/KolbyMcGarrah/ocredis/v4"
+	redis "gopkg.in/redis.v4"
+)
+
+// mismatchRecorder collects the mismatches of a Migrator
+type mismatchRecorder struct {
+	mu         sync.Mutex
+	mismatches []ocredis.Mismatch
+}
+
+func (r *mismatchRecorder) log(ctx context.Context, m ocredis.Mismatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mismatches = append(r.mismatches, m)
+}
+
+func (r *mismatchRecorder) all() []ocredis.Mismatch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ocredis.Mismatch(nil), r.mismatches...)
+}
+
+func newMigrationServer(t *testing.T) (*redistest.Server, *v4.Wrapper) {
+	t.Helper()
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = s.Close()
+	})
+	return s, v4.Wrap(client)
+}
+
+func newTestMigrator(t *testing.T, options ocredis.MigratorOptions) (*ocredis.Migrator, *redistest.Server, *redistest.Server, *mismatchRecorder) {
+	t.Helper()
+	source, sourceClient := newMigrationServer(t)
+	destination, destinationClient := newMigrationServer(t)
+	r := &mismatchRecorder{}
+	options.MismatchLogger = r.log
+	return ocredis.NewMigrator(options, sourceClient, destinationClient), source, destination, r
+}
+
+func TestMigratorSetNXCopiesTheSourceValue(t *testing.T) {
+	m, source, destination, _ := newTestMigrator(t, ocredis.MigratorOptions{})
+	ctx := context.Background()
+	source.Set("lock", "source")
+
+	if set, err := m.SetNX(ctx, "lock", "new", time.Minute).Result(); err != nil || set {
+		t.Fatalf("SetNX = %v, %v, want false", set, err)
+	}
+	if v, _ := destination.Get("lock"); v != "source" {
+		t.Errorf("destination holds %q, want the source value", v)
+	}
+
+	if set, err := m.SetNX(ctx, "other", "new", time.Minute).Result(); err != nil || !set {
+		t.Fatalf("SetNX = %v, %v, want true", set, err)
+	}
+	// the destination is overwritten even when it already held the key
+	destination.Set("stale", "destination")
+	m.SetNX(ctx, "stale", "new", 0)
+	for _, key := range []string{"other", "stale"} {
+		if v, _ := destination.Get(key); v != "new" {
+			t.Errorf("destination holds %q for %s, want new", v, key)
+		}
+	}
+}
+
+func TestMigratorIncrFollowsTheSource(t *testing.T) {
+	m, source, destination, _ := newTestMigrator(t, ocredis.MigratorOptions{})
+	ctx := context.Background()
+	source.Set("counter", "5")
+	destination.Set("counter", "1")
+
+	if n, err := m.Incr(ctx, "counter").Result(); err != nil || n != 6 {
+		t.Fatalf("Incr = %d, %v, want 6", n, err)
+	}
+	if v, _ := destination.Get("counter"); v != "6" {
+		t.Errorf("destination holds %q, want 6", v)
+	}
+
+	// a failed increment of the source isn't mirrored
+	source.AddFault(redistest.Fault{Command: "incr", Err: "ERR failure", Times: 1})
+	if err := m.Incr(ctx, "counter").Err(); err == nil {
+		t.Fatal("Incr succeeded with a failing source")
+	}
+	if v, _ := destination.Get("counter"); v != "6" {
+		t.Errorf("destination holds %q after a failed increment, want 6", v)
+	}
+}
+
+func TestMigratorLoadsScriptsOnTheShadow(t *testing.T) {
+	m, source, destination, r := newTestMigrator(t, ocredis.MigratorOptions{})
+	for _, s := range []*redistest.Server{source, destination} {
+		s.RegisterScript(incrBySrc, func(keys, args []string) (interface{}, error) {
+			return 42, nil
+		})
+	}
+	// only the source has the script cached
+	if _, err := source.Do("SCRIPT", "LOAD", incrBySrc); err != nil {
+		t.Fatalf("loading the script: %v", err)
+	}
+	script := ocredis.NewScript("incrby", incrBySrc)
+
+	if v, err := script.Run(context.Background(), m, []string{"counter"}, []string{"1"}).Result(); err != nil || v != int64(42) {
+		t.Fatalf("Run = %v, %v, want 42", v, err)
+	}
+	if got := source.CommandCount("evalsha"); got != 1 {
+		t.Errorf("source received %d EVALSHA, want 1", got)
+	}
+	for command, want := range map[string]int{"evalsha": 2, "script": 1} {
+		if got := destination.CommandCount(command); got != want {
+			t.Errorf("destination received %d %s, want %d", got, command, want)
+		}
+	}
+	if n := len(r.all()); n != 0 {
+		t.Errorf("recorded %d mismatches, want none", n)
+	}
+
+	// the script isn't run on the shadow when the serving side has to load it
+	source.ResetCounts()
+	destination.ResetCounts()
+	if _, err := source.Do("SCRIPT", "FLUSH"); err != nil {
+		t.Fatalf("flushing the script cache: %v", err)
+	}
+	if err := script.Run(context.Background(), m, []string{"counter"}, []string{"1"}).Err(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := destination.CommandCount("evalsha"); got != 1 {
+		t.Errorf("destination received %d EVALSHA, want 1", got)
+	}
+}
+
+func TestMigratorComparesReads(t *testing.T) {
+	m, source, destination, r := newTestMigrator(t, ocredis.MigratorOptions{})
+	ctx := context.Background()
+	source.Set("same", "value")
+	destination.Set("same", "value")
+	source.Set("different", "source")
+	destination.Set("different", "destination")
+	source.Set("missing", "value")
+
+	for _, key := range []string{"same", "different", "missing"} {
+		if v, err := m.Get(ctx, key).Result(); err != nil || v == "destination" {
+			t.Errorf("Get(%s) = %q, %v, want the source value", key, v, err)
+		}
+	}
+	want := map[string]string{"different": ocredis.MismatchValue, "missing": ocredis.MismatchMissing}
+	deadline := time.Now().Add(time.Second)
+	for len(r.all()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	got := r.all()
+	if len(got) != len(want) {
+		t.Fatalf("recorded %d mismatches, want %d", len(got), len(want))
+	}
+	for _, mm := range got {
+		if mm.Reason != want[mm.Key] || mm.Shadow != ocredis.MigrationDestination || mm.Method != "go.redis.get" {
+			t.Errorf("mismatch %+v, want reason %s on the destination", mm, want[mm.Key])
+		}
+	}
+
+	// after the cutover the destination serves the reads
+	m.SetCutover(true)
+	if v := m.Get(ctx, "different").Val(); v != "destination" {
+		t.Errorf("Get after the cutover = %q, want the destination value", v)
+	}
+}
+
+func TestMigratorBoundsShadowReads(t *testing.T) {
+	m, _, destination, _ := newTestMigrator(t, ocredis.MigratorOptions{MaxShadowReads: 1})
+	destination.SetLatency(50 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		m.Get(context.Background(), "key")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := destination.CommandCount("get"); got != 1 {
+		t.Errorf("destination received %d shadow reads, want 1", got)
+	}
+}
+
+func TestMigratorSkipsFailedWrites(t *testing.T) {
+	m, source, destination, r := newTestMigrator(t, ocredis.MigratorOptions{})
+	ctx := context.Background()
+	source.AddFault(redistest.Fault{Command: "set", Err: "READONLY You can't write against a read only replica.", Times: 1})
+	source.AddFault(redistest.Fault{Command: "del", Err: "ERR injected", Times: 1})
+	destination.Set("kept", "value")
+
+	if err := m.Set(ctx, "key", "value", 0).Err(); err == nil {
+		t.Fatal("Set succeeded, want the source error")
+	}
+	if err := m.Del(ctx, "kept").Err(); err == nil {
+		t.Fatal("Del succeeded, want the source error")
+	}
+	if destination.Exists("key") || !destination.Exists("kept") {
+		t.Error("writes failing on the source were applied to the destination")
+	}
+	if got := destination.CommandCount("set") + destination.CommandCount("del"); got != 0 {
+		t.Errorf("destination received %d writes, want none", got)
+	}
+	if got := r.all(); len(got) != 0 {
+		t.Errorf("recorded mismatches %+v, want none", got)
+	}
+
+	// a missing key isn't a failure
+	source.Do("RPUSH", "list", "value")
+	if err := m.LPop(ctx, "empty").Err(); !ocredis.IsNil(err) {
+		t.Fatalf("LPop of an empty list = %v, want the nil error", err)
+	}
+	if got := destination.CommandCount("lpop"); got != 1 {
+		t.Errorf("destination received %d LPOP, want 1", got)
+	}
+}
+
+type ctxKey struct{}
+
+// ctxClient records the context of the reads it runs once released, along
+// with its error at the time of the read
+type ctxClient struct {
+	release chan struct{}
+	ctxs    chan context.Context
+	errs    chan error
+}
+
+func (c *ctxClient) Get(ctx context.Context, key string) ocredis.StringCmd {
+	<-c.release
+	c.errs <- ctx.Err()
+	c.ctxs <- ctx
+	return ocredis.NewStringResult("value", nil)
+}
+
+func TestMigratorDetachesShadowReads(t *testing.T) {
+	_, source := newMigrationServer(t)
+	shadow := &ctxClient{release: make(chan struct{}), ctxs: make(chan context.Context, 1), errs: make(chan error, 1)}
+	m := ocredis.NewMigrator(ocredis.MigratorOptions{ShadowReadTimeout: time.Minute}, source, shadow)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	m.Get(ctx, "key")
+	// the caller is done before the shadow read runs
+	cancel()
+	close(shadow.release)
+
+	var shadowCtx context.Context
+	select {
+	case shadowCtx = <-shadow.ctxs:
+	case <-time.After(time.Second):
+		t.Fatal("the shadow read didn't run")
+	}
+	if err := <-shadow.errs; err != nil {
+		t.Errorf("context of the shadow read: %v, want it detached from the caller", err)
+	}
+	if v := shadowCtx.Value(ctxKey{}); v != "value" {
+		t.Errorf("context value = %v, want the value of the caller's context", v)
+	}
+	if deadline, ok := shadowCtx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("deadline = %v, %v, want the shadow read timeout", deadline, ok)
+	}
+}
@@ -0,0 +1,326 @@
+// Package mock provides a programmable implementation of the ocredis client
+// interfaces for unit testing code that uses the wrapped clients.
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+)
+
+// ErrUnexpectedCall is returned in the command of a call that matched no
+// expectation
+var ErrUnexpectedCall = errors.New("mock: unexpected call")
+
+// Any matches any value of a single argument in an expectation
+var Any = anyArg{}
+
+type anyArg struct{}
+
+func (anyArg) String() string { return "<any>" }
+
+// Call is a call received by a MockClient
+type Call struct {
+	Command string
+	Args    []interface{}
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("%s %v", c.Command, c.Args)
+}
+
+// Expectation describes a call expected by a MockClient and the result it
+// returns
+type Expectation struct {
+	command string
+	args    []interface{}
+	val     interface{}
+	err     error
+	times   int
+	calls   int
+}
+
+// Return sets the value and error returned by the matching calls. The value
+// must be of the type returned by the command, for example a string for Get
+// or an int64 for Incr.
+func (e *Expectation) Return(val interface{}, err error) *Expectation {
+	e.val, e.err = val, err
+	return e
+}
+
+// ReturnErr sets the error returned by the matching calls
+func (e *Expectation) ReturnErr(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets the number of calls the expectation matches. By default an
+// expectation matches a single call.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes lets the expectation match any number of calls including none
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times >= 0 && e.calls >= e.times
+}
+
+func (e *Expectation) matches(c Call) bool {
+	if e.command != c.Command {
+		return false
+	}
+	if e.args == nil {
+		return true
+	}
+	if len(e.args) != len(c.Args) {
+		return false
+	}
+	for i, want := range e.args {
+		if want == Any {
+			continue
+		}
+		if !reflect.DeepEqual(want, c.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) String() string {
+	args := "any args"
+	if e.args != nil {
+		args = fmt.Sprint(e.args)
+	}
+	return fmt.Sprintf("%s %s", e.command, args)
+}
+
+// MockClient implements the ocredis client interfaces by matching each call
+// against its expectations in the order they were added.
+type MockClient struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+}
+
+var (
+	_ ocredis.Client     = &MockClient{}
+	_ ocredis.Cmdable    = &MockClient{}
+	_ ocredis.Scripter   = &MockClient{}
+	_ ocredis.InfoGetter = &MockClient{}
+)
+
+// NewMockClient returns a MockClient without expectations
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+// Expect adds an expectation for command, which is the method name such as
+// "Get" or "HSet" and is matched case insensitively. args are compared to the
+// arguments of the call after the context, Any matches any single argument and
+// passing no args matches any arguments.
+func (m *MockClient) Expect(command string, args ...interface{}) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := &Expectation{command: strings.ToLower(command), args: args, times: 1}
+	if len(args) == 0 {
+		e.args = nil
+	}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Calls returns every call received by the client
+func (m *MockClient) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallCount returns the number of calls received for command
+func (m *MockClient) CallCount(command string) int {
+	var n int
+	for _, c := range m.Calls() {
+		if c.Command == strings.ToLower(command) {
+			n++
+		}
+	}
+	return n
+}
+
+// ExpectationsWereMet returns an error describing the expectations that
+// haven't been called the expected number of times
+func (m *MockClient) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var unmet []string
+	for _, e := range m.expectations {
+		if e.times >= 0 && e.calls != e.times {
+			unmet = append(unmet, fmt.Sprintf("%s called %d times, want %d", e, e.calls, e.times))
+		}
+	}
+	if len(unmet) > 0 {
+		return fmt.Errorf("mock: unmet expectations:\n%s", strings.Join(unmet, "\n"))
+	}
+	return nil
+}
+
+// Reset removes all expectations and recorded calls
+func (m *MockClient) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations, m.calls = nil, nil
+}
+
+// call records a call and returns the value and error of the first matching
+// expectation
+func (m *MockClient) call(command string, args ...interface{}) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := Call{Command: command, Args: args}
+	m.calls = append(m.calls, c)
+	for _, e := range m.expectations {
+		if e.exhausted() || !e.matches(c) {
+			continue
+		}
+		e.calls++
+		return e.val, e.err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnexpectedCall, c)
+}
+
+// Get implements ocredis.Client
+func (m *MockClient) Get(ctx context.Context, key string) ocredis.StringCmd {
+	val, err := m.call("get", key)
+	return NewStringResult(toString("get", val), err)
+}
+
+// Set implements ocredis.Client
+func (m *MockClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) ocredis.StatusCmd {
+	val, err := m.call("set", key, value, expiration)
+	return NewStatusResult(toStatus("set", val, err), err)
+}
+
+// Incr implements ocredis.Client
+func (m *MockClient) Incr(ctx context.Context, key string) ocredis.IntCmd {
+	val, err := m.call("incr", key)
+	return NewIntResult(toInt64("incr", val), err)
+}
+
+// Ping implements ocredis.Client
+func (m *MockClient) Ping(ctx context.Context) ocredis.StatusCmd {
+	val, err := m.call("ping")
+	if val == nil && err == nil {
+		val = "PONG"
+	}
+	return NewStatusResult(toString("ping", val), err)
+}
+
+// Info implements ocredis.InfoGetter
+func (m *MockClient) Info(ctx context.Context, section ...string) ocredis.StringCmd {
+	val, err := m.call("info", stringArgs(section)...)
+	return NewStringResult(toString("info", val), err)
+}
+
+// Del implements ocredis.Client
+func (m *MockClient) Del(ctx context.Context, keys ...string) ocredis.IntCmd {
+	val, err := m.call("del", stringArgs(keys)...)
+	return NewIntResult(toInt64("del", val), err)
+}
+
+// SetNX implements ocredis.Client
+func (m *MockClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) ocredis.BoolCmd {
+	val, err := m.call("setnx", key, value, expiration)
+	return NewBoolResult(toBool("setnx", val), err)
+}
+
+// Close implements ocredis.Client
+func (m *MockClient) Close(ctx context.Context) error {
+	_, err := m.call("close")
+	return err
+}
+
+// LPop implements ocredis.Client
+func (m *MockClient) LPop(ctx context.Context, key string) ocredis.StringCmd {
+	val, err := m.call("lpop", key)
+	return NewStringResult(toString("lpop", val), err)
+}
+
+// Eval implements ocredis.Client
+func (m *MockClient) Eval(ctx context.Context, script string, keys []string, args []string) ocredis.RedisCmd {
+	val, err := m.call("eval", script, keys, args)
+	return NewCmdResult(val, err)
+}
+
+// Expire mirrors the Expire method of the v3 and v4 wrappers
+func (m *MockClient) Expire(ctx context.Context, key string, expiration time.Duration) ocredis.BoolCmd {
+	val, err := m.call("expire", key, expiration)
+	return NewBoolResult(toBool("expire", val), err)
+}
+
+// ExpireAt implements ocredis.Cmdable
+func (m *MockClient) ExpireAt(ctx context.Context, key string, tm time.Time) ocredis.BoolCmd {
+	val, err := m.call("expireat", key, tm)
+	return NewBoolResult(toBool("expireat", val), err)
+}
+
+// HLen implements ocredis.Cmdable
+func (m *MockClient) HLen(ctx context.Context, key string) ocredis.IntCmd {
+	val, err := m.call("hlen", key)
+	return NewIntResult(toInt64("hlen", val), err)
+}
+
+// HGet implements ocredis.Cmdable
+func (m *MockClient) HGet(ctx context.Context, key, field string) ocredis.StringCmd {
+	val, err := m.call("hget", key, field)
+	return NewStringResult(toString("hget", val), err)
+}
+
+// HSet implements ocredis.Cmdable
+func (m *MockClient) HSet(ctx context.Context, key, field string, value interface{}) ocredis.BoolCmd {
+	val, err := m.call("hset", key, field, value)
+	return NewBoolResult(toBool("hset", val), err)
+}
+
+// EvalSha implements ocredis.Scripter
+func (m *MockClient) EvalSha(ctx context.Context, sha1 string, keys []string, args []string) ocredis.RedisCmd {
+	val, err := m.call("evalsha", sha1, keys, args)
+	return NewCmdResult(val, err)
+}
+
+// ScriptExists implements ocredis.Scripter
+func (m *MockClient) ScriptExists(ctx context.Context, scripts ...string) ocredis.BoolSliceCmd {
+	val, err := m.call("scriptexists", stringArgs(scripts)...)
+	return NewBoolSliceResult(toBools("scriptexists", val), err)
+}
+
+// ScriptFlush implements ocredis.Scripter
+func (m *MockClient) ScriptFlush(ctx context.Context) ocredis.StatusCmd {
+	val, err := m.call("scriptflush")
+	return NewStatusResult(toStatus("scriptflush", val, err), err)
+}
+
+// ScriptLoad implements ocredis.Scripter
+func (m *MockClient) ScriptLoad(ctx context.Context, script string) ocredis.StringCmd {
+	val, err := m.call("scriptload", script)
+	return NewStringResult(toString("scriptload", val), err)
+}
+
+func stringArgs(s []string) []interface{} {
+	args := make([]interface{}, len(s))
+	for i := range s {
+		args[i] = s[i]
+	}
+	return args
+}
@@ -0,0 +1,118 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExpectationMatching(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockClient()
+	m.Expect("Get", "key").Return("value", nil)
+	m.Expect("GET", Any).Return("other", nil)
+	m.Expect("Set", "key", Any, time.Duration(0))
+	m.Expect("Del").Return(2, nil)
+	m.Expect("Eval", "return 1", []string{"key"}, []string{"arg"}).Return(int64(1), nil)
+
+	if v, err := m.Get(ctx, "key").Result(); err != nil || v != "value" {
+		t.Errorf("Get(key) = %q, %v, want value", v, err)
+	}
+	if v, err := m.Get(ctx, "missing").Result(); err != nil || v != "other" {
+		t.Errorf("Get(missing) = %q, %v, want other", v, err)
+	}
+	if v, err := m.Set(ctx, "key", 42, 0).Result(); err != nil || v != "OK" {
+		t.Errorf("Set = %q, %v, want OK", v, err)
+	}
+	if n, err := m.Del(ctx, "a", "b").Result(); err != nil || n != 2 {
+		t.Errorf("Del = %d, %v, want 2", n, err)
+	}
+	if v, err := m.Eval(ctx, "return 1", []string{"key"}, []string{"arg"}).Result(); err != nil || v != int64(1) {
+		t.Errorf("Eval = %v, %v, want 1", v, err)
+	}
+	if err := m.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnexpectedCall(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockClient()
+	m.Expect("Get", "key").Return("value", nil)
+
+	if err := m.Get(ctx, "other").Err(); !errors.Is(err, ErrUnexpectedCall) {
+		t.Errorf("Get with other args = %v, want ErrUnexpectedCall", err)
+	}
+	if err := m.Incr(ctx, "key").Err(); !errors.Is(err, ErrUnexpectedCall) {
+		t.Errorf("Incr without expectation = %v, want ErrUnexpectedCall", err)
+	}
+	if err := m.Get(ctx, "key").Err(); err != nil {
+		t.Fatalf("Get(key): %v", err)
+	}
+	// the expectation matches a single call by default
+	if err := m.Get(ctx, "key").Err(); !errors.Is(err, ErrUnexpectedCall) {
+		t.Errorf("second Get(key) = %v, want ErrUnexpectedCall", err)
+	}
+}
+
+func TestReturnErr(t *testing.T) {
+	failure := errors.New("failure")
+	m := NewMockClient()
+	m.Expect("Incr", "key").ReturnErr(failure)
+	if err := m.Incr(context.Background(), "key").Err(); err != failure {
+		t.Errorf("Incr = %v, want %v", err, failure)
+	}
+}
+
+func TestUnmetExpectations(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockClient()
+	m.Expect("Get", "key").Times(2)
+	m.Expect("Ping").AnyTimes()
+	m.Get(ctx, "key")
+
+	if err := m.ExpectationsWereMet(); err == nil {
+		t.Error("ExpectationsWereMet = nil with a Get expectation called once of twice")
+	}
+	m.Get(ctx, "key")
+	if err := m.ExpectationsWereMet(); err != nil {
+		t.Errorf("ExpectationsWereMet: %v", err)
+	}
+}
+
+func TestCallCounts(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockClient()
+	m.Expect("HSet").AnyTimes().Return(true, nil)
+	m.Expect("Ping").AnyTimes()
+
+	for i := 0; i < 3; i++ {
+		m.HSet(ctx, "hash", "field", i)
+	}
+	if v, err := m.Ping(ctx).Result(); err != nil || v != "PONG" {
+		t.Errorf("Ping = %q, %v, want PONG", v, err)
+	}
+	m.Get(ctx, "unexpected")
+
+	for command, want := range map[string]int{"hset": 3, "HSet": 3, "ping": 1, "get": 1, "del": 0} {
+		if got := m.CallCount(command); got != want {
+			t.Errorf("CallCount(%s) = %d, want %d", command, got, want)
+		}
+	}
+	calls := m.Calls()
+	if len(calls) != 5 {
+		t.Fatalf("recorded %d calls, want 5", len(calls))
+	}
+	if c := calls[2]; c.Command != "hset" || len(c.Args) != 3 || c.Args[2] != 2 {
+		t.Errorf("third call = %v, want hset [hash field 2]", c)
+	}
+
+	m.Reset()
+	if n := len(m.Calls()); n != 0 {
+		t.Errorf("Reset kept %d calls", n)
+	}
+	if err := m.Ping(ctx).Err(); !errors.Is(err, ErrUnexpectedCall) {
+		t.Errorf("Ping after Reset = %v, want ErrUnexpectedCall", err)
+	}
+}
@@ -0,0 +1,103 @@
+package mock
+
+import (
+	"fmt"
+
+	"github.com/KolbyMcGarrah/ocredis"
+)
+
+// NewCmdResult returns a RedisCmd holding val and err
+func NewCmdResult(val interface{}, err error) ocredis.RedisCmd {
+	return ocredis.NewCmdResult(val, err)
+}
+
+// NewStatusResult returns a StatusCmd holding val and err
+func NewStatusResult(val string, err error) ocredis.StatusCmd {
+	return ocredis.NewStatusResult(val, err)
+}
+
+// NewStringResult returns a StringCmd holding val and err
+func NewStringResult(val string, err error) ocredis.StringCmd {
+	return ocredis.NewStringResult(val, err)
+}
+
+// NewIntResult returns an IntCmd holding val and err
+func NewIntResult(val int64, err error) ocredis.IntCmd {
+	return ocredis.NewIntResult(val, err)
+}
+
+// NewBoolResult returns a BoolCmd holding val and err
+func NewBoolResult(val bool, err error) ocredis.BoolCmd {
+	return ocredis.NewBoolResult(val, err)
+}
+
+// NewBoolSliceResult returns a BoolSliceCmd holding val and err
+func NewBoolSliceResult(val []bool, err error) ocredis.BoolSliceCmd {
+	return ocredis.NewBoolSliceResult(val, err)
+}
+
+// The following helpers convert the value of an expectation to the type of
+// the command result. A value of the wrong type is a mistake in the test so
+// they panic.
+
+func toString(command string, val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	panic(fmt.Sprintf("mock: can't use %T as the string result of %s", val, command))
+}
+
+// toStatus defaults the status of successful calls to OK
+func toStatus(command string, val interface{}, err error) string {
+	if val == nil && err == nil {
+		return "OK"
+	}
+	return toString(command, val)
+}
+
+func toInt64(command string, val interface{}) int64 {
+	switch v := val.(type) {
+	case nil:
+		return 0
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	}
+	panic(fmt.Sprintf("mock: can't use %T as the integer result of %s", val, command))
+}
+
+func toBool(command string, val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	panic(fmt.Sprintf("mock: can't use %T as the bool result of %s", val, command))
+}
+
+func toBools(command string, val interface{}) []bool {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []bool:
+		return v
+	}
+	panic(fmt.Sprintf("mock: can't use %T as the []bool result of %s", val, command))
+}
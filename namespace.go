@@ -0,0 +1,186 @@
+package ocredis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// Namespace prefixes the keys of every call of a client, so services sharing
+// a redis don't collide on key names. The prefix is set as the
+// redis.namespace attribute of the spans and as the GoRedisNamespace tag of
+// the stats of the calls.
+//
+// Script arguments other than the keys aren't prefixed. Commands not
+// implemented by the client return ErrUnsupportedCommand. SCAN and KEYS
+// aren't wrapped as the wrappers don't implement them: run them on the
+// redis client with Pattern and strip the prefix of the keys they return
+// with Unprefixes.
+//
+// Register the NamespaceViews to count the calls by namespace.
+type Namespace struct {
+	Forwarder
+
+	prefix string
+}
+
+var (
+	_ Client   = &Namespace{}
+	_ Cmdable  = &Namespace{}
+	_ Scripter = &Namespace{}
+)
+
+// NewNamespace returns a namespace prefixing the keys of the client with the
+// prefix, such as "billing:"
+func NewNamespace(prefix string, client Getter) *Namespace {
+	n := &Namespace{prefix: prefix}
+	n.Forwarder = NewRoutingForwarder(func(ctx context.Context, command string) (context.Context, Getter) {
+		return n.context(ctx), client
+	})
+	return n
+}
+
+// Prefix returns the prefix of the keys
+func (n *Namespace) Prefix() string {
+	return n.prefix
+}
+
+// Key returns the key prefixed
+func (n *Namespace) Key(key string) string {
+	return n.prefix + key
+}
+
+// Keys returns the keys prefixed
+func (n *Namespace) Keys(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = n.prefix + k
+	}
+	return prefixed
+}
+
+// Pattern returns the glob pattern, as used by SCAN MATCH and KEYS, matching
+// the keys matched by pattern in the namespace. The glob characters of the
+// prefix are escaped.
+func (n *Namespace) Pattern(pattern string) string {
+	var b strings.Builder
+	for _, r := range n.prefix {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + pattern
+}
+
+// Unprefix returns the key, as returned by a command such as SCAN, without
+// the prefix. Keys outside the namespace are returned unchanged.
+func (n *Namespace) Unprefix(key string) string {
+	return strings.TrimPrefix(key, n.prefix)
+}
+
+// Unprefixes returns the keys without the prefix
+func (n *Namespace) Unprefixes(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	unprefixed := make([]string, len(keys))
+	for i, k := range keys {
+		unprefixed[i] = strings.TrimPrefix(k, n.prefix)
+	}
+	return unprefixed
+}
+
+type namespaceKey struct{}
+
+// context tags the context with the namespace
+func (n *Namespace) context(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, namespaceKey{}, n.prefix)
+	if tagged, err := tag.New(ctx, tag.Upsert(GoRedisNamespace, n.prefix)); err == nil {
+		ctx = tagged
+	}
+	return ctx
+}
+
+// namespaceAttributes returns the attributes of the namespace of the call
+func namespaceAttributes(ctx context.Context) []trace.Attribute {
+	prefix, ok := ctx.Value(namespaceKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return []trace.Attribute{
+		trace.StringAttribute("redis.namespace", prefix),
+	}
+}
+
+// Get runs the redis get command in the namespace
+func (n *Namespace) Get(ctx context.Context, key string) StringCmd {
+	return n.Forwarder.Get(ctx, n.Key(key))
+}
+
+// Set runs the redis set command in the namespace
+func (n *Namespace) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd {
+	return n.Forwarder.Set(ctx, n.Key(key), value, expiration)
+}
+
+// Incr runs the redis incr command in the namespace
+func (n *Namespace) Incr(ctx context.Context, key string) IntCmd {
+	return n.Forwarder.Incr(ctx, n.Key(key))
+}
+
+// Del runs the redis del command in the namespace
+func (n *Namespace) Del(ctx context.Context, keys ...string) IntCmd {
+	return n.Forwarder.Del(ctx, n.Keys(keys)...)
+}
+
+// SetNX runs the redis setnx command in the namespace
+func (n *Namespace) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) BoolCmd {
+	return n.Forwarder.SetNX(ctx, n.Key(key), value, expiration)
+}
+
+// LPop runs the redis lpop command in the namespace
+func (n *Namespace) LPop(ctx context.Context, key string) StringCmd {
+	return n.Forwarder.LPop(ctx, n.Key(key))
+}
+
+// Expire runs the redis expire command in the namespace
+func (n *Namespace) Expire(ctx context.Context, key string, expiration time.Duration) BoolCmd {
+	return n.Forwarder.Expire(ctx, n.Key(key), expiration)
+}
+
+// ExpireAt runs the redis expireat command in the namespace
+func (n *Namespace) ExpireAt(ctx context.Context, key string, tm time.Time) BoolCmd {
+	return n.Forwarder.ExpireAt(ctx, n.Key(key), tm)
+}
+
+// HLen runs the redis hlen command in the namespace
+func (n *Namespace) HLen(ctx context.Context, key string) IntCmd {
+	return n.Forwarder.HLen(ctx, n.Key(key))
+}
+
+// HGet runs the redis hget command in the namespace
+func (n *Namespace) HGet(ctx context.Context, key, field string) StringCmd {
+	return n.Forwarder.HGet(ctx, n.Key(key), field)
+}
+
+// HSet runs the redis hset command in the namespace
+func (n *Namespace) HSet(ctx context.Context, key, field string, value interface{}) BoolCmd {
+	return n.Forwarder.HSet(ctx, n.Key(key), field, value)
+}
+
+// Eval runs the redis eval command with the keys in the namespace
+func (n *Namespace) Eval(ctx context.Context, script string, keys []string, args []string) RedisCmd {
+	return n.Forwarder.Eval(ctx, script, n.Keys(keys), args)
+}
+
+// EvalSha runs the redis evalsha command with the keys in the namespace
+func (n *Namespace) EvalSha(ctx context.Context, sha1 string, keys []string, args []string) RedisCmd {
+	return n.Forwarder.EvalSha(ctx, sha1, n.Keys(keys), args)
+}
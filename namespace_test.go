@@ -0,0 +1,114 @@
+package ocredis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v4 "github.com/KolbyMcGarrah/ocredis/v4"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	redis "gopkg.in/redis.v4"
+)
+
+func newTestNamespace(t *testing.T, prefix string) (*redistest.Server, *ocredis.Namespace, *octest.Exporter) {
+	t.Helper()
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		e.Unregister()
+		_ = s.Close()
+	})
+	c := v4.Wrap(client,
+		ocredis.WithAllTraceOptions(),
+		ocredis.WithAllowRoot(true),
+		ocredis.WithInstanceName("namespace"),
+	)
+	return s, ocredis.NewNamespace(prefix, c), e
+}
+
+func TestNamespaceDelPrefixesEveryKey(t *testing.T) {
+	s, n, e := newTestNamespace(t, "billing:")
+	ctx := context.Background()
+	for _, key := range []string{"billing:a", "billing:b", "a", "b"} {
+		s.Set(key, "value")
+	}
+
+	if deleted, err := n.Del(ctx, "a", "b", "missing").Result(); err != nil || deleted != 2 {
+		t.Fatalf("Del = %d, %v, want 2", deleted, err)
+	}
+	for key, want := range map[string]bool{"billing:a": false, "billing:b": false, "a": true, "b": true} {
+		if got := s.Exists(key); got != want {
+			t.Errorf("Exists(%s) = %v, want %v", key, got, want)
+		}
+	}
+	e.AssertSpan(t, "go.redis.del", map[string]interface{}{"redis.namespace": "billing:"}, trace.StatusCodeOK)
+}
+
+func TestNamespaceEvalPrefixesKeysOnly(t *testing.T) {
+	s, n, _ := newTestNamespace(t, "billing:")
+	var gotKeys, gotArgs []string
+	s.RegisterScript(incrBySrc, func(keys, args []string) (interface{}, error) {
+		gotKeys, gotArgs = keys, args
+		return 42, nil
+	})
+
+	keys, args := []string{"counter", "total"}, []string{"counter", "1"}
+	if err := n.Eval(context.Background(), incrBySrc, keys, args).Err(); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if want := []string{"billing:counter", "billing:total"}; !reflect.DeepEqual(gotKeys, want) {
+		t.Errorf("script received the keys %v, want %v", gotKeys, want)
+	}
+	if !reflect.DeepEqual(gotArgs, args) {
+		t.Errorf("script received the arguments %v, want them unchanged %v", gotArgs, args)
+	}
+	// the caller's slice isn't modified
+	if keys[0] != "counter" {
+		t.Errorf("Eval modified the keys of the caller: %v", keys)
+	}
+
+	gotKeys = nil
+	script := ocredis.NewScript("incrby", incrBySrc)
+	if err := script.Run(context.Background(), n, []string{"counter"}, nil).Err(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := []string{"billing:counter"}; !reflect.DeepEqual(gotKeys, want) {
+		t.Errorf("EvalSha passed the keys %v, want %v", gotKeys, want)
+	}
+}
+
+func TestNamespaceCallsView(t *testing.T) {
+	_, n, e := newTestNamespace(t, "billing:")
+	ctx := context.Background()
+	n.Set(ctx, "key", "value", 0)
+	n.Get(ctx, "key")
+
+	rows, err := e.Rows(ocredis.GoRedisNamespaceCallsView)
+	if err != nil {
+		t.Fatalf("reading the namespace calls: %v", err)
+	}
+	var calls int64
+	for _, row := range rows {
+		for _, tg := range row.Tags {
+			if tg == (tag.Tag{Key: ocredis.GoRedisNamespace, Value: "billing:"}) {
+				calls += row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if calls != 2 {
+		t.Errorf("counted %d calls in the namespace, want 2", calls)
+	}
+}
@@ -0,0 +1,434 @@
+package ocredis
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// The defaults of NearCacheOptions
+const (
+	DefaultNearCacheMaxEntries = 10000
+	DefaultNearCacheTTL        = time.Minute
+)
+
+// The values of the GoRedisNearCache tag
+const (
+	NearCacheHit  = "hit"
+	NearCacheMiss = "miss"
+)
+
+// statusNearCacheHit is the GoRedisStatus of the reads served by a NearCache
+const statusNearCacheHit = "L1_HIT"
+
+// NearCacheOptions configures a NearCache. Zero fields use the defaults.
+type NearCacheOptions struct {
+	// MaxEntries bounds the number of values kept
+	MaxEntries int
+
+	// TTL bounds the time a value is kept, and so how stale it can be when
+	// an invalidation is lost
+	TTL time.Duration
+}
+
+// InvalidationOptions selects the pub/sub messages invalidating a NearCache
+type InvalidationOptions struct {
+	// Channel, if set, is the channel the keys written through the near
+	// caches are published on, one message per key
+	Channel string
+
+	// Keyspace, if set to true, subscribes to the keyspace notifications of
+	// the database DB. Redis must be configured to send them, such as with
+	// notify-keyspace-events K$hgx.
+	Keyspace bool
+	DB       int
+
+	// ErrorLogger, if set, is called with the errors receiving the messages.
+	// The near cache is purged on each of them.
+	ErrorLogger func(err error)
+}
+
+// NearCache keeps the values read with Get and HGet in process, in front of
+// a wrapped client. Values are evicted in least recently used order, and
+// once the cache is full a value is only admitted when it's read more often
+// than the value it would evict, as estimated by a count-min sketch.
+//
+// Writes through the near cache invalidate the keys they modify. Writes by
+// other processes are only seen once the keys are invalidated, see the
+// SubscribeInvalidations functions of the wrapper packages, or the values
+// expire. CLIENT TRACKING isn't supported as the supported redis clients
+// can't parse its invalidation messages.
+//
+// The reads served by the near cache are recorded with the L1_HIT
+// GoRedisStatus and the instance name of the client, see InstanceName. The
+// calls of the reads it didn't serve are tagged with the GoRedisNearCache
+// tag. Missing keys aren't cached. Commands not implemented by the client
+// return ErrUnsupportedCommand.
+type NearCache struct {
+	Forwarder
+
+	instanceName string
+	options      NearCacheOptions
+	now          func() time.Time
+
+	mu      sync.Mutex
+	entries map[nearCacheKey]*list.Element
+	lru     *list.List
+	fields  map[string]map[string]struct{}
+	sketch  *frequencySketch
+
+	// generation is incremented by every invalidation. A value read from
+	// redis is only cached when no invalidation happened during the read.
+	generation uint64
+	publish    func(keys []string)
+}
+
+var (
+	_ Client   = &NearCache{}
+	_ Cmdable  = &NearCache{}
+	_ Scripter = &NearCache{}
+)
+
+type nearCacheKey struct {
+	key   string
+	field string
+	hash  bool
+}
+
+type nearCacheEntry struct {
+	id      nearCacheKey
+	value   string
+	expires time.Time
+}
+
+// NewNearCache returns a near cache in front of client
+func NewNearCache(client Getter, options NearCacheOptions) *NearCache {
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultNearCacheMaxEntries
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultNearCacheTTL
+	}
+	return &NearCache{
+		Forwarder:    NewForwarder(client),
+		instanceName: InstanceName(client),
+		options:      options,
+		now:          time.Now,
+		entries:      map[nearCacheKey]*list.Element{},
+		lru:          list.New(),
+		fields:       map[string]map[string]struct{}{},
+		sketch:       newFrequencySketch(options.MaxEntries),
+	}
+}
+
+// SetPublisher sets the function the keys modified by writes through the
+// near cache are passed to, to invalidate them in the other processes
+func (n *NearCache) SetPublisher(publish func(keys []string)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.publish = publish
+}
+
+// Invalidate drops the values of the keys, including every field of hashes
+func (n *NearCache) Invalidate(keys ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.generation++
+	for _, key := range keys {
+		n.remove(nearCacheKey{key: key})
+		for field := range n.fields[key] {
+			n.remove(nearCacheKey{key: key, field: field, hash: true})
+		}
+	}
+}
+
+// Purge drops every value, for instance when invalidations may have been
+// lost
+func (n *NearCache) Purge() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.generation++
+	n.entries = map[nearCacheKey]*list.Element{}
+	n.fields = map[string]map[string]struct{}{}
+	n.lru.Init()
+}
+
+// Len returns the number of values kept
+func (n *NearCache) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.lru.Len()
+}
+
+// HandleInvalidation invalidates the key of an invalidation message. The
+// key of keyspace notifications, published on channels such as
+// __keyspace@0__:key, is read from the channel, and otherwise the payload is
+// the key.
+func (n *NearCache) HandleInvalidation(channel, payload string) {
+	if strings.HasPrefix(channel, "__keyspace@") {
+		if i := strings.Index(channel, "__:"); i >= 0 {
+			n.Invalidate(channel[i+len("__:"):])
+		}
+		return
+	}
+	n.Invalidate(payload)
+}
+
+// lookup returns the value of the entry and the current generation
+func (n *NearCache) lookup(id nearCacheKey) (value string, ok bool, generation uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sketch.increment(id)
+	if e, found := n.entries[id]; found {
+		entry := e.Value.(*nearCacheEntry)
+		if n.now().Before(entry.expires) {
+			n.lru.MoveToFront(e)
+			return entry.value, true, n.generation
+		}
+		n.remove(id)
+	}
+	return "", false, n.generation
+}
+
+// store caches the value unless an invalidation happened since generation
+// or the admission policy rejects it
+func (n *NearCache) store(id nearCacheKey, value string, generation uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if generation != n.generation {
+		return
+	}
+	if e, ok := n.entries[id]; ok {
+		entry := e.Value.(*nearCacheEntry)
+		entry.value, entry.expires = value, n.now().Add(n.options.TTL)
+		n.lru.MoveToFront(e)
+		return
+	}
+	if n.lru.Len() >= n.options.MaxEntries {
+		victim := n.lru.Back().Value.(*nearCacheEntry)
+		if n.sketch.estimate(id) <= n.sketch.estimate(victim.id) {
+			return
+		}
+		n.remove(victim.id)
+	}
+	n.entries[id] = n.lru.PushFront(&nearCacheEntry{
+		id:      id,
+		value:   value,
+		expires: n.now().Add(n.options.TTL),
+	})
+	if id.hash {
+		if n.fields[id.key] == nil {
+			n.fields[id.key] = map[string]struct{}{}
+		}
+		n.fields[id.key][id.field] = struct{}{}
+	}
+}
+
+// remove drops the entry, the lock must be held
+func (n *NearCache) remove(id nearCacheKey) {
+	e, ok := n.entries[id]
+	if !ok {
+		return
+	}
+	n.lru.Remove(e)
+	delete(n.entries, id)
+	if id.hash {
+		delete(n.fields[id.key], id.field)
+		if len(n.fields[id.key]) == 0 {
+			delete(n.fields, id.key)
+		}
+	}
+}
+
+// read serves the read from the near cache or from the client
+func (n *NearCache) read(ctx context.Context, command string, id nearCacheKey, read func(ctx context.Context) StringCmd) StringCmd {
+	method := MethodPrefix + command
+	var span *trace.Span
+	if AllowTrace(ctx, true, false) {
+		ctx, span = trace.StartSpan(ctx, MethodPrefix+"nearcache."+command, trace.WithSpanKind(trace.SpanKindClient))
+		defer span.End()
+	}
+	start := time.Now()
+	value, ok, generation := n.lookup(id)
+	if ok {
+		if span != nil {
+			span.AddAttributes(trace.StringAttribute("redis.near_cache", NearCacheHit))
+		}
+		n.recordHit(ctx, method, start, value)
+		return NewStringResult(value, nil)
+	}
+	if span != nil {
+		span.AddAttributes(trace.StringAttribute("redis.near_cache", NearCacheMiss))
+	}
+	if tagged, err := tag.New(ctx, tag.Upsert(GoRedisNearCache, NearCacheMiss)); err == nil {
+		ctx = tagged
+	}
+	cmd := read(ctx)
+	if cmd.Err() == nil {
+		n.store(id, cmd.Val(), generation)
+	}
+	return cmd
+}
+
+// recordHit records the stats of a read served by the near cache
+func (n *NearCache) recordHit(ctx context.Context, method string, start time.Time, value string) {
+	tags := []tag.Mutator{
+		tag.Insert(GoRedisInstanceName, n.instanceName),
+		tag.Insert(GoRedisMethod, method),
+		tag.Insert(GoRedisStatus, statusNearCacheHit),
+		tag.Upsert(GoRedisNearCache, NearCacheHit),
+	}
+	_ = stats.RecordWithTags(ctx, tags,
+		MeasureLatencyMs.M(time.Since(start).Milliseconds()),
+		MeasureResponseBytes.M(int64(len(value))),
+	)
+}
+
+// wrote invalidates the keys modified by a write and publishes them
+func (n *NearCache) wrote(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	n.Invalidate(keys...)
+	n.mu.Lock()
+	publish := n.publish
+	n.mu.Unlock()
+	if publish != nil {
+		publish(keys)
+	}
+}
+
+// frequencySketch estimates how often keys are read with a count-min sketch
+// whose counters are halved periodically, so the estimates favor recent
+// reads
+type frequencySketch struct {
+	rows      [4][]uint8
+	additions int
+	resetAt   int
+}
+
+func newFrequencySketch(entries int) *frequencySketch {
+	s := &frequencySketch{resetAt: 10 * entries}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, 4*entries)
+	}
+	return s
+}
+
+func (s *frequencySketch) index(id nearCacheKey, row int) int {
+	h1, h2 := keyHashes(id.key + "\x00" + id.field)
+	return int((h1 + uint32(row)*h2) % uint32(len(s.rows[row])))
+}
+
+func (s *frequencySketch) increment(id nearCacheKey) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(id, i)]; *c < 255 {
+			*c++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for _, row := range s.rows {
+			for j := range row {
+				row[j] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(id nearCacheKey) uint8 {
+	var min uint8 = 255
+	for i := range s.rows {
+		if c := s.rows[i][s.index(id, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// Get serves the redis get command from the near cache
+func (n *NearCache) Get(ctx context.Context, key string) StringCmd {
+	return n.read(ctx, "get", nearCacheKey{key: key}, func(ctx context.Context) StringCmd {
+		return n.Forwarder.Get(ctx, key)
+	})
+}
+
+// HGet serves the redis hget command from the near cache
+func (n *NearCache) HGet(ctx context.Context, key, field string) StringCmd {
+	return n.read(ctx, "hget", nearCacheKey{key: key, field: field, hash: true}, func(ctx context.Context) StringCmd {
+		return n.Forwarder.HGet(ctx, key, field)
+	})
+}
+
+// Set runs the redis set command and invalidates the key
+func (n *NearCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd {
+	defer n.wrote(key)
+	return n.Forwarder.Set(ctx, key, value, expiration)
+}
+
+// Incr runs the redis incr command and invalidates the key
+func (n *NearCache) Incr(ctx context.Context, key string) IntCmd {
+	defer n.wrote(key)
+	return n.Forwarder.Incr(ctx, key)
+}
+
+// Del runs the redis del command and invalidates the keys
+func (n *NearCache) Del(ctx context.Context, keys ...string) IntCmd {
+	defer n.wrote(keys...)
+	return n.Forwarder.Del(ctx, keys...)
+}
+
+// SetNX runs the redis setnx command and invalidates the key
+func (n *NearCache) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) BoolCmd {
+	defer n.wrote(key)
+	return n.Forwarder.SetNX(ctx, key, value, expiration)
+}
+
+// Close drops every value and closes the client
+func (n *NearCache) Close(ctx context.Context) error {
+	n.Purge()
+	return n.Forwarder.Close(ctx)
+}
+
+// LPop runs the redis lpop command and invalidates the key
+func (n *NearCache) LPop(ctx context.Context, key string) StringCmd {
+	defer n.wrote(key)
+	return n.Forwarder.LPop(ctx, key)
+}
+
+// Expire runs the redis expire command and invalidates the key
+func (n *NearCache) Expire(ctx context.Context, key string, expiration time.Duration) BoolCmd {
+	defer n.wrote(key)
+	return n.Forwarder.Expire(ctx, key, expiration)
+}
+
+// ExpireAt runs the redis expireat command and invalidates the key
+func (n *NearCache) ExpireAt(ctx context.Context, key string, tm time.Time) BoolCmd {
+	defer n.wrote(key)
+	return n.Forwarder.ExpireAt(ctx, key, tm)
+}
+
+// HSet runs the redis hset command and invalidates the key
+func (n *NearCache) HSet(ctx context.Context, key, field string, value interface{}) BoolCmd {
+	defer n.wrote(key)
+	return n.Forwarder.HSet(ctx, key, field, value)
+}
+
+// Eval runs the redis eval command and invalidates the keys
+func (n *NearCache) Eval(ctx context.Context, script string, keys []string, args []string) RedisCmd {
+	defer n.wrote(keys...)
+	return n.Forwarder.Eval(ctx, script, keys, args)
+}
+
+// EvalSha runs the redis evalsha command and invalidates the keys
+func (n *NearCache) EvalSha(ctx context.Context, sha1 string, keys []string, args []string) RedisCmd {
+	defer n.wrote(keys...)
+	return n.Forwarder.EvalSha(ctx, sha1, keys, args)
+}
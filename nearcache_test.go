@@ -0,0 +1,337 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memClient is an in-memory client counting the reads it serves
+type memClient struct {
+	mu     sync.Mutex
+	values map[string]string
+	reads  int
+
+	// onRead, if set, runs during each read
+	onRead func()
+}
+
+func newMemClient() *memClient {
+	return &memClient{values: map[string]string{}}
+}
+
+func (c *memClient) Get(ctx context.Context, key string) StringCmd {
+	return c.read(key)
+}
+
+func (c *memClient) HGet(ctx context.Context, key, field string) StringCmd {
+	return c.read(key + "/" + field)
+}
+
+func (c *memClient) read(key string) StringCmd {
+	if c.onRead != nil {
+		c.onRead()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads++
+	v, ok := c.values[key]
+	if !ok {
+		return NewStringResult("", errors.New("redis: nil"))
+	}
+	return NewStringResult(v, nil)
+}
+
+func (c *memClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value.(string)
+	return NewStatusResult("OK", nil)
+}
+
+func (c *memClient) HSet(ctx context.Context, key, field string, value interface{}) BoolCmd {
+	c.Set(ctx, key+"/"+field, value, 0)
+	return NewBoolResult(true, nil)
+}
+
+func (c *memClient) InstanceName() string {
+	return "mem"
+}
+
+func (c *memClient) readCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reads
+}
+
+func TestNearCacheServesReads(t *testing.T) {
+	ctx := context.Background()
+	c := newMemClient()
+	c.Set(ctx, "key", "value", 0)
+	n := NewNearCache(c, NearCacheOptions{})
+
+	for i := 0; i < 3; i++ {
+		if v, err := n.Get(ctx, "key").Result(); err != nil || v != "value" {
+			t.Fatalf("Get = %q, %v, want value", v, err)
+		}
+	}
+	if got := c.readCount(); got != 1 {
+		t.Errorf("client served %d reads, want 1", got)
+	}
+	// missing keys aren't cached
+	n.Get(ctx, "missing")
+	n.Get(ctx, "missing")
+	if got := c.readCount(); got != 3 {
+		t.Errorf("client served %d reads, want 3", got)
+	}
+	if name := n.instanceName; name != "mem" {
+		t.Errorf("instance name = %q, want the name of the client", name)
+	}
+	if name := NewNearCache(&nodeClient{}, NearCacheOptions{}).instanceName; name != DefaultInstanceName {
+		t.Errorf("instance name without InstanceNamer = %q, want %q", name, DefaultInstanceName)
+	}
+}
+
+func TestNearCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	c := newMemClient()
+	c.Set(ctx, "key", "old", 0)
+	n := NewNearCache(c, NearCacheOptions{TTL: time.Minute})
+	now := time.Now()
+	n.now = func() time.Time { return now }
+
+	n.Get(ctx, "key")
+	c.Set(ctx, "key", "new", 0)
+	now = now.Add(59 * time.Second)
+	if v := n.Get(ctx, "key").Val(); v != "old" {
+		t.Errorf("Get before the TTL = %q, want the cached old", v)
+	}
+	now = now.Add(time.Second)
+	if v := n.Get(ctx, "key").Val(); v != "new" {
+		t.Errorf("Get after the TTL = %q, want new", v)
+	}
+}
+
+func TestNearCacheAdmission(t *testing.T) {
+	ctx := context.Background()
+	c := newMemClient()
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(ctx, key, key, 0)
+	}
+	n := NewNearCache(c, NearCacheOptions{MaxEntries: 2})
+	for i := 0; i < 5; i++ {
+		n.Get(ctx, "a")
+		n.Get(ctx, "b")
+	}
+
+	// c is read less often than a, the least recently used value
+	n.Get(ctx, "c")
+	if _, ok, _ := n.lookup(nearCacheKey{key: "c"}); ok {
+		t.Error("a value read once was admitted over frequently read values")
+	}
+	if n.Len() != 2 {
+		t.Errorf("Len = %d, want 2", n.Len())
+	}
+
+	// once read more often than a, c evicts it
+	for i := 0; i < 10; i++ {
+		n.Get(ctx, "c")
+	}
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		n.mu.Lock()
+		_, ok := n.entries[nearCacheKey{key: key}]
+		n.mu.Unlock()
+		if ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestNearCacheGeneration(t *testing.T) {
+	ctx := context.Background()
+	c := newMemClient()
+	c.Set(ctx, "key", "stale", 0)
+	n := NewNearCache(c, NearCacheOptions{})
+
+	// an invalidation during the read keeps the value it returned out of
+	// the near cache
+	c.onRead = func() { n.Invalidate("other") }
+	if v := n.Get(ctx, "key").Val(); v != "stale" {
+		t.Fatalf("Get = %q, want stale", v)
+	}
+	c.onRead = nil
+	if n.Len() != 0 {
+		t.Errorf("a value read during an invalidation was cached")
+	}
+	n.Get(ctx, "key")
+	if n.Len() != 1 {
+		t.Errorf("Len = %d after a read without invalidation, want 1", n.Len())
+	}
+}
+
+func TestNearCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c := newMemClient()
+	n := NewNearCache(c, NearCacheOptions{})
+	var published []string
+	n.SetPublisher(func(keys []string) { published = append(published, keys...) })
+
+	c.Set(ctx, "key", "old", 0)
+	n.Get(ctx, "key")
+	n.Set(ctx, "key", "new", 0)
+	if v := n.Get(ctx, "key").Val(); v != "new" {
+		t.Errorf("Get after Set = %q, want new", v)
+	}
+
+	// every field of a hash is invalidated
+	c.HSet(ctx, "hash", "a", "a")
+	c.HSet(ctx, "hash", "b", "b")
+	n.HGet(ctx, "hash", "a")
+	n.HGet(ctx, "hash", "b")
+	n.HSet(ctx, "hash", "a", "a2")
+	if n.Len() != 1 {
+		t.Errorf("Len = %d after HSet, want the string value only", n.Len())
+	}
+	if want := []string{"key", "hash"}; !reflect.DeepEqual(published, want) {
+		t.Errorf("published %v, want %v", published, want)
+	}
+
+	// keyspace notifications name the key in the channel
+	n.HandleInvalidation("__keyspace@0__:key", "set")
+	n.Get(ctx, "hash")
+	n.HandleInvalidation("invalidations", "hash")
+	if n.Len() != 0 {
+		t.Errorf("Len = %d after the invalidations, want 0", n.Len())
+	}
+}
+
+// fakePubSub delivers the messages sent on its channel
+type fakePubSub struct {
+	messages chan [2]string
+	closed   chan struct{}
+
+	mu         sync.Mutex
+	subscribed []string
+	published  []string
+}
+
+func newFakePubSub() *fakePubSub {
+	return &fakePubSub{messages: make(chan [2]string), closed: make(chan struct{})}
+}
+
+func (p *fakePubSub) Subscribe(channels ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribed = append(p.subscribed, channels...)
+	return nil
+}
+
+func (p *fakePubSub) PSubscribe(patterns ...string) error {
+	return p.Subscribe(patterns...)
+}
+
+func (p *fakePubSub) ReceiveMessage() (string, string, error) {
+	select {
+	case m := <-p.messages:
+		if m[0] == "" {
+			return "", "", errors.New("connection reset")
+		}
+		return m[0], m[1], nil
+	case <-p.closed:
+		return "", "", errors.New("closed")
+	}
+}
+
+func (p *fakePubSub) Publish(channel, message string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, channel+" "+message)
+	return nil
+}
+
+func (p *fakePubSub) Close() error {
+	close(p.closed)
+	return nil
+}
+
+func TestSubscribeInvalidations(t *testing.T) {
+	ctx := context.Background()
+	c := newMemClient()
+	c.Set(ctx, "a", "a", 0)
+	c.Set(ctx, "b", "b", 0)
+	n := NewNearCache(c, NearCacheOptions{})
+	p := newFakePubSub()
+
+	if _, err := SubscribeInvalidations(n, newFakePubSub(), InvalidationOptions{}); err == nil {
+		t.Error("SubscribeInvalidations without a channel nor keyspace notifications succeeded")
+	}
+	s, err := SubscribeInvalidations(n, p, InvalidationOptions{Channel: "invalidations", Keyspace: true, DB: 2})
+	if err != nil {
+		t.Fatalf("SubscribeInvalidations: %v", err)
+	}
+	if want := []string{"invalidations", "__keyspace@2__:*"}; !reflect.DeepEqual(p.subscribed, want) {
+		t.Errorf("subscribed to %v, want %v", p.subscribed, want)
+	}
+
+	n.Get(ctx, "a")
+	n.Get(ctx, "b")
+	p.messages <- [2]string{"invalidations", "a"}
+	// the message is handled before the next one is received
+	p.messages <- [2]string{"__keyspace@2__:other", "set"}
+	if n.Len() != 1 {
+		t.Errorf("Len = %d after invalidating a, want 1", n.Len())
+	}
+	// a receive failure purges the near cache
+	p.messages <- [2]string{}
+	p.messages <- [2]string{"__keyspace@2__:other", "set"}
+	if n.Len() != 0 {
+		t.Errorf("Len = %d after a receive failure, want 0", n.Len())
+	}
+
+	n.Set(ctx, "a", "a2", 0)
+	p.mu.Lock()
+	published := append([]string(nil), p.published...)
+	p.mu.Unlock()
+	if want := []string{"invalidations a"}; !reflect.DeepEqual(published, want) {
+		t.Errorf("published %v, want %v", published, want)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	// the keys written once closed aren't published
+	n.Set(ctx, "b", "b2", 0)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.published) != 1 {
+		t.Errorf("published %v after Close, want nothing more", p.published[1:])
+	}
+}
+
+func TestSubscribeInvalidationsBackoff(t *testing.T) {
+	defer func(b RetryPolicy) { invalidationBackoff = b }(invalidationBackoff)
+	invalidationBackoff = RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	p := newFakePubSub()
+	failures := make(chan time.Time)
+	s, err := SubscribeInvalidations(NewNearCache(newMemClient(), NearCacheOptions{}), p, InvalidationOptions{
+		Channel:     "invalidations",
+		ErrorLogger: func(err error) { failures <- time.Now() },
+	})
+	if err != nil {
+		t.Fatalf("SubscribeInvalidations: %v", err)
+	}
+	defer s.Close()
+
+	// the wait after each failure doubles up to the maximum backoff
+	var last time.Time
+	for i, want := range []time.Duration{0, 10, 20, 40, 40} {
+		p.messages <- [2]string{}
+		failed := <-failures
+		if gap := failed.Sub(last); i > 0 && gap < want*time.Millisecond {
+			t.Errorf("failure %d received %v after the previous one, want at least %dms", i+1, gap, want)
+		}
+		last = failed
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
-	"gopkg.in/redis.v3"
 )
 
 const (
@@ -15,6 +14,15 @@ const (
 	statusOK    = "OK"
 )
 
+// nilMessage is the message of the error returned by every supported redis
+// version when a key doesn't exist
+const nilMessage = "redis: nil"
+
+// IsNil reports whether err is the redis.Nil error of any redis version
+func IsNil(err error) bool {
+	return err != nil && err.Error() == nilMessage
+}
+
 // The following tags are aooplied to stats recorded by this package
 var (
 	// GoRedisName is the name of the redis instance.
@@ -26,6 +34,41 @@ var (
 	// GoRedisStatus identifies the command status
 	GoRedisStatus, _ = tag.NewKey("go_redis_status")
 
+	// GoRedisKeyPattern is the pattern of the first key of the command. It's
+	// only set when a KeyPatternFunc is configured.
+	GoRedisKeyPattern, _ = tag.NewKey("go_redis_key_pattern")
+
+	// GoRedisErrorType is the type of the error of failed commands, see
+	// ClassifyError
+	GoRedisErrorType, _ = tag.NewKey("go_redis_error_type")
+
+	// GoRedisHedgeWinner is the attempt that replied first to a hedged read,
+	// the primary or the replica
+	GoRedisHedgeWinner, _ = tag.NewKey("go_redis_hedge_winner")
+
+	// GoRedisMismatch is the reason the destination of a migration disagreed
+	// with the source, see Migrator
+	GoRedisMismatch, _ = tag.NewKey("go_redis_mismatch")
+
+	// GoRedisNamespace is the key prefix of the calls made through a
+	// Namespace
+	GoRedisNamespace, _ = tag.NewKey("go_redis_namespace")
+
+	// GoRedisCompression is the compression algorithm of a value
+	GoRedisCompression, _ = tag.NewKey("go_redis_compression")
+
+	// GoRedisNearCache tells the reads served by a NearCache, tagged hit,
+	// from the reads it sent to redis, tagged miss
+	GoRedisNearCache, _ = tag.NewKey("go_redis_near_cache")
+
+	// GoRedisCommand is the server command of the command stats scraped from
+	// INFO commandstats, such as "get"
+	GoRedisCommand, _ = tag.NewKey("go_redis_command")
+
+	// GoRedisDB is the database of the keyspace stats scraped from INFO
+	// keyspace, such as "db0"
+	GoRedisDB, _ = tag.NewKey("go_redis_db")
+
 	DefaultTags = []tag.Key{
 		GoRedisMethod,
 		GoRedisStatus,
@@ -34,8 +77,34 @@ var (
 
 // The following measures are supported for use in custom views.
 var (
-	MeasureLatencyMs     = stats.Int64("go.redis/latency", "The latency of calls in milliseconds", stats.UnitMilliseconds)
-	MeasureResponseBytes = stats.Int64("go.redis/received_bytes", "The number of bytes returned from a command", stats.UnitBytes)
+	MeasureLatencyMs         = stats.Int64("go.redis/latency", "The latency of calls in milliseconds", stats.UnitMilliseconds)
+	MeasureResponseBytes     = stats.Int64("go.redis/received_bytes", "The number of bytes returned from a command", stats.UnitBytes)
+	MeasureErrors            = stats.Int64("go.redis/errors", "The number of failed calls", stats.UnitDimensionless)
+	MeasureRetries           = stats.Int64("go.redis/retries", "The number of retries of failed calls", stats.UnitDimensionless)
+	MeasureCircuitState      = stats.Int64("go.redis/circuit_state", "The state of the circuit breaker: 0 closed, 1 half-open, 2 open", stats.UnitDimensionless)
+	MeasureHedges            = stats.Int64("go.redis/hedges", "The number of hedged reads", stats.UnitDimensionless)
+	MeasureMismatches        = stats.Int64("go.redis/mismatches", "The number of migration mismatches between the source and the destination", stats.UnitDimensionless)
+	MeasureCompressionRatio  = stats.Float64("go.redis/compression_ratio", "The size of values before compression divided by their compressed size", stats.UnitDimensionless)
+	MeasureCompressionTimeMs = stats.Float64("go.redis/compression_time", "The time spent compressing or decompressing values in milliseconds", stats.UnitMilliseconds)
+	MeasureHealthy           = stats.Int64("go.redis/healthy", "1 when the health checks of the instance pass, 0 otherwise", stats.UnitDimensionless)
+	MeasureHealthFailures    = stats.Int64("go.redis/health_failures", "The number of consecutive failed health checks", stats.UnitDimensionless)
+	MeasurePingRTTMs         = stats.Float64("go.redis/ping_rtt", "The round trip time of health check pings in milliseconds", stats.UnitMilliseconds)
+	MeasureSlowCalls         = stats.Int64("go.redis/slow_calls", "The number of calls exceeding the slow threshold", stats.UnitDimensionless)
+)
+
+// The following measures are recorded from the INFO of the servers, see the
+// serverinfo package. The counters are recorded as the increase since the
+// previous scrape.
+var (
+	MeasureServerUsedMemory        = stats.Int64("go.redis/server/used_memory", "The memory allocated by the server", stats.UnitBytes)
+	MeasureServerConnectedClients  = stats.Int64("go.redis/server/connected_clients", "The number of client connections of the server", stats.UnitDimensionless)
+	MeasureServerConnectedReplicas = stats.Int64("go.redis/server/connected_replicas", "The number of replicas connected to the server", stats.UnitDimensionless)
+	MeasureServerKeys              = stats.Int64("go.redis/server/keys", "The number of keys of a database", stats.UnitDimensionless)
+	MeasureServerEvictedKeys       = stats.Int64("go.redis/server/evicted_keys", "The number of keys evicted because of the maxmemory limit", stats.UnitDimensionless)
+	MeasureServerKeyspaceHits      = stats.Int64("go.redis/server/keyspace_hits", "The number of successful lookups of keys", stats.UnitDimensionless)
+	MeasureServerKeyspaceMisses    = stats.Int64("go.redis/server/keyspace_misses", "The number of failed lookups of keys", stats.UnitDimensionless)
+	MeasureServerCommandCalls      = stats.Int64("go.redis/server/command_calls", "The number of calls of a command by the server", stats.UnitDimensionless)
+	MeasureServerCommandUsec       = stats.Int64("go.redis/server/command_usec", "The CPU time spent by the server running a command in microseconds", "us")
 )
 
 // Default distributions used by views in this package
@@ -55,6 +124,8 @@ var (
 		1073741824,
 		4294967296,
 	)
+	DefaultRatioDistribution = view.Distribution(1, 1.25, 1.5, 2, 3, 4, 6, 8, 12, 16, 32)
+
 	DefaultMillisecondsDistribution = view.Distribution(
 		0.0,
 		0.001,
@@ -118,10 +189,242 @@ var (
 		TagKeys:     DefaultTags,
 	}
 
-	DefaultViews = []*view.View{GoRedisLatencyView, GoRedisCallsView, GoRedisBytesView}
+	GoRedisSlowCallsView = &view.View{
+		Name:        "go.redis/client/slow_calls",
+		Description: "The number of calls exceeding the slow threshold",
+		Measure:     MeasureSlowCalls,
+		Aggregation: view.Count(),
+		TagKeys:     DefaultTags,
+	}
+
+	GoRedisErrorsView = &view.View{
+		Name:        "go.redis/client/errors",
+		Description: "The number of failed calls by error type",
+		Measure:     MeasureErrors,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisErrorType},
+	}
+
+	GoRedisRetriesView = &view.View{
+		Name:        "go.redis/client/retries",
+		Description: "The number of retries by the error type of the failed attempt",
+		Measure:     MeasureRetries,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisErrorType},
+	}
+
+	GoRedisCircuitStateView = &view.View{
+		Name:        "go.redis/client/circuit_state",
+		Description: "The state of the circuit breaker of each instance: 0 closed, 1 half-open, 2 open",
+		Measure:     MeasureCircuitState,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisHedgesView = &view.View{
+		Name:        "go.redis/client/hedges",
+		Description: "The number of hedged reads by the attempt replying first",
+		Measure:     MeasureHedges,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisHedgeWinner},
+	}
+
+	GoRedisMismatchesView = &view.View{
+		Name:        "go.redis/client/mismatches",
+		Description: "The number of migration mismatches by reason",
+		Measure:     MeasureMismatches,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisMismatch},
+	}
+
+	GoRedisCompressionRatioView = &view.View{
+		Name:        "go.redis/client/compression_ratio",
+		Description: "The distribution of the compression ratio of values by algorithm",
+		Measure:     MeasureCompressionRatio,
+		Aggregation: DefaultRatioDistribution,
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisCompression},
+	}
+
+	GoRedisCompressionTimeView = &view.View{
+		Name:        "go.redis/client/compression_time",
+		Description: "The distribution of the time spent compressing and decompressing values in milliseconds",
+		Measure:     MeasureCompressionTimeMs,
+		Aggregation: DefaultMillisecondsDistribution,
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisCompression},
+	}
+
+	GoRedisHealthyView = &view.View{
+		Name:        "go.redis/client/healthy",
+		Description: "Whether the health checks of each instance pass: 1 healthy, 0 unhealthy",
+		Measure:     MeasureHealthy,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisHealthFailuresView = &view.View{
+		Name:        "go.redis/client/health_failures",
+		Description: "The number of consecutive failed health checks of each instance",
+		Measure:     MeasureHealthFailures,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisPingRTTView = &view.View{
+		Name:        "go.redis/client/ping_rtt",
+		Description: "The round trip time of the last health check ping of each instance in milliseconds",
+		Measure:     MeasurePingRTTMs,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	// GoRedisNearCacheView counts the reads of near caches made through a
+	// NearCache
+	GoRedisNearCacheView = &view.View{
+		Name:        "go.redis/client/near_cache",
+		Description: "The number of reads of near caches by whether the near cache served them",
+		Measure:     MeasureLatencyMs,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{GoRedisMethod, GoRedisNearCache},
+	}
+
+	// GoRedisKeyPatternLatencyView breaks down latency by the key patterns of
+	// the WithKeyPattern option
+	GoRedisKeyPatternLatencyView = &view.View{
+		Name:        "go.redis/client/key_pattern_latency",
+		Description: "The distribution of latency of calls by key pattern in milliseconds",
+		Measure:     MeasureLatencyMs,
+		Aggregation: DefaultMillisecondsDistribution,
+		TagKeys:     append([]tag.Key{GoRedisKeyPattern}, DefaultTags...),
+	}
+
+	// GoRedisNamespaceCallsView counts calls by namespace. The calls not
+	// made through a Namespace have an empty namespace.
+	GoRedisNamespaceCallsView = &view.View{
+		Name:        "go.redis/client/namespace_calls",
+		Description: "The number of calls by namespace",
+		Measure:     MeasureLatencyMs,
+		Aggregation: view.Count(),
+		TagKeys:     append([]tag.Key{GoRedisNamespace}, DefaultTags...),
+	}
+
+	GoRedisServerUsedMemoryView = &view.View{
+		Name:        "go.redis/server/used_memory",
+		Description: "The memory allocated by each server",
+		Measure:     MeasureServerUsedMemory,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisServerConnectedClientsView = &view.View{
+		Name:        "go.redis/server/connected_clients",
+		Description: "The number of client connections of each server",
+		Measure:     MeasureServerConnectedClients,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisServerConnectedReplicasView = &view.View{
+		Name:        "go.redis/server/connected_replicas",
+		Description: "The number of replicas connected to each server",
+		Measure:     MeasureServerConnectedReplicas,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisServerKeysView = &view.View{
+		Name:        "go.redis/server/keys",
+		Description: "The number of keys of each database",
+		Measure:     MeasureServerKeys,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{GoRedisInstanceName, GoRedisDB},
+	}
+
+	GoRedisServerEvictedKeysView = &view.View{
+		Name:        "go.redis/server/evicted_keys",
+		Description: "The cumulative number of keys evicted by each server",
+		Measure:     MeasureServerEvictedKeys,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisServerKeyspaceHitsView = &view.View{
+		Name:        "go.redis/server/keyspace_hits",
+		Description: "The cumulative number of successful lookups of keys by each server",
+		Measure:     MeasureServerKeyspaceHits,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisServerKeyspaceMissesView = &view.View{
+		Name:        "go.redis/server/keyspace_misses",
+		Description: "The cumulative number of failed lookups of keys by each server",
+		Measure:     MeasureServerKeyspaceMisses,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{GoRedisInstanceName},
+	}
+
+	GoRedisServerCommandCallsView = &view.View{
+		Name:        "go.redis/server/command_calls",
+		Description: "The cumulative number of calls of each command by each server",
+		Measure:     MeasureServerCommandCalls,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{GoRedisInstanceName, GoRedisCommand},
+	}
+
+	GoRedisServerCommandUsecView = &view.View{
+		Name:        "go.redis/server/command_usec",
+		Description: "The cumulative CPU time spent running each command by each server in microseconds",
+		Measure:     MeasureServerCommandUsec,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{GoRedisInstanceName, GoRedisCommand},
+	}
+
+	// DefaultViews holds the views of the stats recorded for every call of
+	// the wrappers. The views of the stats only recorded once a feature is
+	// used are in the group of the feature, such as BreakerViews or
+	// ServerViews, and need to be registered along with the DefaultViews.
+	DefaultViews = []*view.View{GoRedisLatencyView, GoRedisCallsView, GoRedisBytesView, GoRedisErrorsView}
+
+	// SlowCallViews holds the views of the calls flagged as slow by
+	// WithSlowThreshold
+	SlowCallViews = []*view.View{GoRedisSlowCallsView}
+
+	// RetryViews holds the views of the retries of WithRetryPolicy
+	RetryViews = []*view.View{GoRedisRetriesView}
+
+	// BreakerViews holds the views of the circuit breakers of
+	// WithCircuitBreaker
+	BreakerViews = []*view.View{GoRedisCircuitStateView}
+
+	// KeyPatternViews holds the views of the key patterns of WithKeyPattern
+	KeyPatternViews = []*view.View{GoRedisKeyPatternLatencyView}
+
+	// HedgeViews holds the views of the reads of a HedgedReader
+	HedgeViews = []*view.View{GoRedisHedgesView}
+
+	// MigratorViews holds the views of the mismatches of a Migrator
+	MigratorViews = []*view.View{GoRedisMismatchesView}
+
+	// NamespaceViews holds the views of the calls made through a Namespace
+	NamespaceViews = []*view.View{GoRedisNamespaceCallsView}
+
+	// NearCacheViews holds the views of the reads of a NearCache
+	NearCacheViews = []*view.View{GoRedisNearCacheView}
+
+	// CompressionViews holds the views of the values compressed by the
+	// compression package
+	CompressionViews = []*view.View{GoRedisCompressionRatioView, GoRedisCompressionTimeView}
+
+	// HealthViews holds the views of the checkers of the health package
+	HealthViews = []*view.View{GoRedisHealthyView, GoRedisHealthFailuresView, GoRedisPingRTTView}
+
+	// ServerViews holds the views of the stats scraped from the INFO of the
+	// servers by the collector of the serverinfo package
+	ServerViews = []*view.View{GoRedisServerUsedMemoryView, GoRedisServerConnectedClientsView, GoRedisServerConnectedReplicasView, GoRedisServerKeysView, GoRedisServerEvictedKeysView, GoRedisServerKeyspaceHitsView, GoRedisServerKeyspaceMissesView, GoRedisServerCommandCallsView, GoRedisServerCommandUsecView}
 )
 
-// RegisterAllViews registers all the cache views to enable collection of stats
+// RegisterAllViews registers the DefaultViews to enable collection of stats.
+// The views of the optional features are registered with their group.
 func RegisterAllViews() error {
 	return view.Register(DefaultViews...)
 }
@@ -133,19 +436,27 @@ func RecordCall(ctx context.Context, method string, instanceName string) func(cm
 	return func(cmd Cmd) {
 		var (
 			timeSpentMs = time.Since(startTime).Milliseconds()
-			tags        = []tag.Mutator{
-				tag.Insert(GoRedisInstanceName, instanceName),
-				tag.Insert(GoRedisMethod, method),
-			}
+			tags        = callTags(ctx, method, instanceName, cmd.Err())
 		)
 
-		if cmd.Err() != nil && cmd.Err() != redis.Nil {
-			tags = append(tags, tag.Insert(GoRedisStatus, statusError))
-		} else {
-			tags = append(tags, tag.Insert(GoRedisStatus, statusOK))
-		}
-
 		_ = stats.RecordWithTags(ctx, tags, MeasureLatencyMs.M(timeSpentMs))
 		_ = stats.RecordWithTags(ctx, tags, MeasureResponseBytes.M(int64(len([]byte(cmd.String())))))
+		if ClassifyError(cmd.Err()) != "" {
+			_ = stats.RecordWithTags(ctx, tags, MeasureErrors.M(1))
+		}
+	}
+}
+
+// callTags returns the tags stats of a call are recorded with
+func callTags(ctx context.Context, method string, instanceName string, err error) []tag.Mutator {
+	tags := []tag.Mutator{
+		tag.Insert(GoRedisInstanceName, instanceName),
+		tag.Insert(GoRedisMethod, scriptName(ctx, method)),
+	}
+	if errorType := ClassifyError(err); errorType != "" {
+		tags = append(tags, tag.Insert(GoRedisStatus, statusError), tag.Insert(GoRedisErrorType, errorType))
+	} else {
+		tags = append(tags, tag.Insert(GoRedisStatus, statusOK))
 	}
+	return tags
 }
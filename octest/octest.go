@@ -0,0 +1,272 @@
+// Package octest provides an OpenCensus exporter that records the spans and
+// stats produced by ocredis so tests can assert on them.
+package octest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// CallsView counts calls by instance, method and status. It is registered by
+// NewExporter since the default ocredis views aren't tagged by instance.
+var CallsView = &view.View{
+	Name:        "ocredis/octest/calls",
+	Description: "The number of calls by instance, method and status",
+	Measure:     ocredis.MeasureLatencyMs,
+	Aggregation: view.Count(),
+	TagKeys:     []tag.Key{ocredis.GoRedisInstanceName, ocredis.GoRedisMethod, ocredis.GoRedisStatus},
+}
+
+// Exporter records spans and view data exported by OpenCensus
+type Exporter struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+	views map[string]*view.Data
+
+	// previous is the default sampler restored by Unregister
+	previous trace.Sampler
+}
+
+// sampler tracks the default trace sampler since OpenCensus doesn't expose
+// it. It starts as the OpenCensus default.
+var sampler = struct {
+	sync.Mutex
+	current trace.Sampler
+}{
+	current: trace.ProbabilitySampler(1e-4),
+}
+
+// SetDefaultSampler sets the default trace sampler and returns the previous
+// one. Tests changing the default sampler should use it rather than
+// trace.ApplyConfig so exporters restore the right sampler.
+func SetDefaultSampler(s trace.Sampler) trace.Sampler {
+	sampler.Lock()
+	defer sampler.Unlock()
+	previous := sampler.current
+	sampler.current = s
+	trace.ApplyConfig(trace.Config{DefaultSampler: s})
+	return previous
+}
+
+var (
+	_ trace.Exporter = &Exporter{}
+	_ view.Exporter  = &Exporter{}
+)
+
+// views returns CallsView and the views of the ocredis package, those of
+// every feature included
+func views() []*view.View {
+	views := []*view.View{CallsView}
+	for _, group := range [][]*view.View{
+		ocredis.DefaultViews,
+		ocredis.SlowCallViews,
+		ocredis.RetryViews,
+		ocredis.BreakerViews,
+		ocredis.KeyPatternViews,
+		ocredis.HedgeViews,
+		ocredis.MigratorViews,
+		ocredis.NamespaceViews,
+		ocredis.NearCacheViews,
+		ocredis.CompressionViews,
+		ocredis.HealthViews,
+		ocredis.ServerViews,
+	} {
+		views = append(views, group...)
+	}
+	return views
+}
+
+// NewExporter registers a recording exporter along with CallsView and the
+// views of the ocredis package, those of every feature included. The default
+// trace sampler is set to always sample so spans started without a sampler
+// are recorded, Unregister restores it.
+func NewExporter() (*Exporter, error) {
+	e := &Exporter{views: map[string]*view.Data{}}
+	if err := view.Register(views()...); err != nil {
+		return nil, err
+	}
+	e.previous = SetDefaultSampler(trace.AlwaysSample())
+	trace.RegisterExporter(e)
+	view.RegisterExporter(e)
+	return e, nil
+}
+
+// Unregister stops the exporter from receiving data, unregisters the views
+// registered by NewExporter and restores the default trace sampler
+func (e *Exporter) Unregister() {
+	SetDefaultSampler(e.previous)
+	trace.UnregisterExporter(e)
+	view.UnregisterExporter(e)
+	view.Unregister(views()...)
+}
+
+// Reset clears the recorded spans and the data collected by the registered
+// views
+func (e *Exporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.views = map[string]*view.Data{}
+	e.mu.Unlock()
+
+	view.Unregister(views()...)
+	_ = view.Register(views()...)
+}
+
+// ExportSpan records a span
+func (e *Exporter) ExportSpan(sd *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, sd)
+}
+
+// ExportView records the latest data of a view
+func (e *Exporter) ExportView(vd *view.Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.views[vd.View.Name] = vd
+}
+
+// Spans returns the recorded spans
+func (e *Exporter) Spans() []*trace.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*trace.SpanData(nil), e.spans...)
+}
+
+// SpansNamed returns the recorded spans with the given name
+func (e *Exporter) SpansNamed(name string) []*trace.SpanData {
+	var spans []*trace.SpanData
+	for _, sd := range e.Spans() {
+		if sd.Name == name {
+			spans = append(spans, sd)
+		}
+	}
+	return spans
+}
+
+// ViewData returns the latest data exported for the named view. Data is only
+// exported once per reporting period, use Rows to read the current data.
+func (e *Exporter) ViewData(name string) *view.Data {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.views[name]
+}
+
+// Rows returns the current rows of a registered view
+func (e *Exporter) Rows(v *view.View) ([]*view.Row, error) {
+	return view.RetrieveData(v.Name)
+}
+
+// CallCount returns the number of calls recorded for the instance, method and
+// status
+func (e *Exporter) CallCount(instance, method, status string) (int64, error) {
+	rows, err := e.Rows(CallsView)
+	if err != nil {
+		return 0, err
+	}
+	want := map[tag.Key]string{
+		ocredis.GoRedisInstanceName: instance,
+		ocredis.GoRedisMethod:       method,
+		ocredis.GoRedisStatus:       status,
+	}
+	for _, row := range rows {
+		if tagsMatch(row.Tags, want) {
+			if count, ok := row.Data.(*view.CountData); ok {
+				return count.Value, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// AssertSpan fails the test unless a span was recorded with the given name,
+// attributes and status code. attrs only needs to hold the attributes being
+// checked. The matching span is returned.
+func (e *Exporter) AssertSpan(t testing.TB, name string, attrs map[string]interface{}, status int32) *trace.SpanData {
+	t.Helper()
+	spans := e.SpansNamed(name)
+	if len(spans) == 0 {
+		t.Errorf("no span named %q was recorded, got spans %v", name, spanNames(e.Spans()))
+		return nil
+	}
+	var mismatches []string
+	for _, sd := range spans {
+		if msg := spanMismatch(sd, attrs, status); msg != "" {
+			mismatches = append(mismatches, msg)
+			continue
+		}
+		return sd
+	}
+	t.Errorf("no span named %q matched:\n%s", name, strings.Join(mismatches, "\n"))
+	return nil
+}
+
+// AssertNoSpan fails the test if a span was recorded with the given name
+func (e *Exporter) AssertNoSpan(t testing.TB, name string) {
+	t.Helper()
+	if n := len(e.SpansNamed(name)); n > 0 {
+		t.Errorf("expected no span named %q, got %d", name, n)
+	}
+}
+
+// AssertCallCount fails the test unless n calls were recorded for the
+// instance, method and status
+func (e *Exporter) AssertCallCount(t testing.TB, instance, method, status string, n int64) {
+	t.Helper()
+	got, err := e.CallCount(instance, method, status)
+	if err != nil {
+		t.Errorf("retrieving call count: %v", err)
+		return
+	}
+	if got != n {
+		t.Errorf("call count for instance %q method %q status %q = %d, want %d", instance, method, status, got, n)
+	}
+}
+
+func spanMismatch(sd *trace.SpanData, attrs map[string]interface{}, status int32) string {
+	if sd.Status.Code != status {
+		return fmt.Sprintf("  status = %d %q, want %d", sd.Status.Code, sd.Status.Message, status)
+	}
+	for k, want := range attrs {
+		got, ok := sd.Attributes[k]
+		if !ok {
+			return fmt.Sprintf("  attribute %q missing, got %v", k, sd.Attributes)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			return fmt.Sprintf("  attribute %q = %v, want %v", k, got, want)
+		}
+	}
+	return ""
+}
+
+func spanNames(spans []*trace.SpanData) []string {
+	names := make([]string, 0, len(spans))
+	for _, sd := range spans {
+		names = append(names, sd.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func tagsMatch(tags []tag.Tag, want map[tag.Key]string) bool {
+	var matched int
+	for _, t := range tags {
+		v, ok := want[t.Key]
+		if !ok {
+			continue
+		}
+		if v != t.Value {
+			return false
+		}
+		matched++
+	}
+	return matched == len(want)
+}
@@ -0,0 +1,118 @@
+package octest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v4 "github.com/KolbyMcGarrah/ocredis/v4"
+	"go.opencensus.io/trace"
+	redis "gopkg.in/redis.v4"
+)
+
+func sampled() bool {
+	_, span := trace.StartSpan(context.Background(), "probe")
+	defer span.End()
+	return span.SpanContext().IsSampled()
+}
+
+func TestSamplerRestored(t *testing.T) {
+	defer octest.SetDefaultSampler(octest.SetDefaultSampler(trace.NeverSample()))
+
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	if !sampled() {
+		t.Error("spans aren't sampled while the exporter is registered")
+	}
+	e.Unregister()
+	if sampled() {
+		t.Error("Unregister didn't restore the previous sampler")
+	}
+}
+
+func TestExporter(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	defer s.Close()
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	defer e.Unregister()
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	c := v4.Wrap(client,
+		ocredis.WithAllTraceOptions(),
+		ocredis.WithAllowRoot(true),
+		ocredis.WithInstanceName("octest"),
+	)
+	ctx := context.Background()
+	c.Set(ctx, "key", "value", 0)
+	c.Get(ctx, "key")
+	c.Get(ctx, "missing")
+
+	e.AssertSpan(t, "go.redis.set", map[string]interface{}{"cache.instance": "octest"}, trace.StatusCodeOK)
+	if n := len(e.SpansNamed("go.redis.get")); n != 2 {
+		t.Errorf("recorded %d get spans, want 2", n)
+	}
+	e.AssertNoSpan(t, "go.redis.del")
+	e.AssertCallCount(t, "octest", "go.redis.get", "OK", 2)
+	e.AssertCallCount(t, "octest", "go.redis.set", "OK", 1)
+	e.AssertCallCount(t, "octest", "go.redis.set", "ERROR", 0)
+
+	e.Reset()
+	if n := len(e.Spans()); n != 0 {
+		t.Errorf("Reset kept %d spans", n)
+	}
+	e.AssertCallCount(t, "octest", "go.redis.get", "OK", 0)
+}
+
+func TestAssertSpanFailures(t *testing.T) {
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	defer e.Unregister()
+
+	_, span := trace.StartSpan(context.Background(), "span")
+	span.AddAttributes(trace.StringAttribute("attr", "value"))
+	span.End()
+
+	for _, tc := range []struct {
+		name  string
+		span  string
+		attrs map[string]interface{}
+		code  int32
+		fails bool
+	}{
+		{"Match", "span", map[string]interface{}{"attr": "value"}, trace.StatusCodeOK, false},
+		{"Name", "other", nil, trace.StatusCodeOK, true},
+		{"Attribute", "span", map[string]interface{}{"attr": "other"}, trace.StatusCodeOK, true},
+		{"Status", "span", nil, trace.StatusCodeUnknown, true},
+	} {
+		r := &recorder{TB: t}
+		e.AssertSpan(r, tc.span, tc.attrs, tc.code)
+		if r.failed != tc.fails {
+			t.Errorf("%s: AssertSpan failed = %v, want %v", tc.name, r.failed, tc.fails)
+		}
+	}
+}
+
+// recorder records the failures of an assertion instead of failing the test
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
@@ -1,6 +1,11 @@
 package ocredis
 
-import "go.opencensus.io/trace"
+import (
+	"sort"
+	"time"
+
+	"go.opencensus.io/trace"
+)
 
 // DefaultInstanceName is the instance name assigned when one isn't provided
 const DefaultInstanceName = "default"
@@ -27,32 +32,221 @@ type TraceOptions struct {
 	// Sampler to use when creating spans
 	Sampler trace.Sampler
 
+	// SampleErrors, if set to true, traces calls that fail even when the
+	// sampler didn't sample them. Stats are recorded for every call
+	// regardless of sampling.
+	SampleErrors bool
+
+	// SampleSlowerThan, if non zero, traces calls taking at least this long
+	// even when the sampler didn't sample them.
+	SampleSlowerThan time.Duration
+
+	// SlowThreshold, if non zero, flags calls taking at least this long as
+	// slow. Slow calls get a slow span attribute, are counted by the
+	// MeasureSlowCalls measure and passed to the SlowLogger.
+	SlowThreshold time.Duration
+
+	// SlowLogger receives the slow calls
+	SlowLogger SlowLogger
+
+	// Statement, if set to true, adds the command and its sanitized arguments
+	// to spans as the redis.statement attribute
+	Statement bool
+
+	// Logger logs the calls selected by LogFilter, every call is logged when
+	// LogFilter is nil
+	Logger    Logger
+	LogFilter LogFilter
+
+	// KeyPattern, if set, tags the stats of calls with the pattern of their
+	// first key using the GoRedisKeyPattern tag
+	KeyPattern KeyPatternFunc
+
+	// keyPatterns caps the number of distinct patterns of KeyPattern
+	keyPatterns *keyPatterns
+
+	// KeyAnalyzer, if set, is fed the keys of calls to find hot keys and big
+	// keys
+	KeyAnalyzer *KeyAnalyzer
+
+	// retryPolicy, if set, retries the failed calls
+	retryPolicy *retryPolicy
+
+	// breakerOptions, if set, configures the circuit breaker of the instance
+	breakerOptions *BreakerOptions
+	breaker        *circuitBreaker
+
+	// instance is set once the wrapper is registered with RegisterInstance
+	instance *registeredInstance
+
+	// ArgSanitizer sanitizes the arguments of calls before they're exported.
+	// DefaultArgSanitizer is used when it's nil.
+	ArgSanitizer ArgSanitizer
+
 	// Setting the below options will control whether or not spans are created
-	// on their call.
-	Get      bool
-	Set      bool
-	Incr     bool
-	Ping     bool
-	Del      bool
-	SetNX    bool
-	Close    bool
-	Expire   bool
-	ExpireAt bool
-	HGet     bool
-	HLen     bool
-	HSet     bool
-	LPop     bool
-	Eval     bool
-}
-
-// WithAllTraceOptions enables all available traceoptions
-func WithAllTraceOptions() TraceOption {
-	return func(o *TraceOptions) {
-		*o = AllTraceOptions
+	// on their call. They are kept in sync with the per command configuration
+	// set by WithCommands and WithoutCommands.
+	Get          bool
+	Set          bool
+	Incr         bool
+	Ping         bool
+	Del          bool
+	SetNX        bool
+	Close        bool
+	Expire       bool
+	ExpireAt     bool
+	HGet         bool
+	HLen         bool
+	HSet         bool
+	LPop         bool
+	Eval         bool
+	EvalSha      bool
+	ScriptExists bool
+	ScriptFlush  bool
+	ScriptLoad   bool
+
+	// commands holds the configuration of each command keyed by name
+	commands map[string]*CommandConfig
+}
+
+// CommandConfig holds the tracing configuration of a single command
+type CommandConfig struct {
+	// Traced controls whether spans are created for the command
+	Traced bool
+
+	// Sampler overrides the Sampler of the TraceOptions for the command
+	Sampler trace.Sampler
+
+	// Attributes are added to every span of the command
+	Attributes []trace.Attribute
+
+	// SlowThreshold overrides the SlowThreshold of the TraceOptions for the
+	// command once set with WithSlowThreshold. An override of zero turns slow
+	// call flagging off for the command.
+	SlowThreshold time.Duration
+
+	// slowThresholdSet is true when SlowThreshold was set for the command
+	slowThresholdSet bool
+}
+
+// NewTraceOptions applies the options and sets the defaults used by the
+// wrappers
+func NewTraceOptions(options ...TraceOption) TraceOptions {
+	o := TraceOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.KeyPattern != nil && o.keyPatterns == nil {
+		o.keyPatterns = newKeyPatterns(o.KeyPattern, 0)
+	}
+	if o.InstanceName == "" {
+		o.InstanceName = DefaultInstanceName
+	} else {
+		o.DefaultAttributes = append(o.DefaultAttributes, trace.StringAttribute("cache.instance", o.InstanceName))
+	}
+	if o.breakerOptions != nil {
+		o.breaker = newCircuitBreaker(o.InstanceName, *o.breakerOptions)
+	}
+	return o
+}
+
+// Traced reports whether spans should be created for the command
+func (o TraceOptions) Traced(command string) bool {
+	if f := o.legacyField(command); f != nil {
+		return *f
+	}
+	c := o.commands[command]
+	return c != nil && c.Traced
+}
+
+// Command returns the configuration of the command. The Sampler of the
+// TraceOptions is used when the command has no sampler of its own.
+func (o TraceOptions) Command(command string) CommandConfig {
+	var c CommandConfig
+	if cfg := o.commands[command]; cfg != nil {
+		c = *cfg
+	}
+	c.Traced = o.Traced(command)
+	if c.Sampler == nil {
+		c.Sampler = o.Sampler
+	}
+	if !c.slowThresholdSet {
+		c.SlowThreshold = o.SlowThreshold
+	}
+	return c
+}
+
+// command returns the configuration of the command, creating it if needed
+func (o *TraceOptions) command(name string) *CommandConfig {
+	if o.commands == nil {
+		o.commands = map[string]*CommandConfig{}
+	}
+	c, ok := o.commands[name]
+	if !ok {
+		c = &CommandConfig{}
+		o.commands[name] = c
+	}
+	return c
+}
+
+func (o *TraceOptions) setTraced(command string, b bool) {
+	o.command(command).Traced = b
+	if f := o.legacyField(command); f != nil {
+		*f = b
+	}
+}
+
+// legacyField returns the bool field controlling tracing of the command, or
+// nil for commands that only have a registry entry
+func (o *TraceOptions) legacyField(command string) *bool {
+	switch command {
+	case "get":
+		return &o.Get
+	case "set":
+		return &o.Set
+	case "incr":
+		return &o.Incr
+	case "ping":
+		return &o.Ping
+	case "del":
+		return &o.Del
+	case "setnx":
+		return &o.SetNX
+	case "close":
+		return &o.Close
+	case "expire":
+		return &o.Expire
+	case "expireat":
+		return &o.ExpireAt
+	case "hget":
+		return &o.HGet
+	case "hlen":
+		return &o.HLen
+	case "hset":
+		return &o.HSet
+	case "lpop":
+		return &o.LPop
+	case "eval":
+		return &o.Eval
+	case "evalsha":
+		return &o.EvalSha
+	case "scriptexists":
+		return &o.ScriptExists
+	case "scriptflush":
+		return &o.ScriptFlush
+	case "scriptload":
+		return &o.ScriptLoad
 	}
+	return nil
 }
 
-// AllTraceOptions has all tracing options enabled
+// WithAllTraceOptions enables tracing on every registered command
+func WithAllTraceOptions() TraceOption {
+	return WithCommands("*")
+}
+
+// AllTraceOptions has all tracing options enabled. It only holds the
+// commands with a field, use WithAllTraceOptions to enable every command.
 var AllTraceOptions = TraceOptions{
 	Get:      true,
 	Set:      true,
@@ -66,6 +260,13 @@ var AllTraceOptions = TraceOptions{
 	HLen:     true,
 	HGet:     true,
 	HSet:     true,
+	LPop:     true,
+	Eval:     true,
+
+	EvalSha:      true,
+	ScriptExists: true,
+	ScriptFlush:  true,
+	ScriptLoad:   true,
 }
 
 // WithAllowRoot if set to true, will allow ocredis to create root spans in
@@ -85,100 +286,281 @@ func WithInstanceName(instanceName string) TraceOption {
 	}
 }
 
+// WithSampler sets the sampler used for spans of commands without a sampler
+// of their own.
+func WithSampler(sampler trace.Sampler) TraceOption {
+	return func(o *TraceOptions) {
+		o.Sampler = sampler
+	}
+}
+
+// WithTailSampling traces calls that fail or take at least slowerThan even
+// when the sampler dropped them, so errors and slow calls aren't sampled away.
+// A zero slowerThan only traces the failed calls.
+//
+// The attempts of a retried call are sampled along with the span of the call,
+// so a call traced by tail sampling has no go.redis.attempt spans: they were
+// dropped with the span the sampler dropped. MeasureRetries still counts its
+// retries.
+func WithTailSampling(slowerThan time.Duration) TraceOption {
+	return func(o *TraceOptions) {
+		o.SampleErrors = true
+		o.SampleSlowerThan = slowerThan
+	}
+}
+
+// WithSlowThreshold flags calls taking at least threshold as slow. overrides
+// sets the threshold of the commands matched by its selectors, see
+// MatchCommands for the selector syntax. A threshold of zero turns slow call
+// flagging off, so an override of zero turns it off for the matched commands.
+//
+// When selectors overlap the most specific one wins: an exact command name
+// such as "get" wins over a glob such as "hash.*" or "h*", which wins over a
+// category such as "read".
+func WithSlowThreshold(threshold time.Duration, overrides map[string]time.Duration) TraceOption {
+	return func(o *TraceOptions) {
+		o.SlowThreshold = threshold
+		selectors := make([]string, 0, len(overrides))
+		for s := range overrides {
+			selectors = append(selectors, s)
+		}
+		// apply the least specific selectors first so the most specific ones
+		// overwrite them, in a stable order when they're as specific
+		sort.Slice(selectors, func(i, j int) bool {
+			si, sj := selectorSpecificity(selectors[i]), selectorSpecificity(selectors[j])
+			if si != sj {
+				return si < sj
+			}
+			return selectors[i] < selectors[j]
+		})
+		for _, s := range selectors {
+			for _, name := range MatchCommands(s) {
+				c := o.command(name)
+				c.SlowThreshold, c.slowThresholdSet = overrides[s], true
+			}
+		}
+	}
+}
+
+// WithSlowLogger sets the logger receiving the slow calls
+func WithSlowLogger(logger SlowLogger) TraceOption {
+	return func(o *TraceOptions) {
+		o.SlowLogger = logger
+	}
+}
+
+// WithStatement if true adds the command and its sanitized arguments to spans
+func WithStatement(b bool) TraceOption {
+	return func(o *TraceOptions) {
+		o.Statement = b
+	}
+}
+
+// WithLogger logs the calls selected by the filter. A nil filter logs every
+// call. Arguments are sanitized with the ArgSanitizer before being logged.
+func WithLogger(logger Logger, filter LogFilter) TraceOption {
+	return func(o *TraceOptions) {
+		o.Logger = logger
+		o.LogFilter = filter
+	}
+}
+
+// WithKeyPattern tags the stats of calls with the pattern fn returns for
+// their first key. At most maxPatterns distinct patterns are used, later ones
+// are counted as "other". A maxPatterns of zero uses DefaultMaxKeyPatterns.
+func WithKeyPattern(fn KeyPatternFunc, maxPatterns int) TraceOption {
+	return func(o *TraceOptions) {
+		o.KeyPattern = fn
+		o.keyPatterns = newKeyPatterns(fn, maxPatterns)
+	}
+}
+
+// WithKeyAnalyzer feeds the keys of calls to the analyzer. Spans of calls
+// touching a hot key get a "hot key" annotation. An analyzer can be shared by
+// several wrappers.
+func WithKeyAnalyzer(a *KeyAnalyzer) TraceOption {
+	return func(o *TraceOptions) {
+		o.KeyAnalyzer = a
+	}
+}
+
+// WithArgSanitizer sets the sanitizer applied to the arguments of calls
+// before they're exported in span statements, logs and slow calls
+func WithArgSanitizer(sanitizer ArgSanitizer) TraceOption {
+	return func(o *TraceOptions) {
+		o.ArgSanitizer = sanitizer
+	}
+}
+
 // WithGet if true will allow tracing on the get call.
 func WithGet(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Get = b
+		o.setTraced("get", b)
 	}
 }
 
 // WithSet if true will allow tracing on the set call.
 func WithSet(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Set = b
+		o.setTraced("set", b)
 	}
 }
 
 // WithIncr if true will allow tracing on the incr call.
 func WithIncr(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Incr = b
+		o.setTraced("incr", b)
 	}
 }
 
 // WithPing if true will allow tracing on the ping call.
 func WithPing(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Ping = b
+		o.setTraced("ping", b)
 	}
 }
 
 // WithDel if true will allow tracing on the Del call.
 func WithDel(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Del = b
+		o.setTraced("del", b)
 	}
 }
 
 // WithSetNX if true will allow tracing on the SetNX call.
 func WithSetNX(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.SetNX = b
+		o.setTraced("setnx", b)
 	}
 }
 
 // WithClose if true will allow tracing on the close call.
 func WithClose(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Close = b
+		o.setTraced("close", b)
 	}
 }
 
 // WithExpire if true will allow tracing on the expire call.
 func WithExpire(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Expire = b
+		o.setTraced("expire", b)
 	}
 }
 
 // WithExpireAt if true will allow tracing on the expire call.
 func WithExpireAt(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.ExpireAt = b
+		o.setTraced("expireat", b)
 	}
 }
 
 // WithHGet if true will allow tracing on the expire call.
 func WithHGet(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.HGet = b
+		o.setTraced("hget", b)
 	}
 }
 
 // WithHLen if true will allow tracing on the expire call.
 func WithHLen(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.HLen = b
+		o.setTraced("hlen", b)
 	}
 }
 
 // WithHSet if true will allow tracing on the expire call.
 func WithHSet(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.HSet = b
+		o.setTraced("hset", b)
 	}
 }
 
 // WithLPop if true will allow tracing on the LPop call.
 func WithLPop(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.LPop = b
+		o.setTraced("lpop", b)
 	}
 }
 
 // WithEval if true will allow tracing on the Eval call.
 func WithEval(b bool) TraceOption {
 	return func(o *TraceOptions) {
-		o.Eval = b
+		o.setTraced("eval", b)
+	}
+}
+
+// WithEvalSha if true will allow tracing on the EvalSha call.
+func WithEvalSha(b bool) TraceOption {
+	return func(o *TraceOptions) {
+		o.setTraced("evalsha", b)
+	}
+}
+
+// WithScriptExists if true will allow tracing on the ScriptExists call.
+func WithScriptExists(b bool) TraceOption {
+	return func(o *TraceOptions) {
+		o.setTraced("scriptexists", b)
+	}
+}
+
+// WithScriptFlush if true will allow tracing on the ScriptFlush call.
+func WithScriptFlush(b bool) TraceOption {
+	return func(o *TraceOptions) {
+		o.setTraced("scriptflush", b)
+	}
+}
+
+// WithScriptLoad if true will allow tracing on the ScriptLoad call.
+func WithScriptLoad(b bool) TraceOption {
+	return func(o *TraceOptions) {
+		o.setTraced("scriptload", b)
+	}
+}
+
+// WithInfo if true will allow tracing on the Info call.
+func WithInfo(b bool) TraceOption {
+	return func(o *TraceOptions) {
+		o.setTraced("info", b)
+	}
+}
+
+// WithCommands enables tracing on the commands matched by the selectors. See
+// MatchCommands for the selector syntax.
+func WithCommands(selectors ...string) TraceOption {
+	return func(o *TraceOptions) {
+		for _, name := range MatchCommands(selectors...) {
+			o.setTraced(name, true)
+		}
+	}
+}
+
+// WithoutCommands disables tracing on the commands matched by the selectors
+func WithoutCommands(selectors ...string) TraceOption {
+	return func(o *TraceOptions) {
+		for _, name := range MatchCommands(selectors...) {
+			o.setTraced(name, false)
+		}
+	}
+}
+
+// WithCommandSampler sets the sampler used for spans of the commands matched
+// by the selectors
+func WithCommandSampler(sampler trace.Sampler, selectors ...string) TraceOption {
+	return func(o *TraceOptions) {
+		for _, name := range MatchCommands(selectors...) {
+			o.command(name).Sampler = sampler
+		}
+	}
+}
+
+// WithCommandAttributes adds attributes to spans of the commands matched by
+// the selectors
+func WithCommandAttributes(attrs []trace.Attribute, selectors ...string) TraceOption {
+	return func(o *TraceOptions) {
+		for _, name := range MatchCommands(selectors...) {
+			c := o.command(name)
+			c.Attributes = append(c.Attributes, attrs...)
+		}
 	}
 }
@@ -0,0 +1,45 @@
+package ocredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowThresholdOverrides(t *testing.T) {
+	o := NewTraceOptions(WithSlowThreshold(time.Second, map[string]time.Duration{
+		"get":      10 * time.Millisecond,
+		"script.*": 0,
+	}))
+	for command, want := range map[string]time.Duration{
+		"get":        10 * time.Millisecond,
+		"set":        time.Second,
+		"eval":       0,
+		"scriptload": 0,
+	} {
+		if got := o.Command(command).SlowThreshold; got != want {
+			t.Errorf("SlowThreshold of %s = %v, want %v", command, got, want)
+		}
+	}
+}
+
+func TestSlowThresholdOverridePrecedence(t *testing.T) {
+	o := NewTraceOptions(WithSlowThreshold(time.Second, map[string]time.Duration{
+		"get":    10 * time.Millisecond,
+		"hash.*": 50 * time.Millisecond,
+		"read":   100 * time.Millisecond,
+		"write":  200 * time.Millisecond,
+		"hset":   20 * time.Millisecond,
+	}))
+	for command, want := range map[string]time.Duration{
+		"get":  10 * time.Millisecond,
+		"hget": 50 * time.Millisecond,
+		"hlen": 50 * time.Millisecond,
+		"hset": 20 * time.Millisecond,
+		"set":  200 * time.Millisecond,
+		"ping": time.Second,
+	} {
+		if got := o.Command(command).SlowThreshold; got != want {
+			t.Errorf("SlowThreshold of %s = %v, want %v", command, got, want)
+		}
+	}
+}
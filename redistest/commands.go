@@ -0,0 +1,518 @@
+package redistest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handler runs a command. It is called with the server lock held.
+type handler func(s *Server, c *conn, args []string) interface{}
+
+// command describes a supported command. minArgs and maxArgs don't include
+// the command name, a maxArgs of -1 means any number of arguments.
+type command struct {
+	fn      handler
+	minArgs int
+	maxArgs int
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// connection and server
+		"AUTH":      {cmdOK, 1, 2},
+		"CLIENT":    {cmdClient, 1, -1},
+		"DBSIZE":    {cmdDBSize, 0, 0},
+		"ECHO":      {cmdEcho, 1, 1},
+		"FLUSHALL":  {cmdFlush, 0, 1},
+		"FLUSHDB":   {cmdFlush, 0, 1},
+		"INFO":      {cmdInfo, 0, 1},
+		"PING":      {cmdPing, 0, 1},
+		"QUIT":      {cmdOK, 0, 0},
+		"READONLY":  {cmdOK, 0, 0},
+		"READWRITE": {cmdOK, 0, 0},
+		"SELECT":    {cmdOK, 1, 1},
+		"TIME":      {cmdTime, 0, 0},
+
+		// keys
+		"DEL":       {cmdDel, 1, -1},
+		"EXISTS":    {cmdExists, 1, -1},
+		"EXPIRE":    {cmdExpire(time.Second, false), 2, 2},
+		"EXPIREAT":  {cmdExpire(time.Second, true), 2, 2},
+		"KEYS":      {cmdKeys, 1, 1},
+		"PERSIST":   {cmdPersist, 1, 1},
+		"PEXPIRE":   {cmdExpire(time.Millisecond, false), 2, 2},
+		"PEXPIREAT": {cmdExpire(time.Millisecond, true), 2, 2},
+		"PTTL":      {cmdTTL(time.Millisecond), 1, 1},
+		"RENAME":    {cmdRename, 2, 2},
+		"SCAN":      {cmdScan, 1, -1},
+		"TTL":       {cmdTTL(time.Second), 1, 1},
+		"TYPE":      {cmdType, 1, 1},
+
+		// strings
+		"APPEND":      {cmdAppend, 2, 2},
+		"DECR":        {cmdIncrBy(-1, false), 1, 1},
+		"DECRBY":      {cmdIncrBy(-1, true), 2, 2},
+		"GET":         {cmdGet, 1, 1},
+		"GETSET":      {cmdGetSet, 2, 2},
+		"INCR":        {cmdIncrBy(1, false), 1, 1},
+		"INCRBY":      {cmdIncrBy(1, true), 2, 2},
+		"INCRBYFLOAT": {cmdIncrByFloat, 2, 2},
+		"MGET":        {cmdMGet, 1, -1},
+		"MSET":        {cmdMSet, 2, -1},
+		"PSETEX":      {cmdSetEx(time.Millisecond), 3, 3},
+		"SET":         {cmdSet, 2, -1},
+		"SETEX":       {cmdSetEx(time.Second), 3, 3},
+		"SETNX":       {cmdSetNX, 2, 2},
+		"STRLEN":      {cmdStrLen, 1, 1},
+
+		// hashes
+		"HDEL":         {cmdHDel, 2, -1},
+		"HEXISTS":      {cmdHExists, 2, 2},
+		"HGET":         {cmdHGet, 2, 2},
+		"HGETALL":      {cmdHGetAll, 1, 1},
+		"HINCRBY":      {cmdHIncrBy, 3, 3},
+		"HINCRBYFLOAT": {cmdHIncrByFloat, 3, 3},
+		"HKEYS":        {cmdHKeys, 1, 1},
+		"HLEN":         {cmdHLen, 1, 1},
+		"HMGET":        {cmdHMGet, 2, -1},
+		"HMSET":        {cmdHMSet, 3, -1},
+		"HSET":         {cmdHSet, 3, -1},
+		"HSETNX":       {cmdHSetNX, 3, 3},
+		"HVALS":        {cmdHVals, 1, 1},
+
+		// lists
+		"LINDEX": {cmdLIndex, 2, 2},
+		"LLEN":   {cmdLLen, 1, 1},
+		"LPOP":   {cmdPop(true), 1, 1},
+		"LPUSH":  {cmdPush(true), 2, -1},
+		"LRANGE": {cmdLRange, 3, 3},
+		"LTRIM":  {cmdLTrim, 3, 3},
+		"RPOP":   {cmdPop(false), 1, 1},
+		"RPUSH":  {cmdPush(false), 2, -1},
+
+		// sets
+		"SADD":      {cmdSAdd, 2, -1},
+		"SCARD":     {cmdSCard, 1, 1},
+		"SISMEMBER": {cmdSIsMember, 2, 2},
+		"SMEMBERS":  {cmdSMembers, 1, 1},
+		"SREM":      {cmdSRem, 2, -1},
+
+		// sorted sets
+		"ZADD":          {cmdZAdd, 3, -1},
+		"ZCARD":         {cmdZCard, 1, 1},
+		"ZCOUNT":        {cmdZCount, 3, 3},
+		"ZINCRBY":       {cmdZIncrBy, 3, 3},
+		"ZRANGE":        {cmdZRange(false), 3, 4},
+		"ZRANGEBYSCORE": {cmdZRangeByScore, 3, -1},
+		"ZRANK":         {cmdZRank, 2, 2},
+		"ZREM":          {cmdZRem, 2, -1},
+		"ZREVRANGE":     {cmdZRange(true), 3, 4},
+		"ZSCORE":        {cmdZScore, 2, 2},
+
+		// transactions
+		"DISCARD": {cmdDiscard, 0, 0},
+		"EXEC":    {cmdExec, 0, 0},
+		"MULTI":   {cmdMulti, 0, 0},
+		"UNWATCH": {cmdOK, 0, 0},
+		"WATCH":   {cmdOK, 1, -1},
+
+		// scripting
+		"EVAL":    {cmdEval, 2, -1},
+		"EVALSHA": {cmdEvalSha, 2, -1},
+		"SCRIPT":  {cmdScript, 1, -1},
+
+		// pub/sub
+		"PSUBSCRIBE":   {cmdSubscribe(true), 1, -1},
+		"PUBLISH":      {cmdPublish, 2, 2},
+		"PUNSUBSCRIBE": {cmdUnsubscribe(true), 0, -1},
+		"SUBSCRIBE":    {cmdSubscribe(false), 1, -1},
+		"UNSUBSCRIBE":  {cmdUnsubscribe(false), 0, -1},
+	}
+}
+
+// Commands that are run immediately while a transaction is being queued
+var transactionCommands = map[string]bool{
+	"DISCARD": true,
+	"EXEC":    true,
+	"MULTI":   true,
+	"WATCH":   true,
+}
+
+// Commands allowed on a connection that has subscriptions
+var subscribeCommands = map[string]bool{
+	"PING":         true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"QUIT":         true,
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+}
+
+// dispatch runs or queues a command. It is called with the server lock held.
+func (s *Server) dispatch(c *conn, name string, args []string) interface{} {
+	cmd, ok := commands[name]
+	if !ok {
+		c.multiErr = c.multi
+		return errorf("ERR unknown command '%s'", strings.ToLower(name))
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		c.multiErr = c.multi
+		return errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+	}
+	if c.subscriptions() > 0 && !subscribeCommands[name] {
+		return redisError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+	}
+	if c.multi && !transactionCommands[name] {
+		c.queued = append(c.queued, append([]string{name}, args...))
+		return replyQueued
+	}
+	return cmd.fn(s, c, args)
+}
+
+func parseInt(s string) (int64, redisError) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, "ERR value is not an integer or out of range"
+	}
+	return n, ""
+}
+
+func parseFloat(s string) (float64, redisError) {
+	switch strings.ToLower(s) {
+	case "+inf", "inf":
+		return math.Inf(1), ""
+	case "-inf":
+		return math.Inf(-1), ""
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, "ERR value is not a valid float"
+	}
+	return f, ""
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// normalizeRange converts the inclusive, possibly negative, start and stop
+// indexes used by range commands into slice bounds for a sequence of length n.
+func normalizeRange(start, stop int64, n int) (int, int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	if start > stop || start >= int64(n) {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+func cmdOK(s *Server, c *conn, args []string) interface{} {
+	return replyOK
+}
+
+func cmdPing(s *Server, c *conn, args []string) interface{} {
+	if c.subscriptions() > 0 {
+		msg := ""
+		if len(args) > 0 {
+			msg = args[0]
+		}
+		return []interface{}{"pong", msg}
+	}
+	if len(args) > 0 {
+		return args[0]
+	}
+	return status("PONG")
+}
+
+func cmdEcho(s *Server, c *conn, args []string) interface{} {
+	return args[0]
+}
+
+func cmdClient(s *Server, c *conn, args []string) interface{} {
+	if strings.ToUpper(args[0]) == "GETNAME" {
+		return nil
+	}
+	return replyOK
+}
+
+func cmdDBSize(s *Server, c *conn, args []string) interface{} {
+	return len(s.db.keys("*"))
+}
+
+func cmdFlush(s *Server, c *conn, args []string) interface{} {
+	s.db.flush()
+	return replyOK
+}
+
+func cmdTime(s *Server, c *conn, args []string) interface{} {
+	now := s.now()
+	return []interface{}{
+		strconv.FormatInt(now.Unix(), 10),
+		strconv.Itoa(now.Nanosecond() / 1000),
+	}
+}
+
+// infoField is a field of a section of the INFO reply
+type infoField struct {
+	name, value string
+}
+
+// cmdInfo replies with the default sections, every section with "all", or a
+// single section
+func cmdInfo(s *Server, c *conn, args []string) interface{} {
+	section := "default"
+	if len(args) > 0 {
+		section = strings.ToLower(args[0])
+	}
+	var b strings.Builder
+	for _, name := range []string{"Server", "Clients", "Memory", "Stats", "Replication", "Keyspace", "Commandstats"} {
+		lower := strings.ToLower(name)
+		switch {
+		case section == "all", section == lower:
+		case section == "default" && lower != "commandstats":
+		default:
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", name)
+		for _, f := range s.infoSection(lower) {
+			fmt.Fprintf(&b, "%s:%s\r\n", f.name, f.value)
+		}
+	}
+	return b.String()
+}
+
+// infoSection returns the fields of the section, including those set with
+// SetInfo
+func (s *Server) infoSection(section string) []infoField {
+	var fields []infoField
+	switch section {
+	case "server":
+		fields = []infoField{{"redis_version", "3.2.0"}, {"redis_mode", "standalone"}}
+	case "clients":
+		fields = []infoField{{"connected_clients", strconv.Itoa(len(s.conns))}}
+	case "memory":
+		fields = []infoField{{"used_memory", "0"}}
+	case "stats":
+		var calls int
+		for _, n := range s.counts {
+			calls += n
+		}
+		fields = []infoField{
+			{"total_commands_processed", strconv.Itoa(calls)},
+			{"evicted_keys", "0"},
+			{"keyspace_hits", "0"},
+			{"keyspace_misses", "0"},
+		}
+	case "replication":
+		fields = []infoField{{"role", "master"}, {"connected_slaves", "0"}}
+	case "keyspace":
+		if n := len(s.db.keys("*")); n > 0 {
+			fields = []infoField{{"db0", fmt.Sprintf("keys=%d,expires=0,avg_ttl=0", n)}}
+		}
+	case "commandstats":
+		names := make([]string, 0, len(s.counts))
+		for name := range s.counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fields = append(fields, infoField{
+				"cmdstat_" + strings.ToLower(name),
+				fmt.Sprintf("calls=%d,usec=0,usec_per_call=0.00", s.counts[name]),
+			})
+		}
+	}
+	overrides := s.info[section]
+	for i, f := range fields {
+		if value, ok := overrides[f.name]; ok {
+			fields[i].value = value
+		}
+	}
+	var extra []string
+	for name := range overrides {
+		found := false
+		for _, f := range fields {
+			found = found || f.name == name
+		}
+		if !found {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		fields = append(fields, infoField{name, overrides[name]})
+	}
+	return fields
+}
+
+func cmdDel(s *Server, c *conn, args []string) interface{} {
+	var n int
+	for _, key := range args {
+		if s.db.del(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *Server, c *conn, args []string) interface{} {
+	var n int
+	for _, key := range args {
+		if s.db.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// cmdExpire handles the expire commands. unit is the unit of the argument and
+// at is true when the argument is a unix timestamp rather than a TTL.
+func cmdExpire(unit time.Duration, at bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		n, err := parseInt(args[1])
+		if err != "" {
+			return err
+		}
+		e := s.db.lookup(args[0])
+		if e == nil {
+			return 0
+		}
+		expireAt := s.now().Add(time.Duration(n) * unit)
+		if at {
+			expireAt = time.Unix(0, 0).Add(time.Duration(n) * unit)
+		}
+		if !expireAt.After(s.now()) {
+			s.db.del(args[0])
+			return 1
+		}
+		e.expireAt = expireAt
+		return 1
+	}
+}
+
+func cmdTTL(unit time.Duration) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		e := s.db.lookup(args[0])
+		switch {
+		case e == nil:
+			return -2
+		case e.expireAt.IsZero():
+			return -1
+		}
+		ttl := e.expireAt.Sub(s.now())
+		return int64((ttl + unit/2) / unit)
+	}
+}
+
+func cmdPersist(s *Server, c *conn, args []string) interface{} {
+	e := s.db.lookup(args[0])
+	if e == nil || e.expireAt.IsZero() {
+		return 0
+	}
+	e.expireAt = time.Time{}
+	return 1
+}
+
+func cmdKeys(s *Server, c *conn, args []string) interface{} {
+	return s.db.keys(args[0])
+}
+
+// cmdScan returns every matching key in a single iteration
+func cmdScan(s *Server, c *conn, args []string) interface{} {
+	pattern := "*"
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return redisError("ERR syntax error")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if _, err := parseInt(args[i+1]); err != "" {
+				return err
+			}
+		default:
+			return redisError("ERR syntax error")
+		}
+	}
+	return []interface{}{"0", s.db.keys(pattern)}
+}
+
+func cmdRename(s *Server, c *conn, args []string) interface{} {
+	e := s.db.lookup(args[0])
+	if e == nil {
+		return redisError("ERR no such key")
+	}
+	delete(s.db.entries, args[0])
+	s.db.entries[args[1]] = e
+	return replyOK
+}
+
+func cmdType(s *Server, c *conn, args []string) interface{} {
+	e := s.db.lookup(args[0])
+	if e == nil {
+		return status("none")
+	}
+	return status(e.kind)
+}
+
+// cmdMulti, cmdExec and cmdDiscard implement transactions. WATCH is accepted
+// but never aborts a transaction since the server runs commands one at a time.
+func cmdMulti(s *Server, c *conn, args []string) interface{} {
+	if c.multi {
+		return redisError("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	c.multiErr = false
+	c.queued = nil
+	return replyOK
+}
+
+func cmdExec(s *Server, c *conn, args []string) interface{} {
+	if !c.multi {
+		return redisError("ERR EXEC without MULTI")
+	}
+	queued, failed := c.queued, c.multiErr
+	c.multi, c.multiErr, c.queued = false, false, nil
+	if failed {
+		return redisError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	results := make([]interface{}, 0, len(queued))
+	for _, args := range queued {
+		results = append(results, s.dispatch(c, args[0], args[1:]))
+	}
+	return results
+}
+
+func cmdDiscard(s *Server, c *conn, args []string) interface{} {
+	if !c.multi {
+		return redisError("ERR DISCARD without MULTI")
+	}
+	c.multi, c.multiErr, c.queued = false, false, nil
+	return replyOK
+}
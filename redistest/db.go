@@ -0,0 +1,207 @@
+package redistest
+
+import (
+	"sort"
+	"time"
+)
+
+// The kinds of values that can be stored under a key. They match the replies
+// of the TYPE command.
+const (
+	kindString = "string"
+	kindHash   = "hash"
+	kindList   = "list"
+	kindSet    = "set"
+	kindZSet   = "zset"
+)
+
+const wrongType = redisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// entry is a value stored under a key
+type entry struct {
+	kind     string
+	str      string
+	hash     map[string]string
+	list     []string
+	set      map[string]struct{}
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// db is the keyspace of the server. It is not safe for concurrent use, the
+// server lock must be held while using it.
+type db struct {
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+func newDB(now func() time.Time) *db {
+	return &db{
+		entries: map[string]*entry{},
+		now:     now,
+	}
+}
+
+// lookup returns the entry stored under key, removing it if it has expired
+func (d *db) lookup(key string) *entry {
+	e, ok := d.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(d.now()) {
+		delete(d.entries, key)
+		return nil
+	}
+	return e
+}
+
+// lookupKind returns the entry stored under key. A wrongType error is returned
+// when the entry is of a different kind.
+func (d *db) lookupKind(key, kind string) (*entry, redisError) {
+	e := d.lookup(key)
+	if e != nil && e.kind != kind {
+		return nil, wrongType
+	}
+	return e, ""
+}
+
+// create returns the entry stored under key, creating an empty entry of the
+// given kind if the key doesn't exist.
+func (d *db) create(key, kind string) (*entry, redisError) {
+	e, err := d.lookupKind(key, kind)
+	if err != "" || e != nil {
+		return e, err
+	}
+	e = &entry{kind: kind}
+	switch kind {
+	case kindHash:
+		e.hash = map[string]string{}
+	case kindSet:
+		e.set = map[string]struct{}{}
+	case kindZSet:
+		e.zset = map[string]float64{}
+	}
+	d.entries[key] = e
+	return e, ""
+}
+
+// removeIfEmpty deletes container entries that no longer hold any elements
+func (d *db) removeIfEmpty(key string, e *entry) {
+	var size int
+	switch e.kind {
+	case kindHash:
+		size = len(e.hash)
+	case kindList:
+		size = len(e.list)
+	case kindSet:
+		size = len(e.set)
+	case kindZSet:
+		size = len(e.zset)
+	default:
+		return
+	}
+	if size == 0 {
+		delete(d.entries, key)
+	}
+}
+
+func (d *db) del(key string) bool {
+	if d.lookup(key) == nil {
+		return false
+	}
+	delete(d.entries, key)
+	return true
+}
+
+// keys returns the sorted live keys matching the glob pattern
+func (d *db) keys(pattern string) []string {
+	keys := []string{}
+	for key := range d.entries {
+		if d.lookup(key) != nil && match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *db) flush() {
+	d.entries = map[string]*entry{}
+}
+
+// match reports whether s matches the redis glob style pattern
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := 1
+			for end < len(pattern) && pattern[end] != ']' {
+				end++
+			}
+			if end == len(pattern) {
+				return false
+			}
+			if !matchClass(pattern[1:end], s[0]) {
+				return false
+			}
+			pattern = pattern[end:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+func matchClass(class string, c byte) bool {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+	matched := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= c && c <= class[i+2] {
+				matched = true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == c {
+			matched = true
+		}
+	}
+	return matched != negate
+}
@@ -0,0 +1,209 @@
+package redistest
+
+import (
+	"sort"
+	"strconv"
+)
+
+func sortedFields(h map[string]string) []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func cmdHGet(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	v, ok := e.hash[args[1]]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// cmdHSet sets one or more field value pairs and returns the number of new
+// fields
+func cmdHSet(s *Server, c *conn, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return redisError("ERR wrong number of arguments for 'hset' command")
+	}
+	e, err := s.db.create(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	var added int
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := e.hash[args[i]]; !ok {
+			added++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	return added
+}
+
+func cmdHMSet(s *Server, c *conn, args []string) interface{} {
+	reply := cmdHSet(s, c, args)
+	if _, ok := reply.(redisError); ok {
+		return reply
+	}
+	return replyOK
+}
+
+func cmdHSetNX(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.create(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	if _, ok := e.hash[args[1]]; ok {
+		return 0
+	}
+	e.hash[args[1]] = args[2]
+	return 1
+}
+
+func cmdHMGet(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	values := make([]interface{}, len(args)-1)
+	if e == nil {
+		return values
+	}
+	for i, f := range args[1:] {
+		if v, ok := e.hash[f]; ok {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func cmdHDel(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	var n int
+	for _, f := range args[1:] {
+		if _, ok := e.hash[f]; ok {
+			delete(e.hash, f)
+			n++
+		}
+	}
+	s.db.removeIfEmpty(args[0], e)
+	return n
+}
+
+func cmdHLen(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	return len(e.hash)
+}
+
+func cmdHExists(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	_, ok := e.hash[args[1]]
+	return ok
+}
+
+func cmdHGetAll(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	values := []string{}
+	if e == nil {
+		return values
+	}
+	for _, f := range sortedFields(e.hash) {
+		values = append(values, f, e.hash[f])
+	}
+	return values
+}
+
+func cmdHKeys(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return []string{}
+	}
+	return sortedFields(e.hash)
+}
+
+func cmdHVals(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	values := []string{}
+	if e == nil {
+		return values
+	}
+	for _, f := range sortedFields(e.hash) {
+		values = append(values, e.hash[f])
+	}
+	return values
+}
+
+func cmdHIncrBy(s *Server, c *conn, args []string) interface{} {
+	by, err := parseInt(args[2])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.create(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	var n int64
+	if v, ok := e.hash[args[1]]; ok {
+		if n, err = parseInt(v); err != "" {
+			return redisError("ERR hash value is not an integer")
+		}
+	}
+	n += by
+	e.hash[args[1]] = strconv.FormatInt(n, 10)
+	return n
+}
+
+func cmdHIncrByFloat(s *Server, c *conn, args []string) interface{} {
+	by, err := parseFloat(args[2])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.create(args[0], kindHash)
+	if err != "" {
+		return err
+	}
+	var f float64
+	if v, ok := e.hash[args[1]]; ok {
+		if f, err = parseFloat(v); err != "" {
+			return redisError("ERR hash value is not a valid float")
+		}
+	}
+	e.hash[args[1]] = formatFloat(f + by)
+	return e.hash[args[1]]
+}
+
+// orZero returns err if it is set and a zero integer reply otherwise. It is
+// used by commands that reply with 0 for missing keys.
+func orZero(err redisError) interface{} {
+	if err != "" {
+		return err
+	}
+	return 0
+}
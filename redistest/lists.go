@@ -0,0 +1,111 @@
+package redistest
+
+// cmdPush handles LPUSH and RPUSH
+func cmdPush(left bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		e, err := s.db.create(args[0], kindList)
+		if err != "" {
+			return err
+		}
+		for _, v := range args[1:] {
+			if left {
+				e.list = append([]string{v}, e.list...)
+			} else {
+				e.list = append(e.list, v)
+			}
+		}
+		return len(e.list)
+	}
+}
+
+// cmdPop handles LPOP and RPOP
+func cmdPop(left bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		e, err := s.db.lookupKind(args[0], kindList)
+		if err != "" {
+			return err
+		}
+		if e == nil {
+			return nil
+		}
+		var v string
+		if left {
+			v, e.list = e.list[0], e.list[1:]
+		} else {
+			v, e.list = e.list[len(e.list)-1], e.list[:len(e.list)-1]
+		}
+		s.db.removeIfEmpty(args[0], e)
+		return v
+	}
+}
+
+func cmdLLen(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindList)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	return len(e.list)
+}
+
+func cmdLIndex(s *Server, c *conn, args []string) interface{} {
+	i, err := parseInt(args[1])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.lookupKind(args[0], kindList)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	if i < 0 {
+		i += int64(len(e.list))
+	}
+	if i < 0 || i >= int64(len(e.list)) {
+		return nil
+	}
+	return e.list[i]
+}
+
+func cmdLRange(s *Server, c *conn, args []string) interface{} {
+	start, err := parseInt(args[1])
+	if err != "" {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.lookupKind(args[0], kindList)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return []string{}
+	}
+	from, to := normalizeRange(start, stop, len(e.list))
+	return append([]string{}, e.list[from:to]...)
+}
+
+func cmdLTrim(s *Server, c *conn, args []string) interface{} {
+	start, err := parseInt(args[1])
+	if err != "" {
+		return err
+	}
+	stop, err := parseInt(args[2])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.lookupKind(args[0], kindList)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return replyOK
+	}
+	from, to := normalizeRange(start, stop, len(e.list))
+	e.list = append([]string{}, e.list[from:to]...)
+	s.db.removeIfEmpty(args[0], e)
+	return replyOK
+}
@@ -0,0 +1,119 @@
+package redistest
+
+// cmdSubscribe handles SUBSCRIBE and PSUBSCRIBE
+func cmdSubscribe(pattern bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		kind, subs, mine := "subscribe", s.channels, c.channels
+		if pattern {
+			kind, subs, mine = "psubscribe", s.patterns, c.patterns
+		}
+		out := make(replies, 0, len(args))
+		for _, name := range args {
+			if subs[name] == nil {
+				subs[name] = map[*conn]struct{}{}
+			}
+			subs[name][c] = struct{}{}
+			mine[name] = struct{}{}
+			out = append(out, []interface{}{kind, name, c.subscriptions()})
+		}
+		return out
+	}
+}
+
+// cmdUnsubscribe handles UNSUBSCRIBE and PUNSUBSCRIBE. Without arguments the
+// connection is unsubscribed from every channel or pattern.
+func cmdUnsubscribe(pattern bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		kind, subs, mine := "unsubscribe", s.channels, c.channels
+		if pattern {
+			kind, subs, mine = "punsubscribe", s.patterns, c.patterns
+		}
+		if len(args) == 0 {
+			for name := range mine {
+				args = append(args, name)
+			}
+		}
+		if len(args) == 0 {
+			return []interface{}{kind, nil, c.subscriptions()}
+		}
+		out := make(replies, 0, len(args))
+		for _, name := range args {
+			unsubscribe(subs, name, c)
+			delete(mine, name)
+			out = append(out, []interface{}{kind, name, c.subscriptions()})
+		}
+		return out
+	}
+}
+
+func unsubscribe(subs map[string]map[*conn]struct{}, name string, c *conn) {
+	delete(subs[name], c)
+	if len(subs[name]) == 0 {
+		delete(subs, name)
+	}
+}
+
+// unsubscribeAll removes every subscription of a closed connection. The
+// server lock must be held.
+func (s *Server) unsubscribeAll(c *conn) {
+	for name := range c.channels {
+		unsubscribe(s.channels, name, c)
+	}
+	for name := range c.patterns {
+		unsubscribe(s.patterns, name, c)
+	}
+}
+
+// delivery is a pub/sub message waiting to be written to a subscriber
+type delivery struct {
+	conn  *conn
+	reply interface{}
+}
+
+// cmdPublish queues the message for its subscribers. The messages are
+// written once the server lock is released, so a slow subscriber doesn't
+// stall the server.
+func cmdPublish(s *Server, c *conn, args []string) interface{} {
+	channel, msg := args[0], args[1]
+	var n int
+	for sub := range s.channels[channel] {
+		s.outbox = append(s.outbox, delivery{sub, []interface{}{"message", channel, msg}})
+		n++
+	}
+	for pattern, conns := range s.patterns {
+		if !match(pattern, channel) {
+			continue
+		}
+		for sub := range conns {
+			s.outbox = append(s.outbox, delivery{sub, []interface{}{"pmessage", pattern, channel, msg}})
+			n++
+		}
+	}
+	return n
+}
+
+// takeOutbox returns the queued messages. The server lock must be held.
+func (s *Server) takeOutbox() []delivery {
+	out := s.outbox
+	s.outbox = nil
+	return out
+}
+
+// deliver writes the messages to their subscribers. The server lock must not
+// be held.
+func deliver(out []delivery) {
+	for _, d := range out {
+		d.conn.send(d.reply)
+	}
+}
+
+// Publish sends msg to the subscribers of channel and returns the number of
+// clients that received it
+func (s *Server) Publish(channel, msg string) int {
+	s.mu.Lock()
+	n := cmdPublish(s, nil, []string{channel, msg}).(int)
+	out := s.takeOutbox()
+	s.mu.Unlock()
+	deliver(out)
+	return n
+}
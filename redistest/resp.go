@@ -0,0 +1,127 @@
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The following types are replies understood by writeReply. Handlers may also
+// return an int64 (integer reply), a string (bulk reply), nil (null bulk reply)
+// or a []interface{} (array reply) holding any of these.
+type (
+	// status is a simple string reply such as OK
+	status string
+
+	// redisError is an error reply
+	redisError string
+
+	// nilArray is a null array reply
+	nilArray struct{}
+
+	// replies are written one after another rather than as an array. It is
+	// used by the subscribe commands which reply once per channel.
+	replies []interface{}
+)
+
+var (
+	replyOK     = status("OK")
+	replyQueued = status("QUEUED")
+)
+
+func errorf(format string, args ...interface{}) redisError {
+	return redisError(fmt.Sprintf(format, args...))
+}
+
+var errProtocol = errors.New("redistest: protocol error")
+
+// readCommand reads a single command either as a RESP array of bulk strings or
+// as an inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case redisError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case bool:
+		if v {
+			fmt.Fprint(w, ":1\r\n")
+		} else {
+			fmt.Fprint(w, ":0\r\n")
+		}
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case nil:
+		fmt.Fprint(w, "$-1\r\n")
+	case nilArray:
+		fmt.Fprint(w, "*-1\r\n")
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, s := range v {
+			writeReply(w, s)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, r := range v {
+			writeReply(w, r)
+		}
+	case replies:
+		for _, r := range v {
+			writeReply(w, r)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR redistest: unsupported reply type %T\r\n", v)
+	}
+}
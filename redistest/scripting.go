@@ -0,0 +1,116 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// ScriptFunc stubs the behaviour of a lua script since the server can't run
+// lua. It returns the reply of the script which may be a string, []byte, int,
+// int64, bool, nil, []string or []interface{} of these. A returned error is
+// sent to the client as an error reply.
+//
+// ScriptFunc is called with the server locked and must not call methods on
+// the Server.
+type ScriptFunc func(keys, args []string) (interface{}, error)
+
+// RegisterScript sets the stub that runs when the script with the given
+// source is evaluated. The script is not added to the script cache, use
+// SCRIPT LOAD or EVAL for that like a client would.
+func (s *Server) RegisterScript(src string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stubs[scriptSha(src)] = fn
+}
+
+func scriptSha(src string) string {
+	h := sha1.Sum([]byte(src))
+	return hex.EncodeToString(h[:])
+}
+
+func cmdEval(s *Server, c *conn, args []string) interface{} {
+	sha := scriptSha(args[0])
+	s.scripts[sha] = args[0]
+	return s.runScript(sha, args[1:])
+}
+
+func cmdEvalSha(s *Server, c *conn, args []string) interface{} {
+	sha := strings.ToLower(args[0])
+	if _, ok := s.scripts[sha]; !ok {
+		return redisError("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return s.runScript(sha, args[1:])
+}
+
+// runScript calls the stub of the script. args holds the number of keys
+// followed by the keys and arguments of the script.
+func (s *Server) runScript(sha string, args []string) interface{} {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys < 0 {
+		return redisError("ERR value is not an integer or out of range")
+	}
+	if numKeys > len(args)-1 {
+		return redisError("ERR Number of keys can't be greater than number of args")
+	}
+	fn, ok := s.stubs[sha]
+	if !ok {
+		return errorf("ERR redistest: no stub registered for script %s", sha)
+	}
+	keys, argv := args[1:1+numKeys], args[1+numKeys:]
+	v, scriptErr := fn(keys, argv)
+	if scriptErr != nil {
+		return redisError(scriptErr.Error())
+	}
+	return scriptReply(v)
+}
+
+// scriptReply converts the value returned by a ScriptFunc to a reply the way
+// redis converts lua values.
+func scriptReply(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return nil
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = scriptReply(v[i])
+		}
+		return values
+	case error:
+		return redisError(v.Error())
+	}
+	return v
+}
+
+func cmdScript(s *Server, c *conn, args []string) interface{} {
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "LOAD":
+		if len(args) != 2 {
+			return redisError("ERR wrong number of arguments for 'script|load' command")
+		}
+		sha := scriptSha(args[1])
+		s.scripts[sha] = args[1]
+		return sha
+	case "EXISTS":
+		exists := make([]interface{}, 0, len(args)-1)
+		for _, sha := range args[1:] {
+			_, ok := s.scripts[strings.ToLower(sha)]
+			exists = append(exists, ok)
+		}
+		return exists
+	case "FLUSH":
+		s.scripts = map[string]string{}
+		return replyOK
+	case "KILL":
+		return redisError("NOTBUSY No scripts in execution right now.")
+	default:
+		return errorf("ERR unknown subcommand '%s'", strings.ToLower(sub))
+	}
+}
@@ -0,0 +1,389 @@
+// Package redistest provides an in-process redis server speaking RESP so code
+// using the wrapped clients can be tested without a real redis.
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault describes a failure injected into the commands handled by the server
+type Fault struct {
+	// Command is the name of the command the fault applies to. An empty
+	// command applies the fault to every command.
+	Command string
+
+	// Latency delays the reply to the command
+	Latency time.Duration
+
+	// Err is returned as an error reply instead of running the command
+	Err string
+
+	// Drop closes the client connection instead of replying
+	Drop bool
+
+	// Times is the number of commands the fault applies to before it is
+	// removed. Zero applies the fault until ClearFaults is called.
+	Times int
+}
+
+// Server is an in-process redis server. It supports the commonly used string,
+// key, hash, list, set, sorted set, transaction, scripting and pub/sub commands.
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	db       *db
+	offset   time.Duration
+	conns    map[*conn]struct{}
+	faults   []*Fault
+	counts   map[string]int
+	info     map[string]map[string]string
+	scripts  map[string]string
+	stubs    map[string]ScriptFunc
+	channels map[string]map[*conn]struct{}
+	patterns map[string]map[*conn]struct{}
+	outbox   []delivery
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a server listening on a random local port
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		conns:    map[*conn]struct{}{},
+		counts:   map[string]int{},
+		info:     map[string]map[string]string{},
+		scripts:  map[string]string{},
+		stubs:    map[string]ScriptFunc{},
+		channels: map[string]map[*conn]struct{}{},
+		patterns: map[string]map[*conn]struct{}{},
+	}
+	s.db = newDB(s.now)
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all client connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+// AddFault injects a failure into the commands handled by the server
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.Command = strings.ToUpper(f.Command)
+	s.faults = append(s.faults, &f)
+}
+
+// SetLatency delays the replies to every command by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.AddFault(Fault{Latency: d})
+}
+
+// SetError makes command reply with the given error message
+func (s *Server) SetError(command, msg string) {
+	s.AddFault(Fault{Command: command, Err: msg})
+}
+
+// ClearFaults removes all injected failures
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// DropConnections closes every open client connection
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+}
+
+// CommandCount returns the number of times command was received by the server
+func (s *Server) CommandCount(command string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[strings.ToUpper(command)]
+}
+
+// ResetCounts clears the command counts
+func (s *Server) ResetCounts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts = map[string]int{}
+}
+
+// SetInfo sets the value of a field of a section of the INFO reply, such as
+// SetInfo("memory", "used_memory", "1024"), overriding the value computed by
+// the server
+func (s *Server) SetInfo(section, field, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	section = strings.ToLower(section)
+	if s.info[section] == nil {
+		s.info[section] = map[string]string{}
+	}
+	s.info[section][field] = value
+}
+
+// FastForward moves the clock of the server forward, expiring keys whose TTL
+// has elapsed.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// FlushAll removes every key
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db.flush()
+}
+
+// Set stores a string value under key
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db.entries[key] = &entry{kind: kindString, str: value}
+}
+
+// Get returns the string value stored under key
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.db.lookupKind(key, kindString)
+	if err != "" || e == nil {
+		return "", false
+	}
+	return e.str, true
+}
+
+// Exists reports whether key exists
+func (s *Server) Exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.lookup(key) != nil
+}
+
+// TTL returns the time to live of key. Zero is returned for keys without an
+// expiration.
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.db.lookup(key)
+	if e == nil || e.expireAt.IsZero() {
+		return 0
+	}
+	return e.expireAt.Sub(s.now())
+}
+
+// Keys returns every key matching the glob pattern
+func (s *Server) Keys(pattern string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.keys(pattern)
+}
+
+// Do runs a command directly against the server, bypassing injected faults.
+// It is useful for setting up data that has no helper method. Error replies
+// are returned as errors. Commands holding connection state, such as
+// SUBSCRIBE or MULTI, aren't supported since Do has no connection.
+func (s *Server) Do(args ...string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("redistest: no command")
+	}
+	name := strings.ToUpper(args[0])
+	if connectionCommands[name] {
+		return nil, errors.New("redistest: " + name + " needs a connection")
+	}
+	s.mu.Lock()
+	reply := s.dispatch(newConn(nil), name, args[1:])
+	out := s.takeOutbox()
+	s.mu.Unlock()
+	deliver(out)
+	if err, ok := reply.(redisError); ok {
+		return nil, errors.New(string(err))
+	}
+	return reply, nil
+}
+
+// connectionCommands are the commands Do rejects
+var connectionCommands = map[string]bool{
+	"SUBSCRIBE":  true,
+	"PSUBSCRIBE": true,
+	"MULTI":      true,
+	"WATCH":      true,
+}
+
+// now returns the server clock. The server lock must be held.
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := newConn(nc)
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c)
+		}()
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	defer func() {
+		_ = c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.unsubscribeAll(c)
+		s.mu.Unlock()
+	}()
+
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(args[0])
+
+		s.mu.Lock()
+		s.counts[name]++
+		f := s.takeFaults(name)
+		s.mu.Unlock()
+
+		if f != nil {
+			time.Sleep(f.Latency)
+			if f.Drop {
+				return
+			}
+			if f.Err != "" {
+				c.send(redisError(f.Err))
+				continue
+			}
+		}
+
+		s.mu.Lock()
+		reply := s.dispatch(c, name, args[1:])
+		out := s.takeOutbox()
+		s.mu.Unlock()
+
+		deliver(out)
+		c.send(reply)
+		if name == "QUIT" {
+			return
+		}
+	}
+}
+
+// takeFaults returns the faults matching command combined into one, or nil
+// when none matches. Their latencies add up, the connection is dropped when
+// any of them drops it and the error of the first fault with one is
+// replied. The server lock must be held.
+func (s *Server) takeFaults(command string) *Fault {
+	var (
+		combined *Fault
+		kept     = s.faults[:0]
+	)
+	for _, f := range s.faults {
+		if f.Command != "" && f.Command != command {
+			kept = append(kept, f)
+			continue
+		}
+		if combined == nil {
+			combined = &Fault{Command: command}
+		}
+		combined.Latency += f.Latency
+		combined.Drop = combined.Drop || f.Drop
+		if combined.Err == "" {
+			combined.Err = f.Err
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				continue
+			}
+		}
+		kept = append(kept, f)
+	}
+	s.faults = kept
+	return combined
+}
+
+// conn is a client connection to the server
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+
+	mu sync.Mutex
+	w  *bufio.Writer
+
+	// The following fields are guarded by the server lock
+	multi    bool
+	multiErr bool
+	queued   [][]string
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{
+		Conn:     nc,
+		r:        bufio.NewReader(nc),
+		w:        bufio.NewWriter(nc),
+		channels: map[string]struct{}{},
+		patterns: map[string]struct{}{},
+	}
+}
+
+// send writes reply to the client. It is safe for concurrent use so pub/sub
+// messages can be delivered from other connections.
+func (c *conn) send(reply interface{}) {
+	if c.Conn == nil {
+		// the connection of Do
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeReply(c.w, reply)
+	_ = c.w.Flush()
+}
+
+func (c *conn) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
@@ -0,0 +1,189 @@
+package redistest
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	redis "gopkg.in/redis.v4"
+)
+
+func newTestServer(t *testing.T) (*Server, *redis.Client) {
+	t.Helper()
+	s, err := NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	c := redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: 0})
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = s.Close()
+	})
+	return s, c
+}
+
+func TestStrings(t *testing.T) {
+	s, c := newTestServer(t)
+	if err := c.Set("key", "41", time.Second).Err(); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if n, err := c.Incr("key").Result(); err != nil || n != 42 {
+		t.Fatalf("INCR = %d, %v, want 42", n, err)
+	}
+	if v, ok := s.Get("key"); !ok || v != "42" {
+		t.Fatalf("Get = %q, %v, want 42", v, ok)
+	}
+	s.FastForward(2 * time.Second)
+	if err := c.Get("key").Err(); err != redis.Nil {
+		t.Fatalf("GET after expiry = %v, want redis.Nil", err)
+	}
+	if got := s.CommandCount("incr"); got != 1 {
+		t.Errorf("CommandCount(incr) = %d, want 1", got)
+	}
+}
+
+func TestFaultsCombine(t *testing.T) {
+	s, c := newTestServer(t)
+	s.SetLatency(20 * time.Millisecond)
+	s.AddFault(Fault{Command: "get", Latency: 20 * time.Millisecond, Err: "ERR injected", Times: 1})
+
+	start := time.Now()
+	err := c.Get("key").Err()
+	if err == nil || err.Error() != "ERR injected" {
+		t.Fatalf("GET = %v, want ERR injected", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("GET took %v, want the latencies of both faults", elapsed)
+	}
+	if err := c.Get("key").Err(); err != redis.Nil {
+		t.Errorf("GET after the fault = %v, want redis.Nil", err)
+	}
+	s.ClearFaults()
+}
+
+func TestFaultDrop(t *testing.T) {
+	s, c := newTestServer(t)
+	s.AddFault(Fault{Command: "ping", Drop: true, Times: 1})
+	if err := c.Ping().Err(); err == nil {
+		t.Fatal("PING succeeded on a dropped connection")
+	}
+	if err := c.Ping().Err(); err != nil {
+		t.Fatalf("PING after the fault: %v", err)
+	}
+}
+
+func TestDo(t *testing.T) {
+	s, c := newTestServer(t)
+	if _, err := s.Do("HSET", "hash", "field", "value"); err != nil {
+		t.Fatalf("Do(HSET): %v", err)
+	}
+	if v, err := c.HGet("hash", "field").Result(); err != nil || v != "value" {
+		t.Fatalf("HGET = %q, %v, want value", v, err)
+	}
+	if _, err := s.Do("SUBSCRIBE", "channel"); err == nil {
+		t.Fatal("Do(SUBSCRIBE) succeeded")
+	}
+	if _, err := s.Do("PUBLISH", "channel", "message"); err != nil {
+		t.Fatalf("Do(PUBLISH): %v", err)
+	}
+	if _, err := s.Do("GET", "hash"); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Errorf("Do(GET) on a hash = %v, want WRONGTYPE", err)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	s, c := newTestServer(t)
+	ps, err := c.PSubscribe("news.*")
+	if err != nil {
+		t.Fatalf("PSUBSCRIBE: %v", err)
+	}
+	defer ps.Close()
+	// the subscription is registered once its reply is received
+	if _, err := ps.ReceiveTimeout(time.Second); err != nil {
+		t.Fatalf("receiving the subscription: %v", err)
+	}
+	if n := s.Publish("news.today", "hello"); n != 1 {
+		t.Fatalf("Publish = %d, want 1", n)
+	}
+	msg, err := ps.ReceiveMessage()
+	if err != nil {
+		t.Fatalf("receiving the message: %v", err)
+	}
+	if msg.Channel != "news.today" || msg.Pattern != "news.*" || msg.Payload != "hello" {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	s, c := newTestServer(t)
+	// a subscriber never reading its messages
+	nc, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer nc.Close()
+	if _, err := nc.Write([]byte("*2\r\n$9\r\nSUBSCRIBE\r\n$7\r\nchannel\r\n")); err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if n, _ := s.Do("PUBLISH", "channel", "probe"); n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the subscription wasn't registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// publish until the socket buffers of the subscriber are full
+	go func() {
+		msg := strings.Repeat("x", 1<<20)
+		for i := 0; i < 64; i++ {
+			s.Publish("channel", msg)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Ping().Err()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("PING: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow subscriber stalled the server")
+	}
+	_ = nc.Close()
+}
+
+func TestInfo(t *testing.T) {
+	s, c := newTestServer(t)
+	s.SetInfo("memory", "used_memory", "1024")
+	s.SetInfo("stats", "custom", "1")
+
+	got, err := c.Info("memory").Result()
+	if err != nil {
+		t.Fatalf("INFO: %v", err)
+	}
+	if want := "# Memory\r\nused_memory:1024\r\n"; got != want {
+		t.Errorf("INFO memory = %q, want %q", got, want)
+	}
+	all, err := c.Info("all").Result()
+	if err != nil {
+		t.Fatalf("INFO all: %v", err)
+	}
+	for _, want := range []string{"# Commandstats\r\n", "cmdstat_info:calls=2", "custom:1\r\n"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("INFO all = %q, missing %q", all, want)
+		}
+	}
+	def, _ := c.Info().Result()
+	if strings.Contains(def, "# Commandstats") {
+		t.Errorf("INFO = %q, want no commandstats", def)
+	}
+}
@@ -0,0 +1,372 @@
+package redistest
+
+import (
+	"sort"
+	"strings"
+)
+
+func cmdSAdd(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.create(args[0], kindSet)
+	if err != "" {
+		return err
+	}
+	var n int
+	for _, m := range args[1:] {
+		if _, ok := e.set[m]; !ok {
+			e.set[m] = struct{}{}
+			n++
+		}
+	}
+	return n
+}
+
+func cmdSRem(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindSet)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	var n int
+	for _, m := range args[1:] {
+		if _, ok := e.set[m]; ok {
+			delete(e.set, m)
+			n++
+		}
+	}
+	s.db.removeIfEmpty(args[0], e)
+	return n
+}
+
+func cmdSMembers(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindSet)
+	if err != "" {
+		return err
+	}
+	members := []string{}
+	if e == nil {
+		return members
+	}
+	for m := range e.set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func cmdSIsMember(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindSet)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	_, ok := e.set[args[1]]
+	return ok
+}
+
+func cmdSCard(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindSet)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	return len(e.set)
+}
+
+// zmember is a sorted set member with its score
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sortedMembers returns the members of a sorted set ordered by score and then
+// lexicographically by member
+func sortedMembers(z map[string]float64) []zmember {
+	members := make([]zmember, 0, len(z))
+	for m, score := range z {
+		members = append(members, zmember{m, score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func zmemberReply(members []zmember, withScores bool) []string {
+	values := []string{}
+	for _, m := range members {
+		values = append(values, m.member)
+		if withScores {
+			values = append(values, formatFloat(m.score))
+		}
+	}
+	return values
+}
+
+// cmdZAdd supports the NX, XX and CH options
+func cmdZAdd(s *Server, c *conn, args []string) interface{} {
+	var nx, xx, ch bool
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) {
+		return redisError("ERR syntax error")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		f, err := parseFloat(pairs[2*j])
+		if err != "" {
+			return err
+		}
+		scores[j] = f
+	}
+	e, err := s.db.create(args[0], kindZSet)
+	if err != "" {
+		return err
+	}
+	var added, changed int
+	for j, score := range scores {
+		m := pairs[2*j+1]
+		old, exists := e.zset[m]
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+		e.zset[m] = score
+	}
+	s.db.removeIfEmpty(args[0], e)
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZRem(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindZSet)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	var n int
+	for _, m := range args[1:] {
+		if _, ok := e.zset[m]; ok {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	s.db.removeIfEmpty(args[0], e)
+	return n
+}
+
+func cmdZScore(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindZSet)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	score, ok := e.zset[args[1]]
+	if !ok {
+		return nil
+	}
+	return formatFloat(score)
+}
+
+func cmdZCard(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindZSet)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	return len(e.zset)
+}
+
+func cmdZIncrBy(s *Server, c *conn, args []string) interface{} {
+	by, err := parseFloat(args[1])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.create(args[0], kindZSet)
+	if err != "" {
+		return err
+	}
+	e.zset[args[2]] += by
+	return formatFloat(e.zset[args[2]])
+}
+
+func cmdZRank(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindZSet)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	for i, m := range sortedMembers(e.zset) {
+		if m.member == args[1] {
+			return i
+		}
+	}
+	return nil
+}
+
+// cmdZRange handles ZRANGE and ZREVRANGE
+func cmdZRange(reverse bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		start, err := parseInt(args[1])
+		if err != "" {
+			return err
+		}
+		stop, err := parseInt(args[2])
+		if err != "" {
+			return err
+		}
+		withScores := false
+		if len(args) == 4 {
+			if strings.ToUpper(args[3]) != "WITHSCORES" {
+				return redisError("ERR syntax error")
+			}
+			withScores = true
+		}
+		e, err := s.db.lookupKind(args[0], kindZSet)
+		if err != "" {
+			return err
+		}
+		if e == nil {
+			return []string{}
+		}
+		members := sortedMembers(e.zset)
+		if reverse {
+			for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+				members[i], members[j] = members[j], members[i]
+			}
+		}
+		from, to := normalizeRange(start, stop, len(members))
+		return zmemberReply(members[from:to], withScores)
+	}
+}
+
+// scoreBound is a min or max argument of the score range commands
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (scoreBound, redisError) {
+	var b scoreBound
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	f, err := parseFloat(s)
+	if err != "" {
+		return b, "ERR min or max is not a float"
+	}
+	b.value = f
+	return b, ""
+}
+
+func (b scoreBound) above(score float64) bool {
+	if b.exclusive {
+		return score > b.value
+	}
+	return score >= b.value
+}
+
+func (b scoreBound) below(score float64) bool {
+	if b.exclusive {
+		return score < b.value
+	}
+	return score <= b.value
+}
+
+func zrangeByScore(e *entry, min, max scoreBound) []zmember {
+	var members []zmember
+	for _, m := range sortedMembers(e.zset) {
+		if min.above(m.score) && max.below(m.score) {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// cmdZRangeByScore supports the WITHSCORES and LIMIT options
+func cmdZRangeByScore(s *Server, c *conn, args []string) interface{} {
+	min, err := parseScoreBound(args[1])
+	if err != "" {
+		return err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != "" {
+		return err
+	}
+	var (
+		withScores    bool
+		offset, count int64 = 0, -1
+	)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return redisError("ERR syntax error")
+			}
+			if offset, err = parseInt(args[i+1]); err != "" {
+				return err
+			}
+			if count, err = parseInt(args[i+2]); err != "" {
+				return err
+			}
+			i += 2
+		default:
+			return redisError("ERR syntax error")
+		}
+	}
+	e, err := s.db.lookupKind(args[0], kindZSet)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return []string{}
+	}
+	members := zrangeByScore(e, min, max)
+	if offset < 0 || offset >= int64(len(members)) {
+		return []string{}
+	}
+	members = members[offset:]
+	if count >= 0 && count < int64(len(members)) {
+		members = members[:count]
+	}
+	return zmemberReply(members, withScores)
+}
+
+func cmdZCount(s *Server, c *conn, args []string) interface{} {
+	min, err := parseScoreBound(args[1])
+	if err != "" {
+		return err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.lookupKind(args[0], kindZSet)
+	if err != "" || e == nil {
+		return orZero(err)
+	}
+	return len(zrangeByScore(e, min, max))
+}
@@ -0,0 +1,184 @@
+package redistest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *Server) setString(key, value string, ttl time.Duration) {
+	e := &entry{kind: kindString, str: value}
+	if ttl > 0 {
+		e.expireAt = s.now().Add(ttl)
+	}
+	s.db.entries[key] = e
+}
+
+func cmdGet(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindString)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	return e.str
+}
+
+// cmdSet supports the EX, PX, NX and XX options
+func cmdSet(s *Server, c *conn, args []string) interface{} {
+	var (
+		ttl    time.Duration
+		nx, xx bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return redisError("ERR syntax error")
+			}
+			n, err := parseInt(args[i+1])
+			if err != "" {
+				return err
+			}
+			if n <= 0 {
+				return redisError("ERR invalid expire time in set")
+			}
+			ttl = time.Duration(n) * time.Second
+			if opt == "PX" {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+			i++
+		default:
+			return redisError("ERR syntax error")
+		}
+	}
+	exists := s.db.lookup(args[0]) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.setString(args[0], args[1], ttl)
+	return replyOK
+}
+
+func cmdSetNX(s *Server, c *conn, args []string) interface{} {
+	if s.db.lookup(args[0]) != nil {
+		return 0
+	}
+	s.setString(args[0], args[1], 0)
+	return 1
+}
+
+func cmdSetEx(unit time.Duration) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		n, err := parseInt(args[1])
+		if err != "" {
+			return err
+		}
+		if n <= 0 {
+			return redisError("ERR invalid expire time")
+		}
+		s.setString(args[0], args[2], time.Duration(n)*unit)
+		return replyOK
+	}
+}
+
+func cmdGetSet(s *Server, c *conn, args []string) interface{} {
+	old := cmdGet(s, c, args[:1])
+	if _, ok := old.(redisError); ok {
+		return old
+	}
+	s.setString(args[0], args[1], 0)
+	return old
+}
+
+func cmdMGet(s *Server, c *conn, args []string) interface{} {
+	values := make([]interface{}, len(args))
+	for i, key := range args {
+		if e, err := s.db.lookupKind(key, kindString); err == "" && e != nil {
+			values[i] = e.str
+		}
+	}
+	return values
+}
+
+func cmdMSet(s *Server, c *conn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return redisError("ERR wrong number of arguments for 'mset' command")
+	}
+	for i := 0; i < len(args); i += 2 {
+		s.setString(args[i], args[i+1], 0)
+	}
+	return replyOK
+}
+
+// cmdIncrBy handles INCR, INCRBY, DECR and DECRBY. When hasArg is false the
+// increment is sign, otherwise it is the argument multiplied by sign.
+func cmdIncrBy(sign int64, hasArg bool) handler {
+	return func(s *Server, c *conn, args []string) interface{} {
+		by := sign
+		if hasArg {
+			n, err := parseInt(args[1])
+			if err != "" {
+				return err
+			}
+			by *= n
+		}
+		e, err := s.db.create(args[0], kindString)
+		if err != "" {
+			return err
+		}
+		var n int64
+		if e.str != "" {
+			if n, err = parseInt(e.str); err != "" {
+				return err
+			}
+		}
+		n += by
+		e.str = strconv.FormatInt(n, 10)
+		return n
+	}
+}
+
+func cmdIncrByFloat(s *Server, c *conn, args []string) interface{} {
+	by, err := parseFloat(args[1])
+	if err != "" {
+		return err
+	}
+	e, err := s.db.create(args[0], kindString)
+	if err != "" {
+		return err
+	}
+	var f float64
+	if e.str != "" {
+		if f, err = parseFloat(e.str); err != "" {
+			return err
+		}
+	}
+	e.str = formatFloat(f + by)
+	return e.str
+}
+
+func cmdAppend(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.create(args[0], kindString)
+	if err != "" {
+		return err
+	}
+	e.str += args[1]
+	return len(e.str)
+}
+
+func cmdStrLen(s *Server, c *conn, args []string) interface{} {
+	e, err := s.db.lookupKind(args[0], kindString)
+	if err != "" {
+		return err
+	}
+	if e == nil {
+		return 0
+	}
+	return len(e.str)
+}
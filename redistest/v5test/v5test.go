@@ -0,0 +1,29 @@
+// Package v5test connects a v5 wrapper to a redistest server for the tests of
+// the clients built on a wrapper.
+package v5test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v5 "github.com/KolbyMcGarrah/ocredis/v5"
+	redis "gopkg.in/redis.v5"
+)
+
+// NewClient starts a server and returns it along with a wrapper of a client
+// connected to it. The wrapper and the server are closed when the test ends.
+func NewClient(t testing.TB, options ...ocredis.TraceOption) (*redistest.Server, *v5.Wrapper) {
+	t.Helper()
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	w := v5.Wrap(redis.NewClient(&redis.Options{Addr: s.Addr()}), options...)
+	t.Cleanup(func() {
+		_ = w.Close(context.Background())
+		_ = s.Close()
+	})
+	return s, w
+}
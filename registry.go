@@ -0,0 +1,167 @@
+package ocredis
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The categories commands are grouped by. They can be used as selectors in
+// the command options.
+const (
+	CategoryRead  = "read"
+	CategoryWrite = "write"
+	CategoryAdmin = "admin"
+)
+
+// MethodPrefix prefixes the command name in span names and GoRedisMethod tags
+const MethodPrefix = "go.redis."
+
+// CommandInfo describes a command that can be traced
+type CommandInfo struct {
+	// Name is the lowercase name of the command, such as "hget"
+	Name string
+
+	// Group is the data type or area of the command, such as "hash". Commands
+	// can be selected with a glob on "<group>.<name>", such as "hash.*".
+	Group string
+
+	// Categories are the categories the command belongs to, such as "read"
+	Categories []string
+
+	// Idempotent is true when running the command again after it succeeded
+	// leaves the same state. Only idempotent commands are retried by default.
+	Idempotent bool
+}
+
+// Method returns the span name and GoRedisMethod tag value of the command
+func (c CommandInfo) Method() string {
+	return MethodPrefix + c.Name
+}
+
+var registry = struct {
+	sync.RWMutex
+	commands map[string]CommandInfo
+}{
+	commands: map[string]CommandInfo{},
+}
+
+func init() {
+	for _, c := range []CommandInfo{
+		{Name: "get", Group: "string", Categories: []string{CategoryRead}, Idempotent: true},
+		{Name: "set", Group: "string", Categories: []string{CategoryWrite}, Idempotent: true},
+		{Name: "setnx", Group: "string", Categories: []string{CategoryWrite}},
+		{Name: "incr", Group: "string", Categories: []string{CategoryWrite}},
+		{Name: "del", Group: "key", Categories: []string{CategoryWrite}, Idempotent: true},
+		{Name: "expire", Group: "key", Categories: []string{CategoryWrite}, Idempotent: true},
+		{Name: "expireat", Group: "key", Categories: []string{CategoryWrite}, Idempotent: true},
+		{Name: "hget", Group: "hash", Categories: []string{CategoryRead}, Idempotent: true},
+		{Name: "hlen", Group: "hash", Categories: []string{CategoryRead}, Idempotent: true},
+		{Name: "hset", Group: "hash", Categories: []string{CategoryWrite}, Idempotent: true},
+		{Name: "lpop", Group: "list", Categories: []string{CategoryWrite}},
+		{Name: "eval", Group: "script", Categories: []string{CategoryWrite}},
+		{Name: "evalsha", Group: "script", Categories: []string{CategoryWrite}},
+		{Name: "scriptexists", Group: "script", Categories: []string{CategoryAdmin}, Idempotent: true},
+		{Name: "scriptflush", Group: "script", Categories: []string{CategoryAdmin}, Idempotent: true},
+		{Name: "scriptload", Group: "script", Categories: []string{CategoryAdmin}, Idempotent: true},
+		{Name: "ping", Group: "connection", Categories: []string{CategoryAdmin}, Idempotent: true},
+		{Name: "info", Group: "server", Categories: []string{CategoryAdmin}, Idempotent: true},
+		{Name: "close", Group: "connection", Categories: []string{CategoryAdmin}},
+	} {
+		RegisterCommand(c)
+	}
+}
+
+// RegisterCommand adds a command to the registry so it can be configured with
+// the command options. Commands must be registered before the options are
+// applied for selectors to match them.
+func RegisterCommand(c CommandInfo) {
+	c.Name = strings.ToLower(c.Name)
+	registry.Lock()
+	defer registry.Unlock()
+	registry.commands[c.Name] = c
+}
+
+// LookupCommand returns the registered command with the given name
+func LookupCommand(name string) (CommandInfo, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.commands[strings.ToLower(name)]
+	return c, ok
+}
+
+// Commands returns every registered command sorted by name
+func Commands() []CommandInfo {
+	registry.RLock()
+	defer registry.RUnlock()
+	commands := make([]CommandInfo, 0, len(registry.commands))
+	for _, c := range registry.commands {
+		commands = append(commands, c)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// MatchCommands returns the names of the registered commands matched by the
+// selectors. A selector is either a category such as "read", a glob on the
+// command name such as "h*", or a glob on "<group>.<name>" such as "hash.*".
+func MatchCommands(selectors ...string) []string {
+	var names []string
+	for _, c := range Commands() {
+		for _, s := range selectors {
+			if c.matches(strings.ToLower(s)) {
+				names = append(names, c.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func (c CommandInfo) matches(selector string) bool {
+	for _, category := range c.Categories {
+		if category == selector {
+			return true
+		}
+	}
+	name := c.Name
+	if strings.Contains(selector, ".") {
+		name = c.Group + "." + c.Name
+	}
+	ok, _ := path.Match(selector, name)
+	return ok
+}
+
+// selectorSpecificity ranks a selector by how specific it is: categories
+// rank lowest, then globs and exact command names rank highest
+func selectorSpecificity(selector string) int {
+	selector = strings.ToLower(selector)
+	switch {
+	case isCategory(selector):
+		return 0
+	case strings.ContainsAny(selector, "*?[\\."):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isCategory reports whether a registered command belongs to the category
+func isCategory(name string) bool {
+	for _, c := range Commands() {
+		for _, category := range c.Categories {
+			if category == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandName returns the command name of a span name or method
+func commandName(method string) string {
+	return strings.TrimPrefix(method, MethodPrefix)
+}
@@ -0,0 +1,162 @@
+package ocredis
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestMatchCommands(t *testing.T) {
+	for _, tc := range []struct {
+		selectors []string
+		want      []string
+	}{
+		{[]string{"read"}, []string{"get", "hget", "hlen"}},
+		{[]string{"admin"}, []string{"close", "info", "ping", "scriptexists", "scriptflush", "scriptload"}},
+		{[]string{"h*"}, []string{"hget", "hlen", "hset"}},
+		{[]string{"hash.*"}, []string{"hget", "hlen", "hset"}},
+		{[]string{"*.*et"}, []string{"get", "hget", "hset", "set"}},
+		{[]string{"script.eval*"}, []string{"eval", "evalsha"}},
+		{[]string{"get"}, []string{"get"}},
+		{[]string{"GET"}, []string{"get"}},
+		{[]string{"get", "read"}, []string{"get", "hget", "hlen"}},
+		{[]string{"expire", "string.set*"}, []string{"expire", "set", "setnx"}},
+		{[]string{"unknown"}, nil},
+		{[]string{"hash"}, nil},
+		{nil, nil},
+	} {
+		if got := MatchCommands(tc.selectors...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("MatchCommands(%q) = %q, want %q", tc.selectors, got, tc.want)
+		}
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	RegisterCommand(CommandInfo{Name: "TestRegistryCmd", Group: "test", Categories: []string{"testcategory"}})
+	c, ok := LookupCommand("testregistrycmd")
+	if !ok || c.Name != "testregistrycmd" || c.Method() != "go.redis.testregistrycmd" {
+		t.Fatalf("LookupCommand = %+v, %v, want the command registered in lower case", c, ok)
+	}
+	for _, selector := range []string{"testcategory", "test.*", "testregistry*", "TestRegistryCmd"} {
+		if got := MatchCommands(selector); !reflect.DeepEqual(got, []string{"testregistrycmd"}) {
+			t.Errorf("MatchCommands(%q) = %q, want the registered command", selector, got)
+		}
+	}
+	if !NewTraceOptions(WithAllTraceOptions()).Traced("testregistrycmd") {
+		t.Error("WithAllTraceOptions doesn't trace a registered command")
+	}
+}
+
+func TestSelectorSpecificity(t *testing.T) {
+	for selector, want := range map[string]int{
+		"read":   0,
+		"WRITE":  0,
+		"h*":     1,
+		"hash.*": 1,
+		"h?et":   1,
+		"get":    2,
+		"HGet":   2,
+	} {
+		if got := selectorSpecificity(selector); got != want {
+			t.Errorf("selectorSpecificity(%q) = %d, want %d", selector, got, want)
+		}
+	}
+}
+
+func TestCommandSelection(t *testing.T) {
+	// later options win over earlier ones whatever their selectors
+	o := NewTraceOptions(
+		WithCommands("read", "script.*"),
+		WithoutCommands("h*"),
+		WithCommands("hlen"),
+		WithoutCommands("admin"),
+	)
+	for command, want := range map[string]bool{
+		"get":        true,
+		"hget":       false,
+		"hlen":       true,
+		"hset":       false,
+		"eval":       true,
+		"evalsha":    true,
+		"scriptload": false,
+		"set":        false,
+		"info":       false,
+	} {
+		if got := o.Traced(command); got != want {
+			t.Errorf("Traced(%s) = %v, want %v", command, got, want)
+		}
+	}
+	// the fields are kept in sync with the registry
+	if !o.Get || o.HGet || !o.HLen || !o.EvalSha || o.ScriptLoad {
+		t.Errorf("fields = Get %v HGet %v HLen %v EvalSha %v ScriptLoad %v, want them to match Traced",
+			o.Get, o.HGet, o.HLen, o.EvalSha, o.ScriptLoad)
+	}
+}
+
+func TestWithAllTraceOptions(t *testing.T) {
+	o := NewTraceOptions(WithInstanceName("all"), WithAllowRoot(true), WithAllTraceOptions())
+	for _, c := range Commands() {
+		if !o.Traced(c.Name) {
+			t.Errorf("%s isn't traced", c.Name)
+		}
+	}
+	// the options set before are kept
+	if o.InstanceName != "all" || !o.AllowRoot {
+		t.Errorf("InstanceName %q, AllowRoot %v, want the options set before kept", o.InstanceName, o.AllowRoot)
+	}
+}
+
+// sampled reports whether the sampler samples a root span
+func sampled(s trace.Sampler) bool {
+	return s(trace.SamplingParameters{Name: "test"}).Sample
+}
+
+func TestCommandSampler(t *testing.T) {
+	o := NewTraceOptions(
+		WithSampler(trace.NeverSample()),
+		WithCommandSampler(trace.AlwaysSample(), "read"),
+		WithCommandSampler(trace.NeverSample(), "hlen"),
+	)
+	for command, want := range map[string]bool{
+		"get":  true,
+		"hget": true,
+		"hlen": false,
+		"set":  false,
+	} {
+		c := o.Command(command)
+		if c.Sampler == nil {
+			t.Errorf("Command(%s) has no sampler", command)
+			continue
+		}
+		if got := sampled(c.Sampler); got != want {
+			t.Errorf("sampler of %s samples %v, want %v", command, got, want)
+		}
+	}
+	// commands without a sampler of their own have none without WithSampler
+	if s := NewTraceOptions(WithCommandSampler(trace.AlwaysSample(), "get")).Command("set").Sampler; s != nil {
+		t.Error("set has a sampler without WithSampler")
+	}
+}
+
+func TestCommandAttributes(t *testing.T) {
+	team := trace.StringAttribute("team", "payments")
+	hot := trace.BoolAttribute("hot", true)
+	o := NewTraceOptions(
+		WithCommandAttributes([]trace.Attribute{team}, "hash.*"),
+		WithCommandAttributes([]trace.Attribute{hot}, "hget"),
+	)
+	for command, want := range map[string][]trace.Attribute{
+		"hget": {team, hot},
+		"hset": {team},
+		"get":  nil,
+	} {
+		if got := o.Command(command).Attributes; !reflect.DeepEqual(got, want) {
+			t.Errorf("attributes of %s = %v, want %v", command, got, want)
+		}
+	}
+	// attributes don't turn tracing on
+	if o.Traced("hget") {
+		t.Error("hget is traced without being enabled")
+	}
+}
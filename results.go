@@ -0,0 +1,161 @@
+package ocredis
+
+import (
+	"encoding"
+	"fmt"
+	"strconv"
+)
+
+// The following constructors return commands holding a fixed value and error.
+// They can be returned in place of a command that was never sent to redis.
+
+// NewCmdResult returns a RedisCmd holding val and err
+func NewCmdResult(val interface{}, err error) RedisCmd {
+	return &cmdResult{val: val, err: err}
+}
+
+// NewStatusResult returns a StatusCmd holding val and err
+func NewStatusResult(val string, err error) StatusCmd {
+	return &statusResult{val: val, err: err}
+}
+
+// NewStringResult returns a StringCmd holding val and err
+func NewStringResult(val string, err error) StringCmd {
+	return &stringResult{val: val, err: err}
+}
+
+// NewIntResult returns an IntCmd holding val and err
+func NewIntResult(val int64, err error) IntCmd {
+	return &intResult{val: val, err: err}
+}
+
+// NewBoolResult returns a BoolCmd holding val and err
+func NewBoolResult(val bool, err error) BoolCmd {
+	return &boolResult{val: val, err: err}
+}
+
+// NewBoolSliceResult returns a BoolSliceCmd holding val and err
+func NewBoolSliceResult(val []bool, err error) BoolSliceCmd {
+	return &boolSliceResult{val: val, err: err}
+}
+
+func resultString(val interface{}, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprint(val)
+}
+
+type cmdResult struct {
+	val interface{}
+	err error
+}
+
+func (r *cmdResult) Err() error                   { return r.err }
+func (r *cmdResult) Result() (interface{}, error) { return r.val, r.err }
+func (r *cmdResult) String() string               { return resultString(r.val, r.err) }
+func (r *cmdResult) Val() interface{}             { return r.val }
+
+type statusResult struct {
+	val string
+	err error
+}
+
+func (r *statusResult) Err() error              { return r.err }
+func (r *statusResult) Result() (string, error) { return r.val, r.err }
+func (r *statusResult) String() string          { return resultString(r.val, r.err) }
+func (r *statusResult) Val() string             { return r.val }
+
+type stringResult struct {
+	val string
+	err error
+}
+
+func (r *stringResult) Err() error              { return r.err }
+func (r *stringResult) Result() (string, error) { return r.val, r.err }
+func (r *stringResult) String() string          { return resultString(r.val, r.err) }
+func (r *stringResult) Val() string             { return r.val }
+
+func (r *stringResult) Bytes() ([]byte, error) {
+	return []byte(r.val), r.err
+}
+
+func (r *stringResult) Float64() (float64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return strconv.ParseFloat(r.val, 64)
+}
+
+func (r *stringResult) Int64() (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return strconv.ParseInt(r.val, 10, 64)
+}
+
+func (r *stringResult) Uint64() (uint64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return strconv.ParseUint(r.val, 10, 64)
+}
+
+// Scan parses the value into the pointer val the same way the redis clients do
+func (r *stringResult) Scan(val interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	var err error
+	switch v := val.(type) {
+	case *string:
+		*v = r.val
+	case *[]byte:
+		*v = []byte(r.val)
+	case *int:
+		*v, err = strconv.Atoi(r.val)
+	case *int64:
+		*v, err = strconv.ParseInt(r.val, 10, 64)
+	case *uint64:
+		*v, err = strconv.ParseUint(r.val, 10, 64)
+	case *float64:
+		*v, err = strconv.ParseFloat(r.val, 64)
+	case *bool:
+		*v = len(r.val) == 1 && r.val[0] == '1'
+	case encoding.BinaryUnmarshaler:
+		err = v.UnmarshalBinary([]byte(r.val))
+	default:
+		err = fmt.Errorf("ocredis: can't scan into dst (%T)", val)
+	}
+	return err
+}
+
+type intResult struct {
+	val int64
+	err error
+}
+
+func (r *intResult) Err() error             { return r.err }
+func (r *intResult) Result() (int64, error) { return r.val, r.err }
+func (r *intResult) String() string         { return resultString(r.val, r.err) }
+func (r *intResult) Val() int64             { return r.val }
+
+type boolResult struct {
+	val bool
+	err error
+}
+
+func (r *boolResult) Err() error            { return r.err }
+func (r *boolResult) Result() (bool, error) { return r.val, r.err }
+func (r *boolResult) String() string        { return resultString(r.val, r.err) }
+func (r *boolResult) Val() bool             { return r.val }
+
+type boolSliceResult struct {
+	val []bool
+	err error
+}
+
+func (r *boolSliceResult) Err() error              { return r.err }
+func (r *boolSliceResult) Result() ([]bool, error) { return r.val, r.err }
+func (r *boolSliceResult) String() string          { return resultString(r.val, r.err) }
+func (r *boolSliceResult) Val() []bool             { return r.val }
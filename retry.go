@@ -0,0 +1,214 @@
+package ocredis
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// The defaults of RetryPolicy
+const (
+	DefaultMinBackoff = 8 * time.Millisecond
+	DefaultMaxBackoff = 512 * time.Millisecond
+)
+
+// DefaultRetryableErrors are the error types retried when a RetryPolicy
+// doesn't list its own. They're the errors a later attempt can succeed after.
+var DefaultRetryableErrors = []string{
+	ErrorTypeTimeout,
+	ErrorTypeNetwork,
+	ErrorTypePoolTimeout,
+	ErrorTypeConnRefused,
+	ErrorTypeLoading,
+	ErrorTypeBusy,
+	ErrorTypeTryAgain,
+	ErrorTypeClusterDown,
+}
+
+// RetryPolicy configures the retries of failed calls
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call including the
+	// first one. Calls aren't retried when it's less than 2.
+	MaxAttempts int
+
+	// MinBackoff is the wait before the first retry, it doubles with every
+	// retry up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter randomly shortens the backoff by up to this fraction, between 0
+	// and 1, so clients don't retry in lockstep
+	Jitter float64
+
+	// Retryable lists the error types retried, see ClassifyError.
+	// DefaultRetryableErrors is used when it's empty.
+	Retryable []string
+
+	// AllowNonIdempotent lists selectors of the commands that aren't
+	// idempotent but are retried anyway, such as "incr". Commands that aren't
+	// idempotent are never retried otherwise, since a failed attempt may have
+	// been applied. See MatchCommands for the selector syntax.
+	AllowNonIdempotent []string
+}
+
+// retryPolicy is a RetryPolicy with the defaults applied and the selectors
+// resolved
+type retryPolicy struct {
+	RetryPolicy
+	retryable map[string]bool
+	allowed   map[string]bool
+}
+
+func newRetryPolicy(p RetryPolicy) *retryPolicy {
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = DefaultMinBackoff
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = DefaultMaxBackoff
+		if p.MaxBackoff < p.MinBackoff {
+			p.MaxBackoff = p.MinBackoff
+		}
+	}
+	if len(p.Retryable) == 0 {
+		p.Retryable = DefaultRetryableErrors
+	}
+	r := &retryPolicy{
+		RetryPolicy: p,
+		retryable:   map[string]bool{},
+		allowed:     map[string]bool{},
+	}
+	for _, t := range p.Retryable {
+		r.retryable[t] = true
+	}
+	for _, name := range MatchCommands(p.AllowNonIdempotent...) {
+		r.allowed[name] = true
+	}
+	return r
+}
+
+// retries reports whether calls of the command are retried
+func (p *retryPolicy) retries(command string) bool {
+	if p.MaxAttempts < 2 {
+		return false
+	}
+	if p.allowed[command] {
+		return true
+	}
+	c, ok := LookupCommand(command)
+	return ok && c.Idempotent
+}
+
+// backoff returns the wait before the retry following the attempt
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// WithRetryPolicy retries the failed calls as configured by the policy. Each
+// attempt of a retried command gets a go.redis.attempt child span and every
+// retry is counted by the MeasureRetries measure.
+func WithRetryPolicy(policy RetryPolicy) TraceOption {
+	return func(o *TraceOptions) {
+		o.retryPolicy = newRetryPolicy(policy)
+	}
+}
+
+// attemptSpanName is the name of the spans of the attempts of a call
+const attemptSpanName = MethodPrefix + "attempt"
+
+// Do runs the command, retrying it as configured by WithRetryPolicy. run must
+// return the result of the attempt, wrappers assign it to the result of the
+// call as well. Do returns ErrCircuitOpen without running the command when
+// the circuit breaker rejects the call, wrappers then return a result holding
+// the error.
+func (c *Call) Do(run func() Cmd) error {
+	if !c.allow() {
+		return ErrCircuitOpen
+	}
+	policy := c.options.retryPolicy
+	if policy == nil || !policy.retries(c.command) {
+		run()
+		return nil
+	}
+	for attempt := 1; ; attempt++ {
+		span := c.startAttempt(attempt)
+		err := run().Err()
+		errorType := ClassifyError(err)
+		if span != nil {
+			span.SetStatus(trace.Status{Code: ErrorStatusCode(errorType), Message: errorMessage(err)})
+			span.End()
+		}
+		if errorType == "" || attempt >= policy.MaxAttempts || !policy.retryable[errorType] {
+			return nil
+		}
+		c.recordRetry(errorType)
+		if !sleep(c.ctx, policy.backoff(attempt)) {
+			return nil
+		}
+	}
+}
+
+// startAttempt starts the span of an attempt under the span of the call. It
+// returns nil when the call has no span. Attempts are sampled with the span
+// of the call, the attempts of a call the sampler dropped aren't traced even
+// when tail sampling replaces its span.
+func (c *Call) startAttempt(attempt int) *trace.Span {
+	if c.span == nil {
+		return nil
+	}
+	ctx := trace.NewContext(c.ctx, c.span.span)
+	_, span := trace.StartSpan(ctx, attemptSpanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		// attempts are sampled along with their call
+		trace.WithSampler(func(p trace.SamplingParameters) trace.SamplingDecision {
+			return trace.SamplingDecision{Sample: p.ParentContext.IsSampled()}
+		}),
+	)
+	span.AddAttributes(
+		trace.StringAttribute("redis.command", c.command),
+		trace.Int64Attribute("redis.attempt", int64(attempt)),
+	)
+	return span
+}
+
+// recordRetry counts a retry of the call after an attempt failed with the
+// error type
+func (c *Call) recordRetry(errorType string) {
+	_ = stats.RecordWithTags(c.ctx, []tag.Mutator{
+		tag.Insert(GoRedisInstanceName, c.options.InstanceName),
+		tag.Insert(GoRedisMethod, scriptName(c.ctx, MethodPrefix+c.command)),
+		tag.Insert(GoRedisErrorType, errorType),
+	}, MeasureRetries.M(1))
+}
+
+// sleep waits for d, it returns false when the context is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,105 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(RetryPolicy{MaxAttempts: 10, MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	for attempt, want := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 50 * time.Millisecond,
+		9: 50 * time.Millisecond,
+	} {
+		if got := p.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	p = newRetryPolicy(RetryPolicy{MaxAttempts: 2, MinBackoff: 100 * time.Millisecond, Jitter: 0.5})
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("backoff with jitter = %v, want between 50ms and 100ms", got)
+		}
+	}
+
+	p = newRetryPolicy(RetryPolicy{})
+	if p.MinBackoff != DefaultMinBackoff || p.MaxBackoff != DefaultMaxBackoff {
+		t.Errorf("default backoff = %v-%v, want %v-%v", p.MinBackoff, p.MaxBackoff, DefaultMinBackoff, DefaultMaxBackoff)
+	}
+}
+
+// attempts runs a call of the command failing with the errors in turn, and
+// returns the number of attempts made
+func attempts(options TraceOptions, command string, errs ...error) int {
+	var n int
+	call := StartCall(context.Background(), options, command, []string{"key"})
+	_ = call.Do(func() Cmd {
+		var err error
+		if n < len(errs) {
+			err = errs[n]
+		}
+		n++
+		return NewStatusResult("", err)
+	})
+	return n
+}
+
+func TestRetryPolicy(t *testing.T) {
+	loading := errors.New("LOADING Redis is loading the dataset in memory")
+	options := NewTraceOptions(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}))
+	for _, tc := range []struct {
+		name    string
+		command string
+		errs    []error
+		want    int
+	}{
+		{"Success", "get", nil, 1},
+		{"Retried", "get", []error{loading}, 2},
+		{"MaxAttempts", "get", []error{loading, loading, loading, loading}, 3},
+		{"NotRetryable", "get", []error{errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")}, 1},
+		{"Nil", "get", []error{errors.New("redis: nil")}, 1},
+		{"NonIdempotent", "incr", []error{loading}, 1},
+		{"NonIdempotentScript", "evalsha", []error{loading}, 1},
+	} {
+		if got := attempts(options, tc.command, tc.errs...); got != tc.want {
+			t.Errorf("%s: made %d attempts, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	options = NewTraceOptions(WithRetryPolicy(RetryPolicy{
+		MaxAttempts:        3,
+		MinBackoff:         time.Millisecond,
+		AllowNonIdempotent: []string{"incr"},
+		Retryable:          []string{ErrorTypeWrongType},
+	}))
+	if got := attempts(options, "incr", errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")); got != 2 {
+		t.Errorf("allowed non idempotent command made %d attempts, want 2", got)
+	}
+	if got := attempts(options, "incr", loading); got != 1 {
+		t.Errorf("error type that isn't listed made %d attempts, want 1", got)
+	}
+	if got := attempts(options, "setnx", errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")); got != 1 {
+		t.Errorf("non idempotent command that isn't allowed made %d attempts, want 1", got)
+	}
+}
+
+func TestRetryStopsOnCanceledContext(t *testing.T) {
+	options := NewTraceOptions(WithRetryPolicy(RetryPolicy{MaxAttempts: 5, MinBackoff: time.Hour}))
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int
+	call := StartCall(ctx, options, "get", []string{"key"})
+	_ = call.Do(func() Cmd {
+		n++
+		cancel()
+		return NewStringResult("", errors.New("LOADING Redis is loading the dataset in memory"))
+	})
+	if n != 1 {
+		t.Errorf("made %d attempts after the context was canceled, want 1", n)
+	}
+}
@@ -0,0 +1,309 @@
+package ocredis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+// The roles of the nodes of a Router, set as the redis.node.role attribute
+// of the spans of the calls it routes
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+// Balancer selects the replica a Router sends a read to
+type Balancer int
+
+// The balancers of a Router
+const (
+	// RoundRobin uses the replicas in turn
+	RoundRobin Balancer = iota
+
+	// LeastLatency uses the replica with the lowest recent latency. Replicas
+	// that weren't used yet are taken to have the mean latency of the others.
+	LeastLatency
+)
+
+// DefaultRouterDecay is the weight of the latest latency of a replica in the
+// moving average used by LeastLatency
+const DefaultRouterDecay = 0.2
+
+// Node is a client a Router routes calls to
+type Node struct {
+	// Name is set as the redis.node attribute of the spans. It defaults to
+	// the role of the node followed, for replicas, by their index.
+	Name string
+
+	// Client runs the calls of the node. Replicas whose client has an open
+	// circuit breaker are skipped, see CircuitState.
+	Client Getter
+}
+
+// RouterOptions configures a Router
+type RouterOptions struct {
+	Balancer Balancer
+
+	// StickyFor is how long the reads of a context made with
+	// WithReadYourWrites go to the primary after a command of the write
+	// category. Zero sticks them to the primary for the lifetime of the
+	// context.
+	StickyFor time.Duration
+}
+
+// Router sends the read commands, as categorized in the command registry, to
+// the replicas and every other command to the primary. Replicas whose
+// circuit breaker is open are skipped, reads go to the primary when no
+// replica is available. Commands not implemented by the selected client
+// return ErrUnsupportedCommand.
+type Router struct {
+	Forwarder
+
+	primary  *routerNode
+	replicas []*routerNode
+	options  RouterOptions
+
+	mu   sync.Mutex
+	next int
+}
+
+var (
+	_ Client   = &Router{}
+	_ Cmdable  = &Router{}
+	_ Scripter = &Router{}
+)
+
+type routerNode struct {
+	Node
+	role string
+
+	mu      sync.Mutex
+	latency float64
+	samples int
+}
+
+// NewRouter returns a router across the primary and the replicas
+func NewRouter(options RouterOptions, primary Node, replicas ...Node) *Router {
+	if primary.Name == "" {
+		primary.Name = RolePrimary
+	}
+	r := &Router{
+		primary: &routerNode{Node: primary, role: RolePrimary},
+		options: options,
+	}
+	r.Forwarder = NewRoutingForwarder(func(ctx context.Context, command string) (context.Context, Getter) {
+		ctx, n := r.route(ctx, command)
+		return ctx, n.Client
+	})
+	for i, n := range replicas {
+		if n.Name == "" {
+			n.Name = RoleReplica + "-" + strconv.Itoa(i)
+		}
+		r.replicas = append(r.replicas, &routerNode{Node: n, role: RoleReplica})
+	}
+	return r
+}
+
+// WithReadYourWrites returns a context in which the reads routed by a Router
+// after a write go to the primary, so they see the write even when the
+// replicas lag behind
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+type sessionKey struct{}
+
+type session struct {
+	mu    sync.Mutex
+	wrote time.Time
+}
+
+type routeKey struct{}
+
+type route struct {
+	node string
+	role string
+}
+
+// routeAttributes returns the attributes of the node the call was routed to
+func routeAttributes(ctx context.Context) []trace.Attribute {
+	r, ok := ctx.Value(routeKey{}).(route)
+	if !ok {
+		return nil
+	}
+	return []trace.Attribute{
+		trace.StringAttribute("redis.node", r.node),
+		trace.StringAttribute("redis.node.role", r.role),
+	}
+}
+
+// route selects the node running the command and tags the context with it
+func (r *Router) route(ctx context.Context, command string) (context.Context, *routerNode) {
+	n := r.primary
+	switch {
+	case inCategory(command, CategoryRead):
+		if !r.sticky(ctx) {
+			if replica := r.replica(); replica != nil {
+				n = replica
+			}
+		}
+	case inCategory(command, CategoryWrite):
+		// only writes make the reads sticky, admin commands such as ping
+		// don't
+		if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+			s.mu.Lock()
+			s.wrote = time.Now()
+			s.mu.Unlock()
+		}
+	}
+	return context.WithValue(ctx, routeKey{}, route{node: n.Name, role: n.role}), n
+}
+
+// sticky reports whether the reads of the context go to the primary
+func (r *Router) sticky(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.wrote.IsZero() {
+		return false
+	}
+	return r.options.StickyFor <= 0 || time.Since(s.wrote) < r.options.StickyFor
+}
+
+// replica returns the replica selected by the balancer, or nil when none is
+// available
+func (r *Router) replica() *routerNode {
+	r.mu.Lock()
+	start := r.next
+	r.next++
+	r.mu.Unlock()
+	var (
+		selected        *routerNode
+		selectedLatency float64
+		mean            float64
+	)
+	if r.options.Balancer == LeastLatency {
+		mean = r.meanLatency()
+	}
+	for i := range r.replicas {
+		n := r.replicas[(start+i)%len(r.replicas)]
+		if state, ok := CircuitState(n.Client); ok && state == CircuitOpen {
+			continue
+		}
+		if r.options.Balancer != LeastLatency {
+			return n
+		}
+		latency, ok := n.averageLatency()
+		if !ok {
+			// replicas that weren't used yet compete with the mean latency
+			latency = mean
+		}
+		if selected == nil || latency < selectedLatency {
+			selected, selectedLatency = n, latency
+		}
+	}
+	return selected
+}
+
+// meanLatency returns the mean of the average latencies of the replicas
+// that were used
+func (r *Router) meanLatency() float64 {
+	var (
+		total float64
+		used  int
+	)
+	for _, n := range r.replicas {
+		if latency, ok := n.averageLatency(); ok {
+			total += latency
+			used++
+		}
+	}
+	if used == 0 {
+		return 0
+	}
+	return total / float64(used)
+}
+
+// averageLatency returns the moving average of the latencies of the node,
+// and false when the node wasn't used yet
+func (n *routerNode) averageLatency() (float64, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.latency, n.samples > 0
+}
+
+// observe adds the latency of a call started at start to the moving average.
+// Failed calls never lower the average so a replica failing fast doesn't
+// draw the reads.
+func (n *routerNode) observe(start time.Time, err error) {
+	latency := float64(time.Since(start))
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.samples == 0 {
+		n.latency = latency
+		n.samples++
+		return
+	}
+	if ClassifyError(err) != "" && latency < n.latency {
+		return
+	}
+	n.latency += DefaultRouterDecay * (latency - n.latency)
+	n.samples++
+}
+
+// inCategory reports whether the command is in the category of the command
+// registry
+func inCategory(command, category string) bool {
+	c, ok := LookupCommand(command)
+	if !ok {
+		return false
+	}
+	for _, cat := range c.Categories {
+		if cat == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Get routes the redis get command
+func (r *Router) Get(ctx context.Context, key string) (cmd StringCmd) {
+	ctx, n := r.route(ctx, "get")
+	defer func(start time.Time) { n.observe(start, cmd.Err()) }(time.Now())
+	return n.Client.Get(ctx, key)
+}
+
+// HLen routes the redis hlen command
+func (r *Router) HLen(ctx context.Context, key string) (cmd IntCmd) {
+	ctx, n := r.route(ctx, "hlen")
+	defer func(start time.Time) { n.observe(start, cmd.Err()) }(time.Now())
+	return NewForwarder(n.Client).HLen(ctx, key)
+}
+
+// HGet routes the redis hget command
+func (r *Router) HGet(ctx context.Context, key, field string) (cmd StringCmd) {
+	ctx, n := r.route(ctx, "hget")
+	defer func(start time.Time) { n.observe(start, cmd.Err()) }(time.Now())
+	return NewForwarder(n.Client).HGet(ctx, key, field)
+}
+
+// Close closes every node and returns the first error. Nodes that can't be
+// closed are skipped.
+func (r *Router) Close(ctx context.Context) error {
+	var first error
+	for _, n := range append([]*routerNode{r.primary}, r.replicas...) {
+		ctx := context.WithValue(ctx, routeKey{}, route{node: n.Name, role: n.role})
+		err := NewForwarder(n.Client).Close(ctx)
+		if err != nil && err != ErrUnsupportedCommand && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,159 @@
+package ocredis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// nodeClient records the commands it receives and replies with its name
+type nodeClient struct {
+	name string
+	err  error
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func (c *nodeClient) record(command string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands = append(c.commands, command)
+}
+
+func (c *nodeClient) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.commands)
+}
+
+func (c *nodeClient) Get(ctx context.Context, key string) StringCmd {
+	c.record("get")
+	return NewStringResult(c.name, c.err)
+}
+
+func (c *nodeClient) HGet(ctx context.Context, key, field string) StringCmd {
+	c.record("hget")
+	return NewStringResult(c.name, c.err)
+}
+
+func (c *nodeClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) StatusCmd {
+	c.record("set")
+	return NewStatusResult("OK", c.err)
+}
+
+func (c *nodeClient) Ping(ctx context.Context) StatusCmd {
+	c.record("ping")
+	return NewStatusResult("PONG", c.err)
+}
+
+func (c *nodeClient) ScriptLoad(ctx context.Context, script string) StringCmd {
+	c.record("scriptload")
+	return NewStringResult("sha", c.err)
+}
+
+func newTestRouter(options RouterOptions, replicas int) (*Router, *nodeClient, []*nodeClient) {
+	primary := &nodeClient{name: RolePrimary}
+	var (
+		nodes   []Node
+		clients []*nodeClient
+	)
+	for i := 0; i < replicas; i++ {
+		c := &nodeClient{name: RoleReplica}
+		clients = append(clients, c)
+		nodes = append(nodes, Node{Client: c})
+	}
+	return NewRouter(options, Node{Client: primary}, nodes...), primary, clients
+}
+
+func TestRouterSplitsReadsAndWrites(t *testing.T) {
+	r, primary, replicas := newTestRouter(RouterOptions{}, 2)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if v := r.Get(ctx, "key").Val(); v != RoleReplica {
+			t.Errorf("Get was routed to the %s", v)
+		}
+	}
+	r.Set(ctx, "key", "value", 0)
+	r.HGet(ctx, "hash", "field")
+	if n := primary.count(); n != 1 {
+		t.Errorf("primary received %d commands, want the set only", n)
+	}
+	// the replicas are used in turn
+	if a, b := replicas[0].count(), replicas[1].count(); a != 3 || b != 2 {
+		t.Errorf("replicas received %d and %d reads, want 3 and 2", a, b)
+	}
+	// commands the client doesn't implement
+	if err := r.Incr(ctx, "key").Err(); err != ErrUnsupportedCommand {
+		t.Errorf("Incr = %v, want ErrUnsupportedCommand", err)
+	}
+}
+
+func TestRouterReadYourWrites(t *testing.T) {
+	r, _, _ := newTestRouter(RouterOptions{StickyFor: time.Hour}, 1)
+	ctx := WithReadYourWrites(context.Background())
+
+	// admin commands aren't writes
+	r.Ping(ctx)
+	r.ScriptLoad(ctx, "return 1")
+	if v := r.Get(ctx, "key").Val(); v != RoleReplica {
+		t.Errorf("Get after admin commands was routed to the %s, want the replica", v)
+	}
+	r.Set(ctx, "key", "value", 0)
+	if v := r.Get(ctx, "key").Val(); v != RolePrimary {
+		t.Errorf("Get after a write was routed to the %s, want the primary", v)
+	}
+	if v := r.Get(context.Background(), "key").Val(); v != RoleReplica {
+		t.Errorf("Get without the session was routed to the %s, want the replica", v)
+	}
+}
+
+func TestRouterLeastLatency(t *testing.T) {
+	r, _, replicas := newTestRouter(RouterOptions{Balancer: LeastLatency}, 3)
+	r.replicas[0].observe(time.Now().Add(-10*time.Millisecond), nil)
+	r.replicas[1].observe(time.Now().Add(-30*time.Millisecond), nil)
+
+	// the unused replica is taken to have the mean latency of 20ms
+	for i := 0; i < 3; i++ {
+		r.Get(context.Background(), "key")
+	}
+	if n := replicas[2].count(); n != 0 {
+		t.Errorf("unused replica received %d reads, want 0", n)
+	}
+	if n := replicas[0].count(); n != 3 {
+		t.Errorf("fastest replica received %d reads, want 3", n)
+	}
+
+	// failing fast doesn't lower the latency
+	r.replicas[1].observe(time.Now(), context.DeadlineExceeded)
+	if latency, _ := r.replicas[1].averageLatency(); latency < float64(30*time.Millisecond) {
+		t.Errorf("latency after a fast failure = %v, want at least 30ms", time.Duration(latency))
+	}
+}
+
+func TestRouterSkipsOpenReplicas(t *testing.T) {
+	primary := &nodeClient{name: RolePrimary}
+	open := &nodeClient{name: "open"}
+	closed := &nodeClient{name: "closed"}
+	// unnamed nodes, one of them reached through a layer built on its client
+	r := NewRouter(RouterOptions{}, Node{Client: primary},
+		Node{Client: stater{Getter: open, state: CircuitOpen}},
+		Node{Client: NewForwarder(stater{Getter: closed, state: CircuitClosed})},
+	)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if v := r.Get(ctx, "key").Val(); v != "closed" {
+			t.Errorf("Get was routed to the %s replica, want the closed one", v)
+		}
+	}
+	if n := open.count(); n != 0 {
+		t.Errorf("replica with an open circuit received %d reads", n)
+	}
+
+	// reads go to the primary when every replica is open
+	r = NewRouter(RouterOptions{}, Node{Client: primary}, Node{Client: stater{Getter: open, state: CircuitOpen}})
+	if v := r.Get(ctx, "key").Val(); v != RolePrimary {
+		t.Errorf("Get was routed to the %s, want the primary", v)
+	}
+}
@@ -0,0 +1,67 @@
+package ocredis
+
+import (
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+// RateLimitingSampler returns a sampler that samples at most perSecond spans
+// per second for each span name. Since spans are named after the command,
+// high volume commands can't crowd out rare ones.
+func RateLimitingSampler(perSecond float64) trace.Sampler {
+	return newRateLimiter(perSecond).sampler
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	l := &rateLimiter{
+		rate:    perSecond,
+		burst:   perSecond,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	return l
+}
+
+func (l *rateLimiter) sampler(p trace.SamplingParameters) trace.SamplingDecision {
+	return trace.SamplingDecision{Sample: l.allow(p.Name)}
+}
+
+// rateLimiter is a token bucket per key
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,192 @@
+package ocredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+func TestRateLimitingSampler(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2)
+	l.now = func() time.Time { return now }
+	sample := func(name string) bool {
+		return l.sampler(trace.SamplingParameters{Name: name}).Sample
+	}
+
+	// a burst of a second worth of spans is sampled
+	for i := 0; i < 2; i++ {
+		if !sample("go.redis.get") {
+			t.Fatalf("span %d of the burst wasn't sampled", i)
+		}
+	}
+	if sample("go.redis.get") {
+		t.Error("span beyond the rate was sampled")
+	}
+	// each span name has its own limit
+	if !sample("go.redis.set") {
+		t.Error("span of another name wasn't sampled")
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if sample("go.redis.get") {
+		t.Error("span sampled before a token was earned back")
+	}
+	now = now.Add(250 * time.Millisecond)
+	if !sample("go.redis.get") {
+		t.Error("span not sampled once a token was earned back")
+	}
+	// tokens don't accumulate beyond the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		sample("go.redis.get")
+	}
+	if sample("go.redis.get") {
+		t.Error("tokens accumulated beyond the burst")
+	}
+}
+
+func TestRateLimitingSamplerBelowOnePerSecond(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(0.5)
+	l.now = func() time.Time { return now }
+	if !l.allow("key") {
+		t.Fatal("first span wasn't sampled, want a burst of at least 1")
+	}
+	now = now.Add(time.Second)
+	if l.allow("key") {
+		t.Error("span sampled after 1s at 0.5 per second")
+	}
+	now = now.Add(time.Second)
+	if !l.allow("key") {
+		t.Error("span not sampled after 2s at 0.5 per second")
+	}
+}
+
+// spanRecorder records the exported spans
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) named(name string) []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []*trace.SpanData
+	for _, s := range r.spans {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func newSpanRecorder(t *testing.T) *spanRecorder {
+	r := &spanRecorder{}
+	trace.RegisterExporter(r)
+	t.Cleanup(func() { trace.UnregisterExporter(r) })
+	return r
+}
+
+func TestTailSampling(t *testing.T) {
+	options := NewTraceOptions(
+		WithAllowRoot(true),
+		WithGet(true),
+		WithSampler(trace.NeverSample()),
+		WithTailSampling(20*time.Millisecond),
+		WithSlowThreshold(20*time.Millisecond, nil),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}),
+	)
+	loading := errors.New("LOADING Redis is loading the dataset in memory")
+	for _, tc := range []struct {
+		name    string
+		errs    []error
+		latency time.Duration
+		sampled bool
+		slow    bool
+	}{
+		{"Fast", nil, 0, false, false},
+		{"Nil", []error{errors.New("redis: nil")}, 0, false, false},
+		{"Failed", []error{loading, loading}, 0, true, false},
+		{"Slow", nil, 30 * time.Millisecond, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newSpanRecorder(t)
+			call := StartCall(context.Background(), options, "get", []string{"key"})
+			var (
+				cmd StringCmd
+				n   int
+			)
+			_ = call.Do(func() Cmd {
+				var err error
+				if n < len(tc.errs) {
+					err = tc.errs[n]
+				}
+				n++
+				time.Sleep(tc.latency)
+				cmd = NewStringResult("", err)
+				return cmd
+			})
+			call.End(cmd)
+
+			spans := r.named("go.redis.get")
+			if !tc.sampled {
+				if len(spans) != 0 {
+					t.Errorf("exported %d spans, want the dropped span not exported", len(spans))
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("exported %d spans, want the replacing span only", len(spans))
+			}
+			s := spans[0]
+			if s.Attributes["ocredis.tail_sampled"] != true {
+				t.Errorf("attributes = %v, want ocredis.tail_sampled", s.Attributes)
+			}
+			if _, ok := s.Attributes["ocredis.start_time"]; !ok {
+				t.Errorf("attributes = %v, want ocredis.start_time", s.Attributes)
+			}
+			if latency, _ := s.Attributes["ocredis.latency_ms"].(int64); latency < tc.latency.Milliseconds() {
+				t.Errorf("ocredis.latency_ms = %v, want at least %d", s.Attributes["ocredis.latency_ms"], tc.latency.Milliseconds())
+			}
+			if got := s.Attributes["slow"] == true; got != tc.slow {
+				t.Errorf("slow attribute = %v, want %v", got, tc.slow)
+			}
+			wantCode := int32(trace.StatusCodeOK)
+			if len(tc.errs) > 0 {
+				wantCode = ErrorStatusCode(ErrorTypeLoading)
+			}
+			if s.Status.Code != wantCode {
+				t.Errorf("status = %d, want %d", s.Status.Code, wantCode)
+			}
+			// the attempts were dropped along with the span the sampler dropped
+			if n := len(r.named(attemptSpanName)); n != 0 {
+				t.Errorf("exported %d attempt spans, want none", n)
+			}
+		})
+	}
+}
+
+func TestTailSamplingKeepsSampledSpans(t *testing.T) {
+	r := newSpanRecorder(t)
+	options := NewTraceOptions(WithAllowRoot(true), WithGet(true), WithSampler(trace.AlwaysSample()), WithTailSampling(0))
+	call := StartCall(context.Background(), options, "get", []string{"key"})
+	call.End(NewStringResult("", errors.New("ERR failed")))
+	spans := r.named("go.redis.get")
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	if _, ok := spans[0].Attributes["ocredis.tail_sampled"]; ok {
+		t.Error("span sampled by its sampler is marked as tail sampled")
+	}
+}
@@ -0,0 +1,77 @@
+package ocredis
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ArgSanitizer returns the arguments of a call that are safe to export in
+// telemetry. keys are the keys the command operates on and args are the
+// remaining arguments, such as values and expirations.
+type ArgSanitizer func(command string, keys []string, args []interface{}) []string
+
+// redacted replaces argument values removed by the sanitizers
+const redacted = "?"
+
+// DefaultArgSanitizer keeps the keys and replaces every other argument with
+// "?" so values never leave the process.
+func DefaultArgSanitizer(command string, keys []string, args []interface{}) []string {
+	out := make([]string, 0, len(keys)+len(args))
+	out = append(out, keys...)
+	for range args {
+		out = append(out, redacted)
+	}
+	return out
+}
+
+// VerboseArgSanitizer keeps every argument. It should only be used when the
+// values stored in redis aren't sensitive.
+func VerboseArgSanitizer(command string, keys []string, args []interface{}) []string {
+	out := make([]string, 0, len(keys)+len(args))
+	out = append(out, keys...)
+	for _, arg := range args {
+		out = append(out, fmt.Sprint(arg))
+	}
+	return out
+}
+
+// RedactKeys returns a sanitizer that replaces the keys matching any of the
+// glob patterns with "?" and sanitizes the remaining arguments with
+// sanitizer. A nil sanitizer uses DefaultArgSanitizer.
+func RedactKeys(sanitizer ArgSanitizer, patterns ...string) ArgSanitizer {
+	if sanitizer == nil {
+		sanitizer = DefaultArgSanitizer
+	}
+	return func(command string, keys []string, args []interface{}) []string {
+		redactedKeys := make([]string, len(keys))
+		for i, key := range keys {
+			redactedKeys[i] = key
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(pattern, key); ok {
+					redactedKeys[i] = redacted
+					break
+				}
+			}
+		}
+		return sanitizer(command, redactedKeys, args)
+	}
+}
+
+// statement returns the command and its sanitized arguments
+func statement(command string, args []string) string {
+	if len(args) == 0 {
+		return strings.ToUpper(command)
+	}
+	return strings.ToUpper(command) + " " + strings.Join(args, " ")
+}
+
+// sanitizeArgs sanitizes the arguments of a call with the configured
+// sanitizer
+func (o TraceOptions) sanitizeArgs(command string, keys []string, args []interface{}) []string {
+	sanitize := o.ArgSanitizer
+	if sanitize == nil {
+		sanitize = DefaultArgSanitizer
+	}
+	return sanitize(command, keys, args)
+}
@@ -0,0 +1,122 @@
+package ocredis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"go.opencensus.io/trace"
+)
+
+// Scripter represents the redis scripting commands used to run a Script
+type Scripter interface {
+	Eval(ctx context.Context, script string, keys []string, args []string) RedisCmd
+	EvalSha(ctx context.Context, sha1 string, keys []string, args []string) RedisCmd
+	ScriptExists(ctx context.Context, scripts ...string) BoolSliceCmd
+	ScriptFlush(ctx context.Context) StatusCmd
+	ScriptLoad(ctx context.Context, script string) StringCmd
+}
+
+// Script is a named lua script that is run using EVALSHA so the source is only
+// sent to redis when the script cache doesn't have it yet.
+//
+// The calls of a script are named after it: the name is appended to the span
+// name and to the GoRedisMethod tag, such as go.redis.evalsha.rate_limit. The
+// SHA1 of the source is only the redis.script.sha span attribute, it's left
+// out of the tag since every edit of the script would start a new time
+// series while its name stays the same.
+type Script struct {
+	name string
+	src  string
+	hash string
+}
+
+// NewScript returns a Script with the given name and lua source
+func NewScript(name, src string) *Script {
+	h := sha1.New()
+	_, _ = h.Write([]byte(src))
+	return &Script{
+		name: name,
+		src:  src,
+		hash: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// Name returns the name of the script
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Hash returns the SHA1 digest of the script source
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Load loads the script into the redis script cache
+func (s *Script) Load(ctx context.Context, c Scripter) StringCmd {
+	return c.ScriptLoad(withScript(ctx, s), s.src)
+}
+
+// Exists checks if the script is in the redis script cache
+func (s *Script) Exists(ctx context.Context, c Scripter) BoolSliceCmd {
+	return c.ScriptExists(withScript(ctx, s), s.hash)
+}
+
+// Eval runs the script by sending the full source to redis
+func (s *Script) Eval(ctx context.Context, c Scripter, keys []string, args []string) RedisCmd {
+	return c.Eval(withScript(ctx, s), s.src, keys, args)
+}
+
+// EvalSha runs the script using its SHA1 digest
+func (s *Script) EvalSha(ctx context.Context, c Scripter, keys []string, args []string) RedisCmd {
+	return c.EvalSha(withScript(ctx, s), s.hash, keys, args)
+}
+
+// Run runs the script using EVALSHA. If redis doesn't have the script cached
+// the script is loaded and EVALSHA is retried. When loading fails the script
+// falls back to EVAL.
+func (s *Script) Run(ctx context.Context, c Scripter, keys []string, args []string) RedisCmd {
+	cmd := s.EvalSha(ctx, c, keys, args)
+	if !isNoScriptErr(cmd.Err()) {
+		return cmd
+	}
+	if err := s.Load(ctx, c).Err(); err != nil {
+		return s.Eval(ctx, c, keys, args)
+	}
+	return s.EvalSha(ctx, c, keys, args)
+}
+
+func isNoScriptErr(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
+}
+
+type scriptKey struct{}
+
+func withScript(ctx context.Context, s *Script) context.Context {
+	return context.WithValue(ctx, scriptKey{}, s)
+}
+
+func scriptFromContext(ctx context.Context) *Script {
+	s, _ := ctx.Value(scriptKey{}).(*Script)
+	return s
+}
+
+// scriptName appends the name of the script being run, if any, to name
+func scriptName(ctx context.Context, name string) string {
+	if s := scriptFromContext(ctx); s != nil {
+		return name + "." + s.name
+	}
+	return name
+}
+
+func scriptAttributes(ctx context.Context) []trace.Attribute {
+	s := scriptFromContext(ctx)
+	if s == nil {
+		return nil
+	}
+	return []trace.Attribute{
+		trace.StringAttribute("redis.script.name", s.name),
+		trace.StringAttribute("redis.script.sha", s.hash),
+	}
+}
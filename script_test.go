@@ -0,0 +1,101 @@
+package ocredis_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/octest"
+	"github.com/KolbyMcGarrah/ocredis/redistest"
+	v4 "github.com/KolbyMcGarrah/ocredis/v4"
+	"go.opencensus.io/trace"
+	redis "gopkg.in/redis.v4"
+)
+
+const incrBySrc = "return redis.call('INCRBY', KEYS[1], ARGV[1])"
+
+func newScriptClient(t *testing.T) (*redistest.Server, *v4.Wrapper, *octest.Exporter) {
+	t.Helper()
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting server: %v", err)
+	}
+	s.RegisterScript(incrBySrc, func(keys, args []string) (interface{}, error) {
+		return 42, nil
+	})
+	e, err := octest.NewExporter()
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		e.Unregister()
+		_ = s.Close()
+	})
+	c := v4.Wrap(client,
+		ocredis.WithAllTraceOptions(),
+		ocredis.WithAllowRoot(true),
+		ocredis.WithInstanceName("script"),
+	)
+	return s, c, e
+}
+
+func TestScriptRunLoadsOnNoScript(t *testing.T) {
+	s, c, e := newScriptClient(t)
+	script := ocredis.NewScript("incrby", incrBySrc)
+
+	if v, err := script.Run(context.Background(), c, []string{"counter"}, []string{"1"}).Result(); err != nil || v != int64(42) {
+		t.Fatalf("Run = %v, %v, want 42", v, err)
+	}
+	for command, want := range map[string]int{"evalsha": 2, "script": 1, "eval": 0} {
+		if got := s.CommandCount(command); got != want {
+			t.Errorf("CommandCount(%s) = %d, want %d", command, got, want)
+		}
+	}
+	attrs := map[string]interface{}{
+		"redis.script.name": "incrby",
+		"redis.script.sha":  script.Hash(),
+	}
+	if n := len(e.SpansNamed("go.redis.evalsha.incrby")); n != 2 {
+		t.Errorf("recorded %d evalsha spans, want 2", n)
+	}
+	e.AssertSpan(t, "go.redis.evalsha.incrby", attrs, trace.StatusCodeOK)
+	e.AssertSpan(t, "go.redis.evalsha.incrby", attrs, trace.StatusCodeNotFound)
+	e.AssertSpan(t, "go.redis.scriptload.incrby", attrs, trace.StatusCodeOK)
+	e.AssertCallCount(t, "script", "go.redis.evalsha.incrby", "OK", 1)
+	e.AssertCallCount(t, "script", "go.redis.evalsha.incrby", "ERROR", 1)
+	e.AssertCallCount(t, "script", "go.redis.scriptload.incrby", "OK", 1)
+
+	// the script is now cached so a single EVALSHA runs it
+	e.Reset()
+	if err := script.Run(context.Background(), c, []string{"counter"}, []string{"1"}).Err(); err != nil {
+		t.Fatalf("Run of the cached script: %v", err)
+	}
+	if got := s.CommandCount("evalsha"); got != 3 {
+		t.Errorf("CommandCount(evalsha) = %d, want 3", got)
+	}
+	e.AssertSpan(t, "go.redis.evalsha.incrby", attrs, trace.StatusCodeOK)
+	e.AssertNoSpan(t, "go.redis.scriptload.incrby")
+	e.AssertCallCount(t, "script", "go.redis.evalsha.incrby", "OK", 1)
+	e.AssertCallCount(t, "script", "go.redis.evalsha.incrby", "ERROR", 0)
+}
+
+func TestScriptRunFallsBackToEval(t *testing.T) {
+	s, c, e := newScriptClient(t)
+	s.SetError("script", "ERR script loading disabled")
+	script := ocredis.NewScript("incrby", incrBySrc)
+
+	if v, err := script.Run(context.Background(), c, []string{"counter"}, []string{"1"}).Result(); err != nil || v != int64(42) {
+		t.Fatalf("Run = %v, %v, want 42", v, err)
+	}
+	if got := s.CommandCount("eval"); got != 1 {
+		t.Errorf("CommandCount(eval) = %d, want 1", got)
+	}
+	e.AssertSpan(t, "go.redis.eval.incrby", map[string]interface{}{
+		"redis.script.name": "incrby",
+		"redis.script.sha":  script.Hash(),
+	}, trace.StatusCodeOK)
+	e.AssertCallCount(t, "script", "go.redis.eval.incrby", "OK", 1)
+	e.AssertCallCount(t, "script", "go.redis.scriptload.incrby", "ERROR", 1)
+}
@@ -0,0 +1,210 @@
+// Package serverinfo periodically scrapes the INFO of redis instances through
+// their wrapped clients into the ServerViews of the ocredis package. The
+// stats are tagged with the GoRedisInstanceName of the client, so client and
+// server views of an instance can be joined.
+package serverinfo
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// The defaults of Options
+const (
+	DefaultInterval = 15 * time.Second
+	DefaultTimeout  = 5 * time.Second
+)
+
+// Options configures a Collector. Zero fields use the defaults.
+type Options struct {
+	// InstanceName is the GoRedisInstanceName tag of the stats. When empty
+	// it's the instance name of the client if it implements
+	// ocredis.InstanceNamer, as the wrappers do, and DefaultInstanceName
+	// otherwise.
+	InstanceName string
+
+	// Interval is the time between scrapes
+	Interval time.Duration
+
+	// Timeout bounds the time a scrape can take before it fails
+	Timeout time.Duration
+}
+
+// Collector scrapes the memory, clients, stats, replication, keyspace and
+// commandstats sections of INFO once started. Gauges, such as used_memory,
+// are recorded as they are. Counters, such as keyspace_hits, are recorded as
+// their increase since the previous scrape, so the cumulative views follow
+// the counters of the server; the first scrape records their whole value.
+//
+// Failed scrapes are recorded by the instrumentation of the INFO call of the
+// wrapped client and otherwise ignored.
+type Collector struct {
+	client  ocredis.InfoGetter
+	options Options
+
+	mu       sync.Mutex
+	counters map[counter]int64
+
+	start sync.Once
+	stop  sync.Once
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// counter identifies a counter of the server
+type counter struct {
+	measure *stats.Int64Measure
+	command string
+}
+
+// NewCollector returns a collector of the instance of client
+func NewCollector(client ocredis.InfoGetter, options Options) *Collector {
+	if options.InstanceName == "" {
+		options.InstanceName = ocredis.DefaultInstanceName
+		if n, ok := client.(ocredis.InstanceNamer); ok {
+			options.InstanceName = n.InstanceName()
+		}
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	return &Collector{
+		client:   client,
+		options:  options,
+		counters: map[counter]int64{},
+		done:     make(chan struct{}),
+	}
+}
+
+// Start scrapes now and then every Interval until Stop is called
+func (c *Collector) Start() {
+	c.start.Do(func() {
+		c.wg.Add(1)
+		go c.run()
+	})
+}
+
+// Stop stops the scrapes and waits for the running scrape to end
+func (c *Collector) Stop() {
+	c.stop.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+}
+
+func (c *Collector) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+	for {
+		_ = c.Collect(context.Background())
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect scrapes INFO now and records its stats. The scrape fails once
+// Timeout elapsed.
+func (c *Collector) Collect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+	reply, err := c.client.Info(ctx, "all").Result()
+	if err != nil {
+		return err
+	}
+	c.record(ocredis.ParseInfo(reply))
+	return nil
+}
+
+// record records the stats of the INFO reply. Missing fields aren't recorded.
+func (c *Collector) record(info ocredis.Info) {
+	ctx := context.Background()
+	instance := tag.Insert(ocredis.GoRedisInstanceName, c.options.InstanceName)
+	var gauges []stats.Measurement
+	gauge := func(m *stats.Int64Measure, section, field string) {
+		if n, ok := intField(info, section, field); ok {
+			gauges = append(gauges, m.M(n))
+		}
+	}
+	gauge(ocredis.MeasureServerUsedMemory, "memory", "used_memory")
+	gauge(ocredis.MeasureServerConnectedClients, "clients", "connected_clients")
+	gauge(ocredis.MeasureServerConnectedReplicas, "replication", "connected_slaves")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var increases []stats.Measurement
+	increase := func(m *stats.Int64Measure, section, field string) {
+		if n, ok := intField(info, section, field); ok {
+			increases = append(increases, m.M(c.increase(counter{measure: m}, n)))
+		}
+	}
+	increase(ocredis.MeasureServerEvictedKeys, "stats", "evicted_keys")
+	increase(ocredis.MeasureServerKeyspaceHits, "stats", "keyspace_hits")
+	increase(ocredis.MeasureServerKeyspaceMisses, "stats", "keyspace_misses")
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{instance}, append(gauges, increases...)...)
+
+	for db, value := range info["keyspace"] {
+		keys, err := strconv.ParseInt(ocredis.ParseInfoValue(value)["keys"], 10, 64)
+		if err != nil {
+			continue
+		}
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{instance, tag.Insert(ocredis.GoRedisDB, db)},
+			ocredis.MeasureServerKeys.M(keys),
+		)
+	}
+
+	for field, value := range info["commandstats"] {
+		if !strings.HasPrefix(field, "cmdstat_") {
+			continue
+		}
+		command := strings.TrimPrefix(field, "cmdstat_")
+		values := ocredis.ParseInfoValue(value)
+		calls, err := strconv.ParseInt(values["calls"], 10, 64)
+		if err != nil {
+			continue
+		}
+		usec, err := strconv.ParseInt(values["usec"], 10, 64)
+		if err != nil {
+			continue
+		}
+		_ = stats.RecordWithTags(ctx, []tag.Mutator{instance, tag.Insert(ocredis.GoRedisCommand, command)},
+			ocredis.MeasureServerCommandCalls.M(c.increase(counter{ocredis.MeasureServerCommandCalls, command}, calls)),
+			ocredis.MeasureServerCommandUsec.M(c.increase(counter{ocredis.MeasureServerCommandUsec, command}, usec)),
+		)
+	}
+}
+
+// increase returns the increase of the counter since the previous scrape. A
+// counter lower than at the previous scrape was reset, such as by a restart
+// or CONFIG RESETSTAT, so its whole value is the increase. The lock must be
+// held.
+func (c *Collector) increase(k counter, n int64) int64 {
+	previous, ok := c.counters[k]
+	c.counters[k] = n
+	if !ok || n < previous {
+		return n
+	}
+	return n - previous
+}
+
+func intField(info ocredis.Info, section, field string) (int64, bool) {
+	value, ok := info.Get(section, field)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	return n, err == nil
+}
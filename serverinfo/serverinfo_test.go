@@ -0,0 +1,198 @@
+package serverinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// infoClient replies to INFO with the next of its replies
+type infoClient struct {
+	replies []string
+	err     error
+}
+
+func (c *infoClient) Info(ctx context.Context, section ...string) ocredis.StringCmd {
+	if c.err != nil {
+		return ocredis.NewStringResult("", c.err)
+	}
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	return ocredis.NewStringResult(reply, nil)
+}
+
+func infoReply(usedMemory, hits, getCalls, getUsec, keys int) string {
+	return fmt.Sprintf("# Memory\r\nused_memory:%d\r\n"+
+		"# Stats\r\nkeyspace_hits:%d\r\nkeyspace_misses:0\r\n"+
+		"# Keyspace\r\ndb0:keys=%d,expires=0,avg_ttl=0\r\n"+
+		"# Commandstats\r\ncmdstat_get:calls=%d,usec=%d,usec_per_call=1.00\r\n",
+		usedMemory, hits, keys, getCalls, getUsec)
+}
+
+func registerServerViews(t *testing.T) {
+	t.Helper()
+	if err := view.Register(ocredis.ServerViews...); err != nil {
+		t.Fatalf("registering the views: %v", err)
+	}
+	t.Cleanup(func() { view.Unregister(ocredis.ServerViews...) })
+}
+
+// rowValue returns the value of the row of the view with the tags
+func rowValue(t *testing.T, v *view.View, tags ...tag.Tag) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatalf("reading %s: %v", v.Name, err)
+	}
+rows:
+	for _, row := range rows {
+		for _, want := range tags {
+			found := false
+			for _, got := range row.Tags {
+				if got == want {
+					found = true
+				}
+			}
+			if !found {
+				continue rows
+			}
+		}
+		switch data := row.Data.(type) {
+		case *view.SumData:
+			return data.Value
+		case *view.LastValueData:
+			return data.Value
+		}
+	}
+	return -1
+}
+
+func TestCollectorCounterDeltas(t *testing.T) {
+	registerServerViews(t)
+	client := &infoClient{replies: []string{
+		infoReply(1000, 100, 10, 50, 5),
+		infoReply(2000, 150, 15, 80, 7),
+		// the server restarted and its counters started again
+		infoReply(500, 20, 3, 9, 1),
+	}}
+	c := NewCollector(client, Options{InstanceName: "serverinfo-deltas"})
+	instance := tag.Tag{Key: ocredis.GoRedisInstanceName, Value: "serverinfo-deltas"}
+	get := tag.Tag{Key: ocredis.GoRedisCommand, Value: "get"}
+	db0 := tag.Tag{Key: ocredis.GoRedisDB, Value: "db0"}
+
+	want := []struct {
+		memory, hits, calls, usec, keys float64
+	}{
+		// the first scrape records the whole value of the counters
+		{1000, 100, 10, 50, 5},
+		{2000, 150, 15, 80, 7},
+		// the counters that went down were reset, their whole value is the
+		// increase
+		{500, 170, 18, 89, 1},
+	}
+	for i, w := range want {
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("scrape %d: %v", i, err)
+		}
+		got := []float64{
+			rowValue(t, ocredis.GoRedisServerUsedMemoryView, instance),
+			rowValue(t, ocredis.GoRedisServerKeyspaceHitsView, instance),
+			rowValue(t, ocredis.GoRedisServerCommandCallsView, instance, get),
+			rowValue(t, ocredis.GoRedisServerCommandUsecView, instance, get),
+			rowValue(t, ocredis.GoRedisServerKeysView, instance, db0),
+		}
+		expected := []float64{w.memory, w.hits, w.calls, w.usec, w.keys}
+		for j, name := range []string{"used_memory", "keyspace_hits", "calls", "usec", "keys"} {
+			if got[j] != expected[j] {
+				t.Errorf("scrape %d: %s = %v, want %v", i, name, got[j], expected[j])
+			}
+		}
+	}
+}
+
+func TestCollectorIgnoresMissingFields(t *testing.T) {
+	registerServerViews(t)
+	client := &infoClient{replies: []string{
+		"# Stats\r\nkeyspace_hits:10\r\n",
+		// a scrape without the counter keeps its previous value
+		"# Memory\r\nused_memory:10\r\n",
+		"# Stats\r\nkeyspace_hits:15\r\n",
+	}}
+	c := NewCollector(client, Options{InstanceName: "serverinfo-missing"})
+	for i := 0; i < 3; i++ {
+		if err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("scrape %d: %v", i, err)
+		}
+	}
+	instance := tag.Tag{Key: ocredis.GoRedisInstanceName, Value: "serverinfo-missing"}
+	if got := rowValue(t, ocredis.GoRedisServerKeyspaceHitsView, instance); got != 15 {
+		t.Errorf("keyspace_hits = %v, want 15", got)
+	}
+	if got := rowValue(t, ocredis.GoRedisServerEvictedKeysView, instance); got != -1 {
+		t.Errorf("evicted_keys = %v, want no row", got)
+	}
+}
+
+func TestCollectorError(t *testing.T) {
+	failure := errors.New("connection refused")
+	c := NewCollector(&infoClient{err: failure}, Options{})
+	if err := c.Collect(context.Background()); err != failure {
+		t.Errorf("Collect = %v, want %v", err, failure)
+	}
+}
+
+// hungClient doesn't reply to INFO until the context of the call is done
+type hungClient struct {
+	name string
+}
+
+func (c hungClient) Info(ctx context.Context, section ...string) ocredis.StringCmd {
+	<-ctx.Done()
+	return ocredis.NewStringResult("", ctx.Err())
+}
+
+func (c hungClient) InstanceName() string {
+	return c.name
+}
+
+func TestCollectorTimeout(t *testing.T) {
+	c := NewCollector(hungClient{}, Options{Timeout: 10 * time.Millisecond, Interval: time.Hour})
+	if err := c.Collect(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("Collect = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Stop doesn't wait for a hung scrape longer than the timeout
+	c.Start()
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on the hung scrape")
+	}
+}
+
+func TestCollectorInstanceName(t *testing.T) {
+	for _, tc := range []struct {
+		client  ocredis.InfoGetter
+		options Options
+		want    string
+	}{
+		{&infoClient{}, Options{}, ocredis.DefaultInstanceName},
+		{hungClient{name: "sessions"}, Options{}, "sessions"},
+		{hungClient{name: "sessions"}, Options{InstanceName: "cache"}, "cache"},
+	} {
+		if got := NewCollector(tc.client, tc.options).options.InstanceName; got != tc.want {
+			t.Errorf("instance name with the options %+v = %q, want %q", tc.options, got, tc.want)
+		}
+	}
+}
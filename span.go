@@ -2,6 +2,7 @@ package ocredis
 
 import (
 	"context"
+	"time"
 
 	"go.opencensus.io/trace"
 )
@@ -9,6 +10,24 @@ import (
 // SpanWrapper holds a pointer to a span that allows us to call a function to close the span
 type SpanWrapper struct {
 	span *trace.Span
+
+	// The following are used to start a sampled span when a call the
+	// sampler dropped is tail sampled
+	ctx      context.Context
+	spanName string
+	options  TraceOptions
+	command  CommandConfig
+	start    time.Time
+
+	// attributes and annotations added after the span started, they're
+	// copied to the span replacing a tail sampled one
+	attributes  []trace.Attribute
+	annotations []annotation
+}
+
+type annotation struct {
+	attributes []trace.Attribute
+	message    string
 }
 
 // AllowTrace checks to see if we should start a trace on the given function call
@@ -22,38 +41,112 @@ func StartSpan(ctx context.Context, spanName string, options TraceOptions) *Span
 	if !options.AllowRoot && parentSpan == nil {
 		return nil
 	}
-	var span *trace.Span
+	s := &SpanWrapper{
+		ctx:      ctx,
+		spanName: spanName,
+		options:  options,
+		command:  options.Command(commandName(spanName)),
+		start:    time.Now(),
+	}
+	s.span = s.startSpan(s.command.Sampler)
+	return s
+}
 
-	_, span = trace.StartSpan(ctx, spanName,
+func (s *SpanWrapper) startSpan(sampler trace.Sampler) *trace.Span {
+	_, span := trace.StartSpan(s.ctx, scriptName(s.ctx, s.spanName),
 		trace.WithSpanKind(trace.SpanKindClient),
-		trace.WithSampler(options.Sampler),
+		trace.WithSampler(sampler),
 	)
-	if len(options.DefaultAttributes) > 0 {
-		span.AddAttributes(options.DefaultAttributes...)
+	if len(s.options.DefaultAttributes) > 0 {
+		span.AddAttributes(s.options.DefaultAttributes...)
+	}
+	if len(s.command.Attributes) > 0 {
+		span.AddAttributes(s.command.Attributes...)
 	}
-	return &SpanWrapper{
-		span: span,
+	if attrs := scriptAttributes(s.ctx); len(attrs) > 0 {
+		span.AddAttributes(attrs...)
 	}
+	if attrs := routeAttributes(s.ctx); len(attrs) > 0 {
+		span.AddAttributes(attrs...)
+	}
+	if attrs := namespaceAttributes(s.ctx); len(attrs) > 0 {
+		span.AddAttributes(attrs...)
+	}
+	if len(s.attributes) > 0 {
+		span.AddAttributes(s.attributes...)
+	}
+	for _, a := range s.annotations {
+		span.Annotate(a.attributes, a.message)
+	}
+	return span
+}
+
+// AddAttributes adds attributes to the span
+func (s *SpanWrapper) AddAttributes(attrs ...trace.Attribute) {
+	s.attributes = append(s.attributes, attrs...)
+	s.span.AddAttributes(attrs...)
+}
+
+// Annotate adds an annotation to the span
+func (s *SpanWrapper) Annotate(attrs []trace.Attribute, message string) {
+	s.annotations = append(s.annotations, annotation{attributes: attrs, message: message})
+	s.span.Annotate(attrs, message)
+}
+
+// SpanContext returns the span context of the span
+func (s *SpanWrapper) SpanContext() trace.SpanContext {
+	return s.span.SpanContext()
 }
 
 // EndSpanWithErr sets the status of the span based on the supplied error and then ends the span
 func (s *SpanWrapper) EndSpanWithErr(err error) {
+	s.tailSample(err)
 	s.setSpanStatus(err)
 	s.span.End()
 }
 
 // EndSpan sets the status of the span and then ends the span
 func (s *SpanWrapper) EndSpan() {
+	s.tailSample(nil)
+	s.span.End()
+}
+
+// tailSample replaces a span the sampler dropped with a sampled one when the
+// call failed or was slow and tail sampling is enabled. Since the decision is
+// made once the call is done the new span starts late, the actual start time
+// and latency of the call are added as attributes.
+func (s *SpanWrapper) tailSample(err error) {
+	if s.span.SpanContext().IsSampled() {
+		return
+	}
+	latency := time.Since(s.start)
+	failed := s.options.SampleErrors && err != nil && !IsNil(err)
+	slow := s.options.SampleSlowerThan > 0 && latency >= s.options.SampleSlowerThan
+	if !failed && !slow {
+		return
+	}
 	s.span.End()
+	s.span = s.startSpan(trace.AlwaysSample())
+	s.span.AddAttributes(
+		trace.BoolAttribute("ocredis.tail_sampled", true),
+		trace.StringAttribute("ocredis.start_time", s.start.Format(time.RFC3339Nano)),
+		trace.Int64Attribute("ocredis.latency_ms", latency.Milliseconds()),
+	)
 }
 
+// setSpanStatus sets the status code of the error type of err. A redis.Nil
+// error isn't a failure, its span is OK.
 func (s *SpanWrapper) setSpanStatus(err error) {
-	var status trace.Status
-	if err == nil {
-		status.Code = trace.StatusCodeOK
-	} else {
-		status.Code = trace.StatusCodeUnknown
+	var (
+		status    trace.Status
+		errorType = ClassifyError(err)
+	)
+	status.Code = ErrorStatusCode(errorType)
+	if err != nil {
 		status.Message = err.Error()
 	}
+	if errorType != "" {
+		s.span.AddAttributes(trace.StringAttribute("redis.error_type", errorType))
+	}
 	s.span.SetStatus(status)
 }
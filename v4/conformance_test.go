@@ -0,0 +1,17 @@
+package v4
+
+import (
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/conformance"
+	redis "gopkg.in/redis.v4"
+)
+
+// TestConformance runs the conformance suite. The wrapper has no ExpireAt,
+// HSet, HGet and HLen methods.
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(addr string, options ...ocredis.TraceOption) interface{} {
+		return Wrap(redis.NewClient(&redis.Options{Addr: addr}), options...)
+	}, "ExpireAt", "HSet", "HGet", "HLen")
+}
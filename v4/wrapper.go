@@ -5,28 +5,37 @@ import (
 	"time"
 
 	"github.com/KolbyMcGarrah/ocredis"
-	"go.opencensus.io/trace"
 	pkgredis "gopkg.in/redis.v4"
 )
 
 // Wrap returns a wrapped redis client
 func Wrap(c *pkgredis.Client, options ...ocredis.TraceOption) *Wrapper {
-	o := ocredis.TraceOptions{}
-	for _, option := range options {
-		option(&o)
-	}
-	if o.InstanceName == "" {
-		o.InstanceName = ocredis.DefaultInstanceName
-	} else {
-		o.DefaultAttributes = append(o.DefaultAttributes, trace.StringAttribute("cache.instance", o.InstanceName))
-	}
+	o := ocredis.NewTraceOptions(options...)
+	ocredis.RegisterInstance(&o, ocredis.Instance{
+		PoolStats: func() ocredis.PoolStats {
+			s := c.PoolStats()
+			return ocredis.PoolStats{
+				Requests:   s.Requests,
+				Hits:       s.Hits,
+				Timeouts:   s.Timeouts,
+				TotalConns: s.TotalConns,
+				FreeConns:  s.FreeConns,
+			}
+		},
+		Ping: func() error {
+			return c.Ping().Err()
+		},
+	})
 	return &Wrapper{
 		client:  c,
 		options: o,
 	}
 }
 
-var _ ocredis.Client = &Wrapper{}
+var (
+	_ ocredis.Client   = &Wrapper{}
+	_ ocredis.Scripter = &Wrapper{}
+)
 
 // Wrapper wraps the redis package with an instance name to be used to collect metrics.
 type Wrapper struct {
@@ -34,186 +43,246 @@ type Wrapper struct {
 	options ocredis.TraceOptions
 }
 
+// InstanceName returns the instance name of the wrapper
+func (w *Wrapper) InstanceName() string {
+	return w.options.InstanceName
+}
+
+// CircuitState returns the state of the circuit breaker of the wrapper, and
+// false when it has none
+func (w *Wrapper) CircuitState() (int, bool) {
+	return w.options.CircuitState()
+}
+
 // Get integrates the redis get command with metrics
 func (w *Wrapper) Get(ctx context.Context, key string) (cmd ocredis.StringCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Get, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Get", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.get", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "get", []string{key})
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-
-	cmd = w.client.Get(key)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Get(key)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStringResult("", err)
+	}
 	return
 }
 
 // Set integrates the redis Set command with metrics
 func (w *Wrapper) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) (cmd ocredis.StatusCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Set, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Set", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.set", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "set", []string{key}, value, expiration)
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-
-	cmd = w.client.Set(key, value, expiration)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Set(key, value, expiration)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStatusResult("", err)
+	}
 	return
 }
 
 // Incr integrates the redis Incr command with metrics
 func (w *Wrapper) Incr(ctx context.Context, key string) (cmd ocredis.IntCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Incr, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Incr", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.incr", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "incr", []string{key})
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.Incr(key)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Incr(key)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewIntResult(0, err)
+	}
 	return
-
 }
 
 // Ping integrates the redis Ping command with metrics
 func (w *Wrapper) Ping(ctx context.Context) (cmd ocredis.StatusCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Ping, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Ping", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.ping", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "ping", nil)
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.Ping()
-	return cmd
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Ping()
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStatusResult("", err)
+	}
+	return
 }
 
 // Del integrates the redis Del command with metrics
 func (w *Wrapper) Del(ctx context.Context, keys ...string) (cmd ocredis.IntCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Del, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Del", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.del", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "del", keys)
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.Del(keys...)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Del(keys...)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewIntResult(0, err)
+	}
 	return
 }
 
 // SetNX integrates the redis SetNX command with metrics
 func (w *Wrapper) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (cmd ocredis.BoolCmd) {
-	if ocredis.AllowTrace(ctx, w.options.SetNX, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "SetNX", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.setnx", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "setnx", []string{key}, value, expiration)
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.SetNX(key, value, expiration)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.SetNX(key, value, expiration)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewBoolResult(false, err)
+	}
 	return
 }
 
 // Close integrates the redis Close command with metrics
 func (w *Wrapper) Close(ctx context.Context) (err error) {
-	if ocredis.AllowTrace(ctx, w.options.Close, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Close", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(err)
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.close", w.options.InstanceName)
+	ocredis.UnregisterInstance(w.options)
+	call := ocredis.StartCall(ctx, w.options, "close", nil)
 	defer func() {
-		// Pass in a blank cmd because there is no command type returned from close
-		recordCallFunc(&pkgredis.Cmd{})
+		call.End(ocredis.NewStatusResult("", err))
 	}()
-	err = w.client.Close()
+	call.Do(func() ocredis.Cmd {
+		err = w.client.Close()
+		return ocredis.NewStatusResult("", err)
+	})
 	return
 }
 
 // Expire integrates the redis Expire command with metrics
 func (w *Wrapper) Expire(ctx context.Context, key string, expiration time.Duration) (cmd ocredis.BoolCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Expire, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "Expire", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.expire", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "expire", []string{key}, expiration)
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.Expire(key, expiration)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Expire(key, expiration)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewBoolResult(false, err)
+	}
 	return
 }
 
 // Eval integrates the redis Eval command with metrics
 func (w *Wrapper) Eval(ctx context.Context, script string, keys []string, args []string) (cmd ocredis.RedisCmd) {
-	if ocredis.AllowTrace(ctx, w.options.Eval, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "go.redis.eval", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.eval", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "eval", keys, toInterfaces(args)...)
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.Eval(script, keys, args)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Eval(script, keys, toInterfaces(args)...)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewCmdResult(nil, err)
+	}
 	return
 }
 
 // LPop integrates the redis LPOP command with metrics
 func (w *Wrapper) LPop(ctx context.Context, key string) (cmd ocredis.StringCmd) {
-	if ocredis.AllowTrace(ctx, w.options.LPop, w.options.AllowRoot) {
-		span := ocredis.StartSpan(ctx, "go.redis.lpop", w.options)
-		if span != nil {
-			defer func() {
-				span.EndSpanWithErr(cmd.Err())
-			}()
-		}
-	}
-	var recordCallFunc = ocredis.RecordCall(ctx, "go.redis.lpop", w.options.InstanceName)
+	call := ocredis.StartCall(ctx, w.options, "lpop", []string{key})
 	defer func() {
-		recordCallFunc(cmd)
+		call.End(cmd)
 	}()
-	cmd = w.client.LPop(key)
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.LPop(key)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStringResult("", err)
+	}
 	return
 }
+
+// EvalSha integrates the redis EVALSHA command with metrics
+func (w *Wrapper) EvalSha(ctx context.Context, sha1 string, keys []string, args []string) (cmd ocredis.RedisCmd) {
+	call := ocredis.StartCall(ctx, w.options, "evalsha", keys, toInterfaces(args)...)
+	defer func() {
+		call.End(cmd)
+	}()
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.EvalSha(sha1, keys, toInterfaces(args)...)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewCmdResult(nil, err)
+	}
+	return
+}
+
+// ScriptExists integrates the redis SCRIPT EXISTS command with metrics
+func (w *Wrapper) ScriptExists(ctx context.Context, scripts ...string) (cmd ocredis.BoolSliceCmd) {
+	call := ocredis.StartCall(ctx, w.options, "scriptexists", nil, toInterfaces(scripts)...)
+	defer func() {
+		call.End(cmd)
+	}()
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.ScriptExists(scripts...)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewBoolSliceResult(nil, err)
+	}
+	return
+}
+
+// ScriptFlush integrates the redis SCRIPT FLUSH command with metrics
+func (w *Wrapper) ScriptFlush(ctx context.Context) (cmd ocredis.StatusCmd) {
+	call := ocredis.StartCall(ctx, w.options, "scriptflush", nil)
+	defer func() {
+		call.End(cmd)
+	}()
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.ScriptFlush()
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStatusResult("", err)
+	}
+	return
+}
+
+// ScriptLoad integrates the redis SCRIPT LOAD command with metrics
+func (w *Wrapper) ScriptLoad(ctx context.Context, script string) (cmd ocredis.StringCmd) {
+	call := ocredis.StartCall(ctx, w.options, "scriptload", nil)
+	defer func() {
+		call.End(cmd)
+	}()
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.ScriptLoad(script)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStringResult("", err)
+	}
+	return
+}
+
+// Info integrates the redis INFO command with metrics
+func (w *Wrapper) Info(ctx context.Context, section ...string) (cmd ocredis.StringCmd) {
+	call := ocredis.StartCall(ctx, w.options, "info", nil, toInterfaces(section)...)
+	defer func() {
+		call.End(cmd)
+	}()
+	if err := call.Do(func() ocredis.Cmd {
+		cmd = w.client.Info(section...)
+		return cmd
+	}); err != nil {
+		cmd = ocredis.NewStringResult("", err)
+	}
+	return
+}
+
+// toInterfaces converts string args to the variadic interface args taken by the redis client
+func toInterfaces(args []string) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		out[i] = arg
+	}
+	return out
+}
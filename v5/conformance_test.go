@@ -0,0 +1,17 @@
+package v5
+
+import (
+	"testing"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	"github.com/KolbyMcGarrah/ocredis/conformance"
+	redis "gopkg.in/redis.v5"
+)
+
+// TestConformance runs the conformance suite. The wrapper has no Incr,
+// Expire and LPop methods.
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(addr string, options ...ocredis.TraceOption) interface{} {
+		return Wrap(redis.NewClient(&redis.Options{Addr: addr}), options...)
+	}, "Incr", "Expire", "LPop")
+}
@@ -0,0 +1,59 @@
+package v5
+
+import (
+	"io"
+
+	"github.com/KolbyMcGarrah/ocredis"
+	pkgredis "gopkg.in/redis.v5"
+)
+
+// SubscribeInvalidations invalidates the keys of the near cache as the pub/sub
+// messages selected by the options are received with c, see
+// ocredis.SubscribeInvalidations. Closing the returned Closer stops the
+// subscription.
+func SubscribeInvalidations(c *pkgredis.Client, cache *ocredis.NearCache, options ocredis.InvalidationOptions) (io.Closer, error) {
+	return ocredis.SubscribeInvalidations(cache, &pubSub{client: c}, options)
+}
+
+// pubSub adapts the pub/sub of the client to ocredis.PubSub
+type pubSub struct {
+	client *pkgredis.Client
+	pubsub *pkgredis.PubSub
+}
+
+func (p *pubSub) Subscribe(channels ...string) error {
+	if p.pubsub != nil {
+		return p.pubsub.Subscribe(channels...)
+	}
+	var err error
+	p.pubsub, err = p.client.Subscribe(channels...)
+	return err
+}
+
+func (p *pubSub) PSubscribe(patterns ...string) error {
+	if p.pubsub != nil {
+		return p.pubsub.PSubscribe(patterns...)
+	}
+	var err error
+	p.pubsub, err = p.client.PSubscribe(patterns...)
+	return err
+}
+
+func (p *pubSub) ReceiveMessage() (channel, payload string, err error) {
+	msg, err := p.pubsub.ReceiveMessage()
+	if err != nil {
+		return "", "", err
+	}
+	return msg.Channel, msg.Payload, nil
+}
+
+func (p *pubSub) Publish(channel, message string) error {
+	return p.client.Publish(channel, message).Err()
+}
+
+func (p *pubSub) Close() error {
+	if p.pubsub == nil {
+		return nil
+	}
+	return p.pubsub.Close()
+}